@@ -0,0 +1,521 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/e-n-0/sign-app-cli/codesigning"
+	"github.com/e-n-0/sign-app-cli/macho"
+	"github.com/e-n-0/sign-app-cli/provisioningprofiles"
+	"github.com/e-n-0/sign-app-cli/sign"
+	"github.com/e-n-0/sign-app-cli/utils"
+	"github.com/spf13/cobra"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	batchParallel int
+	batchLogs     string
+)
+
+// Manifest of the sign-batch command
+type batchManifest struct {
+	// Maximum number of jobs running at the same time
+	Parallel int `yaml:"parallel"`
+	// Folder of the job logs
+	Logs string `yaml:"logs"`
+
+	// Settings of the jobs that do not set them
+	Defaults batchJob   `yaml:"defaults"`
+	Jobs     []batchJob `yaml:"jobs"`
+}
+
+// A signing job of the manifest
+type batchJob struct {
+	Name   string `yaml:"name"`
+	Input  string `yaml:"input"`
+	Output string `yaml:"output"`
+
+	Backend string `yaml:"backend"`
+	// Name of a keychain certificate, or an identity given by files
+	Certificate    string `yaml:"certificate"`
+	identitySource `yaml:",inline"`
+	// Sign ad-hoc, without certificate nor provisioning profile
+	Adhoc bool `yaml:"adhoc"`
+
+	// Provisioning profile of the app (path or installed profile name), and the profiles
+	// by bundle identifier or path relative to the app ("." for the app itself)
+	Profile  string            `yaml:"profile"`
+	Profiles map[string]string `yaml:"profiles"`
+
+	BundleID     string     `yaml:"bundle-id"`
+	Entitlements batchEdits `yaml:"entitlements"`
+	Plist        batchEdits `yaml:"plist"`
+}
+
+// Values set and keys deleted in a plist
+type batchEdits struct {
+	Set    map[string]string `yaml:"set"`
+	Delete []string          `yaml:"delete"`
+}
+
+// Return the job with the defaults applied to the settings it does not set
+func (job batchJob) withDefaults(defaults batchJob) batchJob {
+	if job.Backend == "" {
+		job.Backend = defaults.Backend
+	}
+	// A job with its own identity is not signed ad-hoc
+	if job.Certificate == "" && job.identitySource == (identitySource{}) && !job.Adhoc {
+		job.Certificate = defaults.Certificate
+		job.identitySource = defaults.identitySource
+		job.Adhoc = defaults.Adhoc
+	}
+	if job.Profile == "" && len(job.Profiles) == 0 {
+		job.Profile = defaults.Profile
+		job.Profiles = defaults.Profiles
+	}
+	if job.BundleID == "" {
+		job.BundleID = defaults.BundleID
+	}
+
+	// The edits of the defaults are applied first
+	job.Entitlements = defaults.Entitlements.merge(job.Entitlements)
+	job.Plist = defaults.Plist.merge(job.Plist)
+	return job
+}
+
+func (edits batchEdits) merge(other batchEdits) batchEdits {
+	merged := batchEdits{Set: map[string]string{}, Delete: append(append([]string{}, edits.Delete...), other.Delete...)}
+	for key, value := range edits.Set {
+		merged.Set[key] = value
+	}
+	for key, value := range other.Set {
+		merged.Set[key] = value
+	}
+	return merged
+}
+
+// Convert the edits, the values are set in the order of their keys
+// The keys are typed like the --set-plist values (key:type)
+func (edits batchEdits) plistEdits() ([]sign.PlistEdit, error) {
+	keys := make([]string, 0, len(edits.Set))
+	for key := range edits.Set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, key+"="+edits.Set[key])
+	}
+	return parseKeyEdits(values, edits.Delete)
+}
+
+// Identities and profiles shared by the jobs, each one is loaded once
+type batchResources struct {
+	manifestFolder string
+
+	profiles   map[string]provisioningprofiles.ProvisioningProfile
+	identities map[identitySource]*macho.Identity
+	// Keychain certificates, listed when first needed
+	keychainCertificates []string
+}
+
+func newBatchResources(manifestFolder string) *batchResources {
+	return &batchResources{
+		manifestFolder: manifestFolder,
+		profiles:       map[string]provisioningprofiles.ProvisioningProfile{},
+		identities:     map[identitySource]*macho.Identity{},
+	}
+}
+
+// Resolve a path of the manifest, relative to the manifest folder
+func (resources *batchResources) path(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(resources.manifestFolder, path)
+}
+
+// Load a profile from a file of the manifest or by installed profile name
+func (resources *batchResources) profile(value string) (provisioningprofiles.ProvisioningProfile, error) {
+	if profile, ok := resources.profiles[value]; ok {
+		return profile, nil
+	}
+
+	var profile provisioningprofiles.ProvisioningProfile
+	var err error
+	if path := resources.path(value); utils.FileExists(path) {
+		profile, err = loadProfile("", path)
+	} else {
+		profile, err = loadProfile(value, "")
+	}
+	if err != nil {
+		return profile, err
+	}
+
+	resources.profiles[value] = profile
+	return profile, nil
+}
+
+func (resources *batchResources) identity(source identitySource) (*macho.Identity, error) {
+	if identity, ok := resources.identities[source]; ok {
+		return identity, nil
+	}
+
+	resolved := source
+	resolved.P12File = resources.path(source.P12File)
+	resolved.CertificateFile = resources.path(source.CertificateFile)
+	resolved.PrivateKeyFile = resources.path(source.PrivateKeyFile)
+	identity, err := resolved.load()
+	if err != nil {
+		return nil, err
+	}
+
+	resources.identities[source] = identity
+	return identity, nil
+}
+
+// Find a keychain certificate by name
+func (resources *batchResources) keychainCertificate(name string) (string, error) {
+	if resources.keychainCertificates == nil {
+		certificates, err := codesigning.GetCodesigningCerts()
+		if err != nil {
+			return "", err
+		}
+		resources.keychainCertificates = certificates
+	}
+
+	for _, certificate := range resources.keychainCertificates {
+		if strings.Contains(certificate, name) {
+			return certificate, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find codesigning certificate with name: %s", name)
+}
+
+// Build the signing parameters of a job
+func (resources *batchResources) params(job batchJob) (sign.SignerParams, error) {
+	if job.Input == "" || job.Output == "" {
+		return sign.SignerParams{}, fmt.Errorf("the job must have an input and an output")
+	}
+	input := resources.path(job.Input)
+	if !utils.FileExists(input) {
+		return sign.SignerParams{}, fmt.Errorf("the input file %s does not exist", input)
+	}
+
+	plistEdits, err := job.Plist.plistEdits()
+	if err != nil {
+		return sign.SignerParams{}, err
+	}
+	entitlementEdits, err := job.Entitlements.plistEdits()
+	if err != nil {
+		return sign.SignerParams{}, err
+	}
+
+	// Ad-hoc signatures have no identity nor profile
+	if job.Adhoc {
+		backend := job.Backend
+		if backend == "" {
+			backend = sign.DefaultSignerBackend()
+		}
+		signer, err := sign.NewSigner(backend, sign.SignerConfig{Adhoc: true})
+		if err != nil {
+			return sign.SignerParams{}, err
+		}
+
+		return sign.SignerParams{
+			Signer:              signer,
+			CodesignCertificate: sign.AdhocIdentity,
+			Adhoc:               true,
+			InputFile:           input,
+			OutputFile:          resources.path(job.Output),
+			PlistEdits:          plistEdits,
+			BundleIdentifier:    job.BundleID,
+			EntitlementEdits:    entitlementEdits,
+		}, nil
+	}
+
+	// The app profile is the profile of "." or of the new bundle identifier in the profile map
+	var children []sign.ChildProfile
+	appProfile := job.Profile
+	patterns := make([]string, 0, len(job.Profiles))
+	for pattern := range job.Profiles {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if pattern == "." || (job.BundleID != "" && pattern == job.BundleID) {
+			appProfile = job.Profiles[pattern]
+			continue
+		}
+
+		profile, err := resources.profile(job.Profiles[pattern])
+		if err != nil {
+			return sign.SignerParams{}, err
+		}
+		children = append(children, sign.ChildProfile{Pattern: pattern, Profile: profile})
+	}
+	if appProfile == "" {
+		return sign.SignerParams{}, fmt.Errorf("the job has no provisioning profile for the app")
+	}
+	profile, err := resources.profile(appProfile)
+	if err != nil {
+		return sign.SignerParams{}, err
+	}
+
+	identity, err := resources.identity(job.identitySource)
+	if err != nil {
+		return sign.SignerParams{}, err
+	}
+
+	backend := job.Backend
+	if backend == "" {
+		backend = sign.DefaultSignerBackend()
+	}
+	signer, err := sign.NewSigner(backend, sign.SignerConfig{Identity: identity, P12File: resources.path(job.P12File), P12Password: job.P12Password})
+	if err != nil {
+		return sign.SignerParams{}, err
+	}
+
+	var certificate string
+	if identity != nil {
+		certificate = codesigning.IdentityName(*identity)
+	} else if job.Certificate == "" {
+		return sign.SignerParams{}, fmt.Errorf("the job has no codesigning certificate")
+	} else {
+		certificate, err = resources.keychainCertificate(job.Certificate)
+		if err != nil {
+			return sign.SignerParams{}, err
+		}
+	}
+
+	return sign.SignerParams{
+		Signer:               signer,
+		ProvisioninngProfile: profile,
+		ChildProfiles:        children,
+		CodesignCertificate:  certificate,
+		InputFile:            input,
+		OutputFile:           resources.path(job.Output),
+		PlistEdits:           plistEdits,
+		BundleIdentifier:     job.BundleID,
+		EntitlementEdits:     entitlementEdits,
+	}, nil
+}
+
+// Result of a job of the batch
+type batchResult struct {
+	name     string
+	output   string
+	logFile  string
+	duration time.Duration
+	err      error
+}
+
+// Read the manifest and give a unique name to every job
+func readBatchManifest(path string) (*batchManifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the manifest: %s", err)
+	}
+
+	var manifest batchManifest
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse the manifest %s: %s", path, err)
+	}
+	if len(manifest.Jobs) == 0 {
+		return nil, fmt.Errorf("the manifest %s has no jobs", path)
+	}
+
+	names := map[string]bool{}
+	for i := range manifest.Jobs {
+		job := &manifest.Jobs[i]
+		if job.Name == "" {
+			job.Name = strings.TrimSuffix(filepath.Base(job.Input), filepath.Ext(job.Input))
+		}
+		name := job.Name
+		for n := 2; names[name]; n++ {
+			name = fmt.Sprintf("%s-%d", job.Name, n)
+		}
+		job.Name = name
+		names[name] = true
+	}
+	return &manifest, nil
+}
+
+// Run the jobs, at most parallel at the same time, each one logging to its own file
+func runBatch(manifest *batchManifest, manifestFolder string, logsFolder string, parallel int) []batchResult {
+	resources := newBatchResources(manifestFolder)
+
+	// The shared identities and profiles are loaded before the jobs start
+	results := make([]batchResult, len(manifest.Jobs))
+	params := make([]sign.SignerParams, len(manifest.Jobs))
+	for i, job := range manifest.Jobs {
+		job = job.withDefaults(manifest.Defaults)
+		results[i] = batchResult{name: job.Name, output: job.Output, logFile: filepath.Join(logsFolder, job.Name+".log")}
+		params[i], results[i].err = resources.params(job)
+	}
+
+	// The keychain identities are tested one at a time before the jobs start, fixing them
+	// may ask for a confirmation that the jobs signing at the same time cannot ask
+	checked := map[string]error{}
+	for i := range params {
+		if results[i].err != nil {
+			continue
+		}
+		certificate := params[i].CodesignCertificate
+		err, ok := checked[certificate]
+		if !ok {
+			err = sign.CheckIdentity(params[i])
+			checked[certificate] = err
+		}
+		results[i].err = err
+		params[i].IdentityChecked = true
+	}
+
+	var wait sync.WaitGroup
+	slots := make(chan struct{}, parallel)
+	for i := range results {
+		if results[i].err != nil {
+			fmt.Printf("\033[31m[%s] failed: %s\033[0m\n", results[i].name, results[i].err)
+			if err := os.WriteFile(results[i].logFile, []byte(fmt.Sprintln("error:", results[i].err)), 0644); err != nil {
+				results[i].logFile = ""
+			}
+			continue
+		}
+
+		wait.Add(1)
+		go func(result *batchResult, params sign.SignerParams) {
+			defer wait.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			fmt.Printf("[%s] signing %s\n", result.name, params.InputFile)
+			start := time.Now()
+			result.err = runBatchJob(result.logFile, params)
+			result.duration = time.Since(start)
+
+			if result.err != nil {
+				fmt.Printf("\033[31m[%s] failed: %s\033[0m\n", result.name, result.err)
+			} else {
+				fmt.Printf("\033[32m[%s] signed in %s\033[0m\n", result.name, result.duration.Round(time.Millisecond))
+			}
+		}(&results[i], params[i])
+	}
+	wait.Wait()
+
+	return results
+}
+
+// Sign a job with its progress messages written to the log file
+func runBatchJob(logFile string, params sign.SignerParams) (err error) {
+	log, err := os.Create(logFile)
+	if err != nil {
+		return fmt.Errorf("failed to create the log file: %s", err)
+	}
+	defer log.Close()
+
+	// A failing job must not stop the others
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("%v", recovered)
+		}
+		if err != nil {
+			fmt.Fprintln(log, "error:", err)
+		}
+	}()
+
+	params.Output = log
+	return sign.Sign(params)
+}
+
+// Print the status of every job
+func printBatchSummary(results []batchResult) {
+	fmt.Println()
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "JOB\tSTATUS\tTIME\tOUTPUT\tLOG")
+	for _, result := range results {
+		status := "ok"
+		output := result.output
+		if result.err != nil {
+			status = "FAILED"
+			output = result.err.Error()
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", result.name, status, result.duration.Round(time.Millisecond), output, result.logFile)
+	}
+	writer.Flush()
+}
+
+// batchCmd represents the sign-batch command
+var batchCmd = &cobra.Command{
+	Use:   "sign-batch <manifest.yaml>",
+	Short: "Sign several files described in a manifest",
+	Long: `
+This command signs the jobs of a YAML manifest in parallel, each one with its own
+input, output, certificate, provisioning profiles, bundle identifier, entitlement and Info.plist edits.
+The identities and profiles shared by the jobs are loaded once.
+Every job logs to its own file, and the command fails when a job fails.
+For example:
+$ sign-app-cli sign-batch ./release.yaml --parallel 4`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		manifest, err := readBatchManifest(args[0])
+		if err != nil {
+			end(err)
+		}
+		manifestFolder := filepath.Dir(args[0])
+
+		parallel := manifest.Parallel
+		if cmd.Flags().Changed("parallel") || parallel <= 0 {
+			parallel = batchParallel
+		}
+		if parallel <= 0 {
+			end(fmt.Errorf("invalid number of parallel jobs: %d", parallel))
+		}
+
+		logsFolder := batchLogs
+		if !cmd.Flags().Changed("logs") && manifest.Logs != "" {
+			logsFolder = filepath.Join(manifestFolder, manifest.Logs)
+			if filepath.IsAbs(manifest.Logs) {
+				logsFolder = manifest.Logs
+			}
+		}
+		if err := os.MkdirAll(logsFolder, 0755); err != nil {
+			end(fmt.Errorf("failed to create the logs folder: %s", err))
+		}
+
+		fmt.Printf("Signing %d job%s, %d at a time (logs in %s)\n", len(manifest.Jobs), utils.Plural(len(manifest.Jobs)), parallel, logsFolder)
+		results := runBatch(manifest, manifestFolder, logsFolder, parallel)
+		printBatchSummary(results)
+
+		failed := 0
+		for _, result := range results {
+			if result.err != nil {
+				failed++
+			}
+		}
+		if failed > 0 {
+			fmt.Printf("\033[31m%d of %d job%s failed\033[0m\n", failed, len(results), utils.Plural(len(results)))
+			os.Exit(1)
+		}
+		fmt.Println("\033[32m" + "All the jobs succeeded" + "\033[0m")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+
+	batchCmd.Flags().IntVar(&batchParallel, "parallel", runtime.NumCPU(), "The maximum number of jobs running at the same time (overrides the manifest)")
+	batchCmd.Flags().StringVar(&batchLogs, "logs", "sign-batch-logs", "The folder of the job logs (overrides the manifest)")
+	batchCmd.MarkFlagDirname("logs")
+}
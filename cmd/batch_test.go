@@ -0,0 +1,253 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/e-n-0/sign-app-cli/sign"
+	"howett.net/plist"
+)
+
+// Write a file of the test folder
+func writeTestFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Write a provisioning profile of the bundle identifier, only its plist is read off macOS
+func writeTestProfile(t *testing.T, path string, name string, identifier string) {
+	t.Helper()
+
+	data, err := plist.Marshal(map[string]interface{}{
+		"Name":         name,
+		"Entitlements": map[string]interface{}{"application-identifier": "TEAM123456." + identifier},
+	}, plist.XMLFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, path, data)
+}
+
+// Write a self-signed certificate and its private key in PEM files
+func writeTestIdentity(t *testing.T, certificatePath string, keyPath string, commonName string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName, OrganizationalUnit: []string{"TEAM123456"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyData, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, certificatePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}))
+	writeTestFile(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyData}))
+}
+
+func TestReadBatchManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		names    []string
+		err      string
+	}{
+		{"job names", `
+parallel: 2
+jobs:
+  - input: build/App.ipa
+    output: out/App.ipa
+  - input: other/App.ipa
+    output: out/App-2.ipa
+  - name: beta
+    input: build/App.ipa
+    output: out/beta.ipa
+  - name: beta
+    input: build/App.ipa
+    output: out/beta-2.ipa
+`, []string{"App", "App-2", "beta", "beta-2"}, ""},
+		{"unknown setting", "jobs:\n  - input: App.ipa\n    bundle_id: com.example\n", nil, "field bundle_id not found"},
+		{"no jobs", "parallel: 2\n", nil, "has no jobs"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "release.yaml")
+			writeTestFile(t, path, []byte(test.manifest))
+
+			manifest, err := readBatchManifest(path)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, job := range manifest.Jobs {
+				names = append(names, job.Name)
+			}
+			if !reflect.DeepEqual(names, test.names) {
+				t.Errorf("names %v, expected %v", names, test.names)
+			}
+		})
+	}
+}
+
+func TestBatchJobWithDefaults(t *testing.T) {
+	defaults := batchJob{
+		Backend:     "native",
+		Certificate: "Apple Distribution",
+		Profile:     "default.mobileprovision",
+		BundleID:    "com.example.default",
+		Plist:       batchEdits{Set: map[string]string{"CFBundleDisplayName": "Default", "ITSAppUsesNonExemptEncryption": "false"}, Delete: []string{"UIFileSharingEnabled"}},
+	}
+
+	tests := []struct {
+		name     string
+		job      batchJob
+		expected batchJob
+	}{
+		{"defaults", batchJob{}, batchJob{
+			Backend:     "native",
+			Certificate: "Apple Distribution",
+			Profile:     "default.mobileprovision",
+			BundleID:    "com.example.default",
+			Plist:       batchEdits{Set: map[string]string{"CFBundleDisplayName": "Default", "ITSAppUsesNonExemptEncryption": "false"}, Delete: []string{"UIFileSharingEnabled"}},
+		}},
+		{"own settings", batchJob{
+			Backend:  "codesign",
+			Adhoc:    true,
+			Profiles: map[string]string{".": "app.mobileprovision"},
+			BundleID: "com.example.job",
+			Plist:    batchEdits{Set: map[string]string{"CFBundleDisplayName": "Job"}, Delete: []string{"NSCameraUsageDescription"}},
+		}, batchJob{
+			Backend:  "codesign",
+			Adhoc:    true,
+			Profiles: map[string]string{".": "app.mobileprovision"},
+			BundleID: "com.example.job",
+			Plist:    batchEdits{Set: map[string]string{"CFBundleDisplayName": "Job", "ITSAppUsesNonExemptEncryption": "false"}, Delete: []string{"UIFileSharingEnabled", "NSCameraUsageDescription"}},
+		}},
+		{"own identity", batchJob{identitySource: identitySource{P12File: "job.p12"}}, batchJob{
+			Backend:        "native",
+			identitySource: identitySource{P12File: "job.p12"},
+			Profile:        "default.mobileprovision",
+			BundleID:       "com.example.default",
+			Plist:          batchEdits{Set: map[string]string{"CFBundleDisplayName": "Default", "ITSAppUsesNonExemptEncryption": "false"}, Delete: []string{"UIFileSharingEnabled"}},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			job := test.job.withDefaults(defaults)
+			test.expected.Entitlements = batchEdits{Set: map[string]string{}, Delete: []string{}}
+			if !reflect.DeepEqual(job, test.expected) {
+				t.Errorf("job %+v, expected %+v", job, test.expected)
+			}
+		})
+	}
+}
+
+func TestBatchResourcesParams(t *testing.T) {
+	folder := t.TempDir()
+	writeTestFile(t, filepath.Join(folder, "App.ipa"), []byte("ipa"))
+	writeTestIdentity(t, filepath.Join(folder, "cert.pem"), filepath.Join(folder, "key.pem"), "Apple Distribution: Jane Doe (TEAM123456)")
+	writeTestProfile(t, filepath.Join(folder, "app.mobileprovision"), "App", "com.example.app")
+	writeTestProfile(t, filepath.Join(folder, "new.mobileprovision"), "New", "com.other.app")
+	writeTestProfile(t, filepath.Join(folder, "watch.mobileprovision"), "Watch", "com.other.app.watchkitapp")
+
+	tests := []struct {
+		name     string
+		job      batchJob
+		profile  string
+		children []string
+		err      string
+	}{
+		{"profile", batchJob{Profile: "app.mobileprovision"}, "App", nil, ""},
+		{"profile of the new bundle identifier", batchJob{BundleID: "com.other.app", Profiles: map[string]string{
+			"com.other.app":             "new.mobileprovision",
+			"com.other.app.watchkitapp": "watch.mobileprovision",
+		}}, "New", []string{"com.other.app.watchkitapp"}, ""},
+		{"profile of the app", batchJob{BundleID: "com.other.app", Profiles: map[string]string{
+			".":               "new.mobileprovision",
+			"Watch/Watch.app": "watch.mobileprovision",
+		}}, "New", []string{"Watch/Watch.app"}, ""},
+		{"no app profile", batchJob{Profiles: map[string]string{"com.other.app.watchkitapp": "watch.mobileprovision"}}, "", nil, "no provisioning profile for the app"},
+		{"missing input", batchJob{Input: "Other.ipa", Profile: "app.mobileprovision"}, "", nil, "does not exist"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			job := test.job
+			if job.Input == "" {
+				job.Input = "App.ipa"
+			}
+			job.Output = "out/App.ipa"
+			job.Backend = "native"
+			job.identitySource = identitySource{CertificateFile: "cert.pem", PrivateKeyFile: "key.pem"}
+
+			params, err := newBatchResources(folder).params(job)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if params.InputFile != filepath.Join(folder, "App.ipa") || params.OutputFile != filepath.Join(folder, "out", "App.ipa") {
+				t.Errorf("files %s and %s", params.InputFile, params.OutputFile)
+			}
+			if params.BundleIdentifier != test.job.BundleID {
+				t.Errorf("bundle identifier %q", params.BundleIdentifier)
+			}
+			if params.ProvisioninngProfile.Name != test.profile {
+				t.Errorf("profile %s, expected %s", params.ProvisioninngProfile.Name, test.profile)
+			}
+			var children []string
+			for _, child := range params.ChildProfiles {
+				children = append(children, child.Pattern)
+			}
+			if !reflect.DeepEqual(children, test.children) {
+				t.Errorf("child profiles %v, expected %v", children, test.children)
+			}
+			if params.CodesignCertificate != "Apple Distribution: Jane Doe (TEAM123456)" {
+				t.Errorf("certificate %s", params.CodesignCertificate)
+			}
+			if _, ok := params.Signer.(sign.NativeSigner); !ok {
+				t.Errorf("signer %T", params.Signer)
+			}
+		})
+	}
+}
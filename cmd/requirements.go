@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+	"github.com/e-n-0/sign-app-cli/sign"
+	"github.com/spf13/cobra"
+)
+
+var compiledRequirements string
+
+// requirementsCmd represents the requirements command
+var requirementsCmd = &cobra.Command{
+	Use:   "requirements [file]",
+	Short: "Print the requirements of a signed file in the requirement language",
+	Long: `
+This command prints the requirements of a signed Mach-O file or bundle.
+With --compile, the given requirements are compiled and printed back, to check them before signing.
+For example:
+$ sign-app-cli requirements ./MyApp.app
+$ sign-app-cli requirements --compile 'designated => anchor apple generic and certificate leaf[subject.OU] = "XXXXXXXXXX"'`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if compiledRequirements != "" {
+			blob, err := macho.CompileRequirements(compiledRequirements)
+			if err != nil {
+				end(err)
+			}
+			text, err := macho.FormatRequirements(blob)
+			if err != nil {
+				end(err)
+			}
+			fmt.Println(text)
+			return
+		}
+
+		if len(args) == 0 {
+			end(fmt.Errorf("you must provide a signed file or --compile"))
+		}
+		text, err := sign.ReadRequirements(args[0])
+		if err != nil {
+			end(err)
+		}
+		fmt.Println(text)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(requirementsCmd)
+
+	requirementsCmd.Flags().StringVar(&compiledRequirements, "compile", "", "Compile requirements and print them back instead of reading a file")
+}
@@ -4,10 +4,14 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"runtime"
+	"strings"
 
 	"github.com/e-n-0/sign-app-cli/codesigning"
+	"github.com/e-n-0/sign-app-cli/macho"
 	"github.com/e-n-0/sign-app-cli/provisioningprofiles"
 	"github.com/e-n-0/sign-app-cli/sign"
 	"github.com/e-n-0/sign-app-cli/utils"
@@ -17,12 +21,64 @@ import (
 var (
 	provisioningProfileName string
 	provisioningProfilePath string
+	childProfiles           []string
 	codesigningCertName     string
 
 	inputFile  string
 	outputFile string
+	inPlace    bool
+	plan       string
+	reportFile string
+
+	incremental bool
+	signJobs    int
+
+	variants []string
+
+	includeSymbols bool
 
 	entitlementsFile string
+	iconFile         string
+
+	overlayFolder string
+	injections    []string
+	removePaths   []string
+
+	stripComponents []string
+
+	signerBackend string
+
+	adhoc      bool
+	pseudoSign bool
+
+	signatureFlags   []string
+	timestamp        string
+	preserveMetadata []string
+	requirements     string
+	requirementsFile string
+	optionRules      []string
+	keepSignatures   []string
+	skipPaths        []string
+
+	p12File         string
+	p12Password     string
+	certificateFile string
+	privateKeyFile  string
+	keyCommand      string
+	pkcs11Config    codesigning.PKCS11Config
+
+	setEntitlements    []string
+	deleteEntitlements []string
+
+	setPlistValues      []string
+	deletePlistKeys     []string
+	displayName         string
+	shortVersion        string
+	buildNumber         string
+	plistEditExtensions bool
+
+	localizeDisplayName   bool
+	localizedDisplayNames []string
 )
 
 // signCmd represents the sign command
@@ -31,7 +87,7 @@ var signCmd = &cobra.Command{
 	Short: "Sign the provided file",
 	Long: `
 Sign the provided file with the provided provisioning profile and codesigning certificate.
-The file can be an .ipa or a .app.
+The file can be an .ipa, a .app or an Xcode .xcarchive, the output can be an .ipa or a .app.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Check if the input file exists
@@ -39,56 +95,353 @@ The file can be an .ipa or a .app.
 			panic("The input file does not exist")
 		}
 
+		// Check the output file
+		if outputFile == "" && !inPlace && plan == "" && len(variants) == 0 {
+			end(fmt.Errorf("you must provide an output file or sign in place with --in-place"))
+		}
+		if signJobs < 1 {
+			end(fmt.Errorf("invalid number of jobs: %d", signJobs))
+		}
+		if plan != "" && plan != "text" && plan != "json" {
+			end(fmt.Errorf("invalid plan format %q, expected text or json", plan))
+		}
+
 		// Check provisioning profile name
 		var provisioningProfile provisioningprofiles.ProvisioningProfile
-		if provisioningProfileName != "" {
-			// Check if the provisioning profile exists
-			p, err := provisioningprofiles.GetProfile(provisioningProfileName)
+		if adhoc || pseudoSign {
+			// Ad-hoc signatures embed no provisioning profile
+		} else if len(variants) > 0 && provisioningProfileName == "" && provisioningProfilePath == "" {
+			// Each variant gives its provisioning profile
+		} else {
+			p, err := loadProfile(provisioningProfileName, provisioningProfilePath)
 			if err != nil {
 				end(err)
 			}
 			provisioningProfile = p
-		} else if provisioningProfilePath != "" {
-			// Check if the provisioning profile exists
-			if !utils.FileExists(provisioningProfilePath) {
-				end(fmt.Errorf("the provisioning profile does not exist"))
-			}
+		}
 
-			p, err := provisioningprofiles.CreateProvisioningProfile(provisioningProfilePath)
+		var children []sign.ChildProfile
+		for _, value := range childProfiles {
+			childProfile, err := sign.ParseChildProfile(value)
 			if err != nil {
 				end(err)
 			}
+			children = append(children, childProfile)
+		}
 
-			provisioningProfile = p
-		} else {
-			end(fmt.Errorf("you must provide a provisioning profile"))
+		// Load the identity from files when given
+		var signerConfig sign.SignerConfig
+		source := identitySource{
+			P12File:         p12File,
+			P12Password:     p12Password,
+			CertificateFile: certificateFile,
+			PrivateKeyFile:  privateKeyFile,
+			KeyCommand:      keyCommand,
+			PKCS11:          pkcs11Config,
+		}
+		identity, err := source.load()
+		if err != nil {
+			end(err)
 		}
+		signerConfig.Identity = identity
 
-		// Check if the codesigning certificate exists
-		codesignCert, err := codesigning.GetCodesigningCert(codesigningCertName)
+		signerConfig.Adhoc = adhoc || pseudoSign
+		signerConfig.P12File = p12File
+		signerConfig.P12Password = p12Password
+
+		// codesign cannot pseudo-sign, the native backend is used unless another one is chosen
+		if pseudoSign && !cmd.Flags().Changed("backend") && signerBackend == "codesign" {
+			signerBackend = "native"
+		}
+
+		// Create the signer backend
+		signer, err := sign.NewSigner(signerBackend, signerConfig)
 		if err != nil {
 			end(err)
 		}
 
+		// Check if the codesigning certificate exists
+		var codesignCert string
+		if adhoc || pseudoSign {
+			codesignCert = sign.AdhocIdentity
+		} else if signerConfig.Identity != nil {
+			codesignCert = codesigning.IdentityName(*signerConfig.Identity)
+		} else if codesigningCertName == "" {
+			// Each variant may give its certificate
+			if len(variants) == 0 {
+				end(fmt.Errorf("you must provide a codesigning certificate"))
+			}
+		} else {
+			codesignCert, err = codesigning.GetCodesigningCert(codesigningCertName)
+			if err != nil {
+				end(err)
+			}
+		}
+
 		// Check if the entitlements file exists
 		if entitlementsFile != "" && !utils.FileExists(entitlementsFile) {
 			end(fmt.Errorf("the entitlements file does not exist"))
 		}
 
-		err = sign.Sign(sign.SignerParams{
-			ProvisioninngProfile: provisioningProfile,
-			CodesignCertificate:  codesignCert,
-			InputFile:            inputFile,
-			OutputFile:           outputFile,
-			EntitlementsFile:     entitlementsFile,
-		})
+		// Check if the icon file exists
+		if iconFile != "" && !utils.FileExists(iconFile) {
+			end(fmt.Errorf("the icon file does not exist"))
+		}
+
+		// Check the resource changes
+		if overlayFolder != "" && !utils.IsFolder(overlayFolder) {
+			end(fmt.Errorf("the overlay folder does not exist"))
+		}
+
+		var injectedFiles []sign.Injection
+		for _, value := range injections {
+			injection, err := sign.ParseInjection(value)
+			if err != nil {
+				end(err)
+			}
+			if !utils.FileExists(injection.Source) {
+				end(fmt.Errorf("the injected file %s does not exist", injection.Source))
+			}
+			injectedFiles = append(injectedFiles, injection)
+		}
+
+		// Check the signing options
+		if requirementsFile != "" {
+			data, err := os.ReadFile(requirementsFile)
+			if err != nil {
+				end(fmt.Errorf("failed to read the requirements file: %s", err))
+			}
+			requirements = string(data)
+		}
+
+		signOptions := sign.SignOptions{Flags: signatureFlags, Timestamp: timestamp, PreserveMetadata: preserveMetadata, Requirements: requirements}
+		if err := signOptions.Validate(); err != nil {
+			end(err)
+		}
+
+		var rules []sign.OptionRule
+		for _, value := range optionRules {
+			rule, err := sign.ParseOptionRule(value)
+			if err != nil {
+				end(err)
+			}
+			rules = append(rules, rule)
+		}
+
+		// Collect the Info.plist edits
+		plistEdits, err := parsePlistEdits()
+		if err != nil {
+			end(err)
+		}
 
+		// Collect the entitlement edits
+		entitlementEdits, err := parseKeyEdits(setEntitlements, deleteEntitlements)
+		if err != nil {
+			end(err)
+		}
+
+		// Collect the localized display names
+		displayNames, err := parseLocalizedDisplayNames()
+		if err != nil {
+			end(err)
+		}
+
+		params := sign.SignerParams{
+			Signer:                signer,
+			ProvisioninngProfile:  provisioningProfile,
+			ChildProfiles:         children,
+			CodesignCertificate:   codesignCert,
+			InputFile:             inputFile,
+			OutputFile:            outputFile,
+			EntitlementsFile:      entitlementsFile,
+			PlistEdits:            plistEdits,
+			PlistEditExtensions:   plistEditExtensions,
+			EntitlementEdits:      entitlementEdits,
+			LocalizedDisplayNames: displayNames,
+			IconFile:              iconFile,
+			OverlayFolder:         overlayFolder,
+			Injections:            injectedFiles,
+			RemovePaths:           removePaths,
+			StripComponents:       stripComponents,
+			InPlace:               inPlace,
+			Adhoc:                 adhoc,
+			PseudoSign:            pseudoSign,
+			IncludeSymbols:        includeSymbols,
+			SignatureFlags:        signatureFlags,
+			Timestamp:             timestamp,
+			PreserveMetadata:      preserveMetadata,
+			Requirements:          requirements,
+			OptionRules:           rules,
+			KeepSignatures:        keepSignatures,
+			SkipPaths:             skipPaths,
+			ReportFile:            reportFile,
+			Incremental:           incremental,
+			Jobs:                  signJobs,
+		}
+
+		if plan != "" {
+			printPlan(params)
+			return
+		}
+
+		if len(variants) > 0 {
+			profile := provisioningProfilePath
+			if provisioningProfileName != "" {
+				profile = provisioningProfileName
+			}
+			signVariants(params, batchJob{
+				Backend:        signerBackend,
+				Certificate:    codesigningCertName,
+				identitySource: source,
+				Adhoc:          adhoc,
+				Profile:        profile,
+			}, variants)
+			return
+		}
+
+		err = sign.Sign(params)
 		if err != nil {
 			panic(err)
 		}
 	},
 }
 
+// Print the signing plan without signing
+func printPlan(params sign.SignerParams) {
+	// The progress messages go to stderr so the JSON plan can be piped
+	if plan == "json" {
+		params.Output = os.Stderr
+	}
+
+	signingPlan, err := sign.PlanSigning(params)
+	if err != nil {
+		end(err)
+	}
+
+	if plan == "json" {
+		data, err := json.MarshalIndent(signingPlan, "", "  ")
+		if err != nil {
+			end(fmt.Errorf("failed to encode the plan: %s", err))
+		}
+		fmt.Println(string(data))
+		return
+	}
+	signingPlan.Print(os.Stdout)
+}
+
+// Load a provisioning profile installed on the machine by name, or from a file
+func loadProfile(name string, path string) (provisioningprofiles.ProvisioningProfile, error) {
+	if name != "" {
+		return provisioningprofiles.GetProfile(name)
+	}
+	if path == "" {
+		return provisioningprofiles.ProvisioningProfile{}, fmt.Errorf("you must provide a provisioning profile")
+	}
+
+	// Check if the provisioning profile exists
+	if !utils.FileExists(path) {
+		return provisioningprofiles.ProvisioningProfile{}, fmt.Errorf("the provisioning profile %s does not exist", path)
+	}
+	return provisioningprofiles.CreateProvisioningProfile(path)
+}
+
+// Files and commands giving the certificate and the private key of the identity
+type identitySource struct {
+	P12File         string                   `yaml:"p12"`
+	P12Password     string                   `yaml:"p12-password"`
+	CertificateFile string                   `yaml:"cert-file"`
+	PrivateKeyFile  string                   `yaml:"key-file"`
+	KeyCommand      string                   `yaml:"key-command"`
+	PKCS11          codesigning.PKCS11Config `yaml:"pkcs11"`
+}
+
+// Load the identity, nil when it is not given by files (keychain identities)
+func (source identitySource) load() (*macho.Identity, error) {
+	var identity macho.Identity
+	var err error
+	switch {
+	case source.P12File != "":
+		identity, err = codesigning.LoadIdentityFromP12(source.P12File, source.P12Password)
+	case source.CertificateFile != "":
+		// The private key is read from a file, used through a command or held by a PKCS#11 token
+		switch {
+		case source.PrivateKeyFile != "":
+			identity, err = codesigning.LoadIdentityFromFiles(source.CertificateFile, source.PrivateKeyFile)
+		case source.KeyCommand != "":
+			identity, err = codesigning.LoadIdentityWithCommand(source.CertificateFile, source.KeyCommand)
+		case source.PKCS11.Module != "":
+			identity, err = codesigning.LoadIdentityFromPKCS11(source.CertificateFile, source.PKCS11)
+		default:
+			err = fmt.Errorf("the certificate file requires its private key: --key-file, --key-command or --pkcs11-module")
+		}
+	case source.PrivateKeyFile != "" || source.KeyCommand != "" || source.PKCS11.Module != "":
+		err = fmt.Errorf("the private key requires its certificate: --cert-file")
+	default:
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
+
+func parsePlistEdits() ([]sign.PlistEdit, error) {
+	edits, err := parseKeyEdits(setPlistValues, deletePlistKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	if displayName != "" {
+		edits = append(edits, sign.PlistEdit{KeyPath: "CFBundleDisplayName", Value: displayName})
+	}
+	if shortVersion != "" {
+		edits = append(edits, sign.PlistEdit{KeyPath: "CFBundleShortVersionString", Value: shortVersion})
+	}
+	if buildNumber != "" {
+		edits = append(edits, sign.PlistEdit{KeyPath: "CFBundleVersion", Value: buildNumber})
+	}
+
+	return edits, nil
+}
+
+// Parse the key=value arguments setting values and the keys to delete
+func parseKeyEdits(setValues []string, deleteKeys []string) ([]sign.PlistEdit, error) {
+	var edits []sign.PlistEdit
+	for _, value := range setValues {
+		edit, err := sign.ParseSetPlistEdit(value)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, edit)
+	}
+
+	for _, key := range deleteKeys {
+		edits = append(edits, sign.PlistEdit{KeyPath: key, Delete: true})
+	}
+	return edits, nil
+}
+
+func parseLocalizedDisplayNames() (map[string]string, error) {
+	names := map[string]string{}
+	if localizeDisplayName {
+		if displayName == "" {
+			return nil, fmt.Errorf("--localize-display-name requires --display-name")
+		}
+		names["*"] = displayName
+	}
+
+	for _, value := range localizedDisplayNames {
+		index := strings.Index(value, "=")
+		if index <= 0 {
+			return nil, fmt.Errorf("invalid localized display name %q, expected locale=name", value)
+		}
+		names[value[:index]] = value[index+1:]
+	}
+
+	return names, nil
+}
+
 func end(err error) {
 	fmt.Println("error:", err)
 	os.Exit(1)
@@ -100,19 +453,77 @@ func init() {
 	// Add cobra command
 	signCmd.Flags().StringVarP(&provisioningProfileName, "profile", "p", "", "The name of the provisioning profile to use installed on the machine (list with 'sign-app-cli listProvisioningProfiles')")
 	signCmd.Flags().StringVarP(&provisioningProfilePath, "profilePath", "P", "", "The path of the provisioning profile to use")
+	signCmd.Flags().StringArrayVar(&childProfiles, "child-profile", nil, "The provisioning profile of a watch app, watch extension or app clip (pattern=path, pattern is the path relative to the app or the bundle identifier)")
 	signCmd.Flags().StringVarP(&codesigningCertName, "certificate", "c", "", "The name of the codesigning certificate to use installed on the machine (list with 'sign-app-cli listCodesigningCerts')")
 	signCmd.Flags().StringVarP(&inputFile, "input", "i", "", "The path of the file to sign")
-	signCmd.Flags().StringVarP(&outputFile, "output", "o", "", "The path of the signed file")
+	signCmd.Flags().StringVarP(&outputFile, "output", "o", "", "The path of the signed file (.ipa or .app)")
+	signCmd.Flags().BoolVar(&inPlace, "in-place", false, "Sign the input file in place instead of writing an output file")
+	signCmd.Flags().StringVar(&plan, "plan", "", "Print the signing plan without signing: the items in signing order with their identity, profile, entitlements, options and changed files ('json' for a JSON plan)")
+	signCmd.Flag("plan").NoOptDefVal = "text"
+	signCmd.Flags().StringVar(&reportFile, "report", "", "Write a JSON report of the signed items (identifiers, CDHashes, certificate, profile, entitlements) and of the input and output hashes")
+	signCmd.Flags().StringArrayVar(&variants, "variant", nil, "Sign a variant of the input, the input is extracted once and the variants are signed in parallel (name:key=value,..., keys: "+strings.Join(variantKeys, ", ")+"; the other settings are those of the sign flags, the output defaults to the --output file suffixed with the name)")
+	signCmd.Flags().BoolVar(&includeSymbols, "include-symbols", false, "Add the symbols of the archive dSYMs to the exported ipa (.xcarchive input, requires Xcode)")
 	signCmd.Flags().StringVarP(&entitlementsFile, "entitlements", "e", "", "The path of the entitlements file to use")
 
+	signCmd.Flags().StringVar(&signerBackend, "backend", sign.DefaultSignerBackend(), "The signing backend to use: "+strings.Join(sign.SignerBackends(), ", ")+" (ldid when codesign is not installed)")
+	signCmd.Flags().BoolVar(&adhoc, "adhoc", false, "Sign ad-hoc (identity '-') with the --entitlements file, without certificate nor provisioning profile")
+	signCmd.Flags().BoolVar(&pseudoSign, "pseudo-sign", false, "Pseudo-sign like 'ldid -S': only embed the entitlements and the code hashes (native or ldid backend)")
+	signCmd.Flags().StringSliceVar(&signatureFlags, "options", nil, "Code signing options: "+strings.Join(sign.SignatureFlags(), ", ")+" (runtime enables the hardened runtime)")
+	signCmd.Flags().StringVar(&timestamp, "timestamp", "", "Timestamp the signatures, with the default server or the given URL ('none' disables the timestamp)")
+	signCmd.Flag("timestamp").NoOptDefVal = sign.TimestampDefault
+	signCmd.Flags().StringSliceVar(&preserveMetadata, "preserve-metadata", nil, "Keep parts of the existing signatures: "+strings.Join(sign.PreservableMetadata(), ", "))
+	signCmd.Flags().StringVar(&requirements, "requirements", "", "Requirements of the signatures in the requirement language (for example 'designated => anchor apple generic and certificate leaf[subject.OU] = XXXXXXXXXX')")
+	signCmd.Flags().StringVar(&requirementsFile, "requirements-file", "", "The path of a file with the requirements of the signatures in the requirement language")
+	signCmd.Flags().StringArrayVar(&optionRules, "option-rule", nil, "Override a signing option for the items matching a glob relative to the app (pattern:key=value, keys: options, timestamp, preserve-metadata, identity, entitlements, requirements)")
+	signCmd.Flags().StringArrayVar(&keepSignatures, "keep-signature", nil, "Keep the signature of the items matching a glob relative to the app, it is checked before the enclosing bundle is signed")
+	signCmd.Flags().BoolVar(&incremental, "incremental", false, "Do not sign again the nested items already signed with the same identity and entitlements, their enclosing bundles are still sealed")
+	signCmd.Flags().IntVar(&signJobs, "jobs", runtime.NumCPU(), "The maximum number of nested items (frameworks, dylibs, extensions) signed at the same time, a bundle is signed once its content is signed")
+	signCmd.Flags().StringArrayVar(&skipPaths, "skip", nil, "Do not sign the items matching a glob relative to the app")
+	signCmd.Flags().StringVar(&p12File, "p12", "", "The path of a PKCS#12 file with the certificate and private key to sign with (native and ldid backends)")
+	signCmd.Flags().StringVar(&p12Password, "p12-password", "", "The password of the PKCS#12 file")
+	signCmd.Flags().StringVar(&certificateFile, "cert-file", "", "The path of the certificate to sign with, PEM or DER (native backend)")
+	signCmd.Flags().StringVar(&privateKeyFile, "key-file", "", "The path of the PEM private key of the certificate (native backend)")
+	signCmd.Flags().StringVar(&keyCommand, "key-command", "", "A shell command signing with the private key of the certificate: digest on stdin, signature on stdout (native backend)")
+	signCmd.Flags().StringVar(&pkcs11Config.Module, "pkcs11-module", "", "The path of the PKCS#11 module holding the private key of the certificate (native backend)")
+	signCmd.Flags().StringVar(&pkcs11Config.Token, "pkcs11-token", "", "The label of the PKCS#11 token, when the module has several tokens")
+	signCmd.Flags().StringVar(&pkcs11Config.PIN, "pkcs11-pin", "", "The PIN of the PKCS#11 token")
+	signCmd.Flags().StringVar(&pkcs11Config.KeyLabel, "pkcs11-key", "", "The label of the private key in the PKCS#11 token, when the token has several keys")
+	signCmd.Flags().StringVar(&iconFile, "icon", "", "The path of a PNG file replacing the app icon (all required sizes are generated)")
+	signCmd.Flags().StringVar(&overlayFolder, "overlay", "", "The path of a folder copied on top of the app before signing")
+	signCmd.Flags().StringArrayVar(&injections, "inject", nil, "Copy a file or folder into the app before signing (src:dest, dest is relative to the app)")
+	signCmd.Flags().StringArrayVar(&removePaths, "remove-path", nil, "Remove the files of the app matching the glob pattern before signing (relative to the app, '**' matches any folder)")
+	signCmd.Flags().StringSliceVar(&stripComponents, "strip", nil, "Remove components from the app before signing: "+strings.Join(sign.StrippableComponents(), ", ")+" or a glob pattern relative to the app")
+	signCmd.Flags().StringArrayVar(&setEntitlements, "set-entitlement", nil, "Set an entitlement of the app before signing (key=value, applied to the profile entitlements or to the --entitlements file of ad-hoc signatures)")
+	signCmd.Flags().StringArrayVar(&deleteEntitlements, "delete-entitlement", nil, "Delete an entitlement of the app before signing")
+	signCmd.Flags().StringArrayVar(&setPlistValues, "set-plist", nil, "Set an Info.plist value before signing (key=value or key:type=value with the types string, bool, int and real, nested keys like 'CFBundleURLTypes.0.CFBundleURLSchemes.0' are supported)")
+	signCmd.Flags().StringArrayVar(&deletePlistKeys, "delete-plist", nil, "Delete an Info.plist key before signing")
+	signCmd.Flags().StringVar(&displayName, "display-name", "", "Change the display name of the app (CFBundleDisplayName)")
+	signCmd.Flags().StringVar(&shortVersion, "short-version", "", "Change the version of the app (CFBundleShortVersionString)")
+	signCmd.Flags().StringVar(&buildNumber, "build-number", "", "Change the build number of the app (CFBundleVersion)")
+	signCmd.Flags().BoolVar(&localizeDisplayName, "localize-display-name", false, "Also write the --display-name to every localized InfoPlist.strings file")
+	signCmd.Flags().StringArrayVar(&localizedDisplayNames, "localized-display-name", nil, "Set the display name for a single locale (locale=name, e.g. 'fr=Mon App')")
+	signCmd.Flags().BoolVar(&plistEditExtensions, "plist-extensions", false, "Also apply the Info.plist edits to the app extensions")
+
 	signCmd.MarkFlagFilename("profilePath")
 	signCmd.MarkFlagFilename("input")
 	signCmd.MarkFlagFilename("output")
 	signCmd.MarkFlagFilename("entitlements")
+	signCmd.MarkFlagFilename("report", "json")
+	signCmd.MarkFlagFilename("icon", "png")
+	signCmd.MarkFlagFilename("p12", "p12")
+	signCmd.MarkFlagFilename("cert-file")
+	signCmd.MarkFlagFilename("key-file")
+	signCmd.MarkFlagDirname("overlay")
 
-	signCmd.MarkFlagRequired("certificate")
 	signCmd.MarkFlagRequired("input")
-	signCmd.MarkFlagRequired("output")
 
 	signCmd.MarkFlagsMutuallyExclusive("profile", "profilePath")
+	signCmd.MarkFlagsMutuallyExclusive("output", "in-place")
+	signCmd.MarkFlagsMutuallyExclusive("variant", "in-place")
+	signCmd.MarkFlagsMutuallyExclusive("variant", "plan")
+	signCmd.MarkFlagsMutuallyExclusive("variant", "pseudo-sign")
+	signCmd.MarkFlagsMutuallyExclusive("adhoc", "pseudo-sign")
+	signCmd.MarkFlagsMutuallyExclusive("requirements", "requirements-file")
+	signCmd.MarkFlagsMutuallyExclusive("p12", "cert-file")
+	signCmd.MarkFlagsMutuallyExclusive("key-file", "key-command", "pkcs11-module")
 }
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/e-n-0/sign-app-cli/provisioningprofiles"
+	"github.com/e-n-0/sign-app-cli/sign"
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// Settings of the --variant flags
+var variantKeys = []string{"output", "profile", "certificate", "bundle-id", "adhoc", "backend", "p12", "p12-password", "cert-file", "key-file", "key-command"}
+
+// Parse a variant given as name:key=value,... into a job with the settings of the variant
+// A variant given by its name only has the settings of the sign flags
+func parseVariant(arg string) (batchJob, error) {
+	name, settings, _ := strings.Cut(arg, ":")
+	if name == "" {
+		return batchJob{}, fmt.Errorf("invalid variant %q, expected name:key=value,...", arg)
+	}
+
+	job := batchJob{Name: name}
+	for _, setting := range strings.Split(settings, ",") {
+		if setting == "" {
+			continue
+		}
+		key, value, found := strings.Cut(setting, "=")
+		if !utils.StringInSlice(key, variantKeys) {
+			return batchJob{}, fmt.Errorf("unknown key %q in the variant %q, expected one of: %s", key, arg, strings.Join(variantKeys, ", "))
+		}
+		if !found && key != "adhoc" {
+			return batchJob{}, fmt.Errorf("invalid variant %q: %s requires a value", arg, key)
+		}
+
+		switch key {
+		case "output":
+			job.Output = value
+		case "profile":
+			job.Profile = value
+		case "certificate":
+			job.Certificate = value
+		case "bundle-id":
+			job.BundleID = value
+		case "adhoc":
+			adhoc := true
+			if found {
+				var err error
+				adhoc, err = strconv.ParseBool(value)
+				if err != nil {
+					return batchJob{}, fmt.Errorf("invalid variant %q: adhoc must be true or false", arg)
+				}
+			}
+			job.Adhoc = adhoc
+		case "backend":
+			job.Backend = value
+		case "p12":
+			job.P12File = value
+		case "p12-password":
+			job.P12Password = value
+		case "cert-file":
+			job.CertificateFile = value
+		case "key-file":
+			job.PrivateKeyFile = value
+		case "key-command":
+			job.KeyCommand = value
+		}
+	}
+	return job, nil
+}
+
+// Return the output of a variant without output: the output file with the variant name appended
+func variantFile(path string, name string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + name + ext
+}
+
+// Build the variants of the input, the settings they do not give are those of params and of the sign flags
+func buildVariants(params sign.SignerParams, defaults batchJob, specs []string) ([]sign.Variant, error) {
+	resources := newBatchResources("")
+
+	// The profile and identity given to the sign command are already loaded
+	if defaults.Profile != "" {
+		resources.profiles[defaults.Profile] = params.ProvisioninngProfile
+	}
+	if defaults.identitySource != (identitySource{}) {
+		if native, ok := params.Signer.(sign.NativeSigner); ok {
+			resources.identities[defaults.identitySource] = native.Identity
+		}
+	}
+
+	var variants []sign.Variant
+	for _, spec := range specs {
+		job, err := parseVariant(spec)
+		if err != nil {
+			return nil, err
+		}
+		if job.Output == "" {
+			job.Output = variantFile(params.OutputFile, job.Name)
+		}
+		if job.Output == "" {
+			return nil, fmt.Errorf("the variant %s has no output file, give --output or output=", job.Name)
+		}
+		job.Input = params.InputFile
+		job = job.withDefaults(defaults)
+
+		variantParams, err := resources.params(job)
+		if err != nil {
+			return nil, fmt.Errorf("invalid variant %s: %s", job.Name, err)
+		}
+
+		// The variant changes the identity, the profile, the output and the bundle identifier
+		variant := params
+		variant.Signer = variantParams.Signer
+		variant.ProvisioninngProfile = variantParams.ProvisioninngProfile
+		variant.CodesignCertificate = variantParams.CodesignCertificate
+		variant.Adhoc = variantParams.Adhoc
+		variant.OutputFile = variantParams.OutputFile
+		variant.BundleIdentifier = variantParams.BundleIdentifier
+		if variant.Adhoc {
+			variant.ProvisioninngProfile = provisioningprofiles.ProvisioningProfile{}
+			variant.ChildProfiles = nil
+		}
+		variant.ReportFile = variantFile(params.ReportFile, job.Name)
+
+		variants = append(variants, sign.Variant{Name: job.Name, Params: variant})
+	}
+	return variants, nil
+}
+
+// Sign the variants of the input and print a summary of the results
+func signVariants(params sign.SignerParams, defaults batchJob, specs []string) {
+	variants, err := buildVariants(params, defaults, specs)
+	if err != nil {
+		end(err)
+	}
+
+	results, err := sign.SignVariants(params, variants)
+	if err != nil {
+		end(err)
+	}
+
+	fmt.Println()
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "VARIANT\tSTATUS\tTIME\tOUTPUT")
+	failed := 0
+	for _, result := range results {
+		status := "ok"
+		output := result.OutputFile
+		if result.Err != nil {
+			status = "FAILED"
+			output = result.Err.Error()
+			failed++
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", result.Name, status, result.Duration.Round(time.Millisecond), output)
+	}
+	writer.Flush()
+
+	if failed > 0 {
+		fmt.Printf("\033[31m%d of %d variant%s failed\033[0m\n", failed, len(results), utils.Plural(len(results)))
+		os.Exit(1)
+	}
+	fmt.Println("\033[32m" + "All the variants were signed" + "\033[0m")
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/e-n-0/sign-app-cli/provisioningprofiles"
+	"github.com/e-n-0/sign-app-cli/sign"
+)
+
+func TestParseVariant(t *testing.T) {
+	tests := []struct {
+		arg      string
+		expected batchJob
+		err      string
+	}{
+		{"development", batchJob{Name: "development"}, ""},
+		{"adhoc:adhoc", batchJob{Name: "adhoc", Adhoc: true}, ""},
+		{"store:adhoc=false,backend=native", batchJob{Name: "store", Backend: "native"}, ""},
+		{"beta:bundle-id=com.example.beta,profile=./Beta.mobileprovision,output=beta.ipa", batchJob{
+			Name:     "beta",
+			BundleID: "com.example.beta",
+			Profile:  "./Beta.mobileprovision",
+			Output:   "beta.ipa",
+		}, ""},
+		{"files:cert-file=cert.pem,key-file=key.pem", batchJob{Name: "files", identitySource: identitySource{CertificateFile: "cert.pem", PrivateKeyFile: "key.pem"}}, ""},
+		{":adhoc", batchJob{}, "expected name:key=value"},
+		{"beta:bundle=com.example", batchJob{}, "unknown key"},
+		{"beta:profile", batchJob{}, "requires a value"},
+		{"beta:adhoc=maybe", batchJob{}, "adhoc must be true or false"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.arg, func(t *testing.T) {
+			job, err := parseVariant(test.arg)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(job, test.expected) {
+				t.Errorf("job %+v, expected %+v", job, test.expected)
+			}
+		})
+	}
+}
+
+func TestVariantFile(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"signed/MyApp.ipa", "signed/MyApp-beta.ipa"},
+		{"signed/MyApp.app", "signed/MyApp-beta.app"},
+		{"report.json", "report-beta.json"},
+		{"signed/MyApp", "signed/MyApp-beta"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if file := variantFile(test.path, "beta"); file != test.expected {
+			t.Errorf("variant file of %q: %q, expected %q", test.path, file, test.expected)
+		}
+	}
+}
+
+func TestBuildVariants(t *testing.T) {
+	folder := t.TempDir()
+	writeTestFile(t, filepath.Join(folder, "App.ipa"), []byte("ipa"))
+	writeTestIdentity(t, filepath.Join(folder, "cert.pem"), filepath.Join(folder, "key.pem"), "Apple Development: Jane Doe (TEAM123456)")
+	writeTestProfile(t, filepath.Join(folder, "dev.mobileprovision"), "Development", "com.example.app")
+	writeTestProfile(t, filepath.Join(folder, "beta.mobileprovision"), "Beta", "com.example.beta")
+
+	defaults := batchJob{
+		Backend:        "native",
+		identitySource: identitySource{CertificateFile: filepath.Join(folder, "cert.pem"), PrivateKeyFile: filepath.Join(folder, "key.pem")},
+		Profile:        filepath.Join(folder, "dev.mobileprovision"),
+	}
+	// The profile of the sign command is already loaded
+	base := sign.SignerParams{
+		InputFile:            filepath.Join(folder, "App.ipa"),
+		OutputFile:           filepath.Join(folder, "signed", "App.ipa"),
+		ReportFile:           filepath.Join(folder, "report.json"),
+		PlistEdits:           []sign.PlistEdit{{KeyPath: "CFBundleDisplayName", Value: "App"}},
+		ProvisioninngProfile: provisioningprofiles.ProvisioningProfile{Name: "Development"},
+	}
+
+	variants, err := buildVariants(base, defaults, []string{
+		"development",
+		"adhoc:adhoc",
+		"beta:bundle-id=com.example.beta,profile=" + filepath.Join(folder, "beta.mobileprovision") + ",output=" + filepath.Join(folder, "beta.ipa"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name             string
+		outputFile       string
+		reportFile       string
+		profile          string
+		bundleIdentifier string
+		adhoc            bool
+	}{
+		{"development", filepath.Join(folder, "signed", "App-development.ipa"), filepath.Join(folder, "report-development.json"), "Development", "", false},
+		{"adhoc", filepath.Join(folder, "signed", "App-adhoc.ipa"), filepath.Join(folder, "report-adhoc.json"), "", "", true},
+		{"beta", filepath.Join(folder, "beta.ipa"), filepath.Join(folder, "report-beta.json"), "Beta", "com.example.beta", false},
+	}
+	if len(variants) != len(tests) {
+		t.Fatalf("%d variants", len(variants))
+	}
+	for i, test := range tests {
+		params := variants[i].Params
+		if variants[i].Name != test.name {
+			t.Errorf("variant %d named %s, expected %s", i, variants[i].Name, test.name)
+		}
+		if params.OutputFile != test.outputFile || params.ReportFile != test.reportFile {
+			t.Errorf("%s: files %s and %s", test.name, params.OutputFile, params.ReportFile)
+		}
+		if params.ProvisioninngProfile.Name != test.profile {
+			t.Errorf("%s: profile %q, expected %q", test.name, params.ProvisioninngProfile.Name, test.profile)
+		}
+		if params.BundleIdentifier != test.bundleIdentifier {
+			t.Errorf("%s: bundle identifier %q", test.name, params.BundleIdentifier)
+		}
+		if params.Adhoc != test.adhoc {
+			t.Errorf("%s: adhoc %v", test.name, params.Adhoc)
+		}
+		if !reflect.DeepEqual(params.PlistEdits, base.PlistEdits) {
+			t.Errorf("%s: plist edits %v", test.name, params.PlistEdits)
+		}
+	}
+
+	if _, err := buildVariants(sign.SignerParams{InputFile: base.InputFile}, defaults, []string{"beta"}); err == nil || !strings.Contains(err.Error(), "has no output file") {
+		t.Errorf("variant without output: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/e-n-0/sign-app-cli/sign"
+	"github.com/spf13/cobra"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify <ipa|app>",
+	Short: "Verify the signatures of a signed ipa or app",
+	Long: `
+This command checks every signature of a signed ipa or app without codesign:
+the code hashes against the file contents, the sealed resources against the files,
+and the embedded provisioning profile against the certificate, the bundle identifier and the entitlements.
+For example:
+$ sign-app-cli verify ./MyApp.ipa`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		result, appName, err := sign.Verify(args[0], os.Stdout)
+		if err != nil {
+			end(err)
+		}
+
+		result.Print(os.Stdout, appName)
+		if failure := result.FirstFailure(); failure != nil {
+			path := failure.Path
+			if path == "." {
+				path = appName
+			}
+			fmt.Printf("\033[31mThe signature of %s is invalid: %s\033[0m\n", path, failure.Err)
+			os.Exit(1)
+		}
+		fmt.Println("\033[32m" + "All the signatures are valid" + "\033[0m")
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
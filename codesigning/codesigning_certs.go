@@ -48,6 +48,33 @@ func GetCodesigningCerts() ([]string, error) {
 	return output, nil
 }
 
+// Return the SHA-1 hashes of the codesigning identities installed on the machine whose name contains name,
+// as codesign resolves its -s argument
+func GetCodesigningCertHashes(name string) ([]string, error) {
+	bytes, status, err := utils.ExecuteProcess("/usr/bin/security", "find-identity", "-v", "-p", "codesigning")
+	if err != nil || status != 0 {
+		if err == nil {
+			err = fmt.Errorf("failed to get codesigning certificates")
+		}
+		return nil, err
+	}
+
+	// Lines of the identities: 1) <SHA-1> "<name>"
+	var hashes []string
+	for _, line := range strings.Split(string(bytes), "\n") {
+		fields := strings.Fields(line)
+		start := strings.Index(line, "\"")
+		end := strings.LastIndex(line, "\"")
+		if len(fields) < 3 || start < 0 || end <= start {
+			continue
+		}
+		if strings.Contains(line[start+1:end], name) {
+			hashes = append(hashes, strings.ToUpper(fields[1]))
+		}
+	}
+	return hashes, nil
+}
+
 func PrintCodesigningCerts(certs []string) {
 	if len(certs) == 0 {
 		fmt.Println("No codesigning certificates found.")
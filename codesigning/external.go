@@ -0,0 +1,91 @@
+package codesigning
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+)
+
+// Names of the digest algorithms given to the signer commands
+var digestAlgorithmNames = map[crypto.Hash]string{
+	crypto.SHA1:   "sha1",
+	crypto.SHA256: "sha256",
+	crypto.SHA384: "sha384",
+	crypto.SHA512: "sha512",
+}
+
+// Private key held by an external command
+// The command reads the digest on its standard input and writes the signature on its standard output:
+// a PKCS#1 v1.5 signature for RSA keys, an ASN.1 signature for ECDSA keys
+// The digest algorithm is given in the SIGN_DIGEST_ALGORITHM environment variable
+type commandSigner struct {
+	command string
+	public  crypto.PublicKey
+}
+
+func (signer commandSigner) Public() crypto.PublicKey {
+	return signer.public
+}
+
+func (signer commandSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	algorithm, ok := digestAlgorithmNames[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported digest algorithm %s for the signer command", opts.HashFunc())
+	}
+
+	var stdout, stderr bytes.Buffer
+	process := exec.Command("sh", "-c", signer.command)
+	process.Env = append(os.Environ(), "SIGN_DIGEST_ALGORITHM="+algorithm)
+	process.Stdin = bytes.NewReader(digest)
+	process.Stdout = &stdout
+	process.Stderr = &stderr
+
+	if err := process.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return nil, fmt.Errorf("the signer command failed: %s", message)
+	}
+
+	// Check the signature so a wrong key is reported before the app is signed
+	signature := stdout.Bytes()
+	if err := verifyDigestSignature(signer.public, digest, signature, opts.HashFunc()); err != nil {
+		return nil, fmt.Errorf("the signer command returned an invalid signature: %s", err)
+	}
+	return signature, nil
+}
+
+// Check a signature made by a private key for the certificate public key
+func verifyDigestSignature(public crypto.PublicKey, digest []byte, signature []byte, hash crypto.Hash) error {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest, signature) {
+			return fmt.Errorf("ECDSA verification failure")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", public)
+	}
+}
+
+// Load a signing identity from a certificate file whose private key is used through a command
+func LoadIdentityWithCommand(certificatePath string, command string) (macho.Identity, error) {
+	certificates, err := readCertificates(certificatePath)
+	if err != nil {
+		return macho.Identity{}, err
+	}
+
+	key := commandSigner{command: command, public: certificates[0].PublicKey}
+	return macho.Identity{Certificate: certificates[0], Chain: certificates[1:], Key: key}, nil
+}
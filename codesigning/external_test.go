@@ -0,0 +1,159 @@
+package codesigning
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Signer command run by the tests: this test binary signing the digest of its standard input
+// with the PEM private key of SIGN_TEST_KEY
+func TestHelperSignerCommand(t *testing.T) {
+	if os.Getenv("SIGN_TEST_HELPER") != "1" {
+		return
+	}
+
+	hashes := map[string]crypto.Hash{"sha1": crypto.SHA1, "sha256": crypto.SHA256}
+	digest, _ := io.ReadAll(os.Stdin)
+	data, err := os.ReadFile(os.Getenv("SIGN_TEST_KEY"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "no key")
+		os.Exit(1)
+	}
+	block, _ := pem.Decode(data)
+	key, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	signature, err := key.Sign(rand.Reader, digest, hashes[os.Getenv("SIGN_DIGEST_ALGORITHM")])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(signature)
+	os.Exit(0)
+}
+
+// Write a self-signed certificate of the key and the PEM private key
+// Return the paths of the certificate and of the key
+func writeTestKey(t *testing.T, folder string, key crypto.Signer) (string, string) {
+	t.Helper()
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Apple Distribution: Jane Doe (TEAM123456)"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyData, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificatePath := filepath.Join(folder, "cert.pem")
+	keyPath := filepath.Join(folder, "key.pem")
+	if err := os.WriteFile(certificatePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyData}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certificatePath, keyPath
+}
+
+// Command running the signer helper with the key
+func helperCommand(keyPath string) string {
+	return fmt.Sprintf("SIGN_TEST_HELPER=1 SIGN_TEST_KEY='%s' '%s' -test.run=TestHelperSignerCommand", keyPath, os.Args[0])
+}
+
+func TestCommandSigner(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha256Digest := sha256.Sum256([]byte("code directory"))
+	sha1Digest := sha1.Sum([]byte("code directory"))
+
+	tests := []struct {
+		name string
+		key  crypto.Signer
+		// Key used by the command, the key of the certificate when nil
+		commandKey crypto.Signer
+		command    string
+		hash       crypto.Hash
+		digest     []byte
+		err        string
+	}{
+		{name: "RSA SHA-256", key: rsaKey, hash: crypto.SHA256, digest: sha256Digest[:]},
+		{name: "RSA SHA-1", key: rsaKey, hash: crypto.SHA1, digest: sha1Digest[:]},
+		{name: "ECDSA SHA-256", key: ecdsaKey, hash: crypto.SHA256, digest: sha256Digest[:]},
+		{name: "other key", key: ecdsaKey, commandKey: otherKey, hash: crypto.SHA256, digest: sha256Digest[:], err: "the signer command returned an invalid signature"},
+		{name: "failing command", key: ecdsaKey, command: "echo 'token locked' >&2; exit 1", hash: crypto.SHA256, digest: sha256Digest[:], err: "the signer command failed: token locked"},
+		{name: "silent failing command", key: ecdsaKey, command: "exit 3", hash: crypto.SHA256, digest: sha256Digest[:], err: "the signer command failed: exit status 3"},
+		{name: "unsupported digest", key: ecdsaKey, hash: crypto.MD5, digest: make([]byte, 16), err: "unsupported digest algorithm"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			folder := t.TempDir()
+			certificatePath, keyPath := writeTestKey(t, folder, test.key)
+			if test.commandKey != nil {
+				_, keyPath = writeTestKey(t, t.TempDir(), test.commandKey)
+			}
+			command := test.command
+			if command == "" {
+				command = helperCommand(keyPath)
+			}
+
+			identity, err := LoadIdentityWithCommand(certificatePath, command)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if IdentityName(identity) != "Apple Distribution: Jane Doe (TEAM123456)" {
+				t.Errorf("identity %s", IdentityName(identity))
+			}
+
+			signature, err := identity.Key.Sign(rand.Reader, test.digest, test.hash)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verifyDigestSignature(test.key.Public(), test.digest, signature, test.hash); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
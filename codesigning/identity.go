@@ -0,0 +1,132 @@
+package codesigning
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Load a signing identity from a PKCS#12 (.p12) file
+func LoadIdentityFromP12(path string, password string) (macho.Identity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return macho.Identity{}, err
+	}
+
+	key, certificate, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return macho.Identity{}, fmt.Errorf("failed to decode %s: %s", path, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return macho.Identity{}, fmt.Errorf("unsupported private key in %s", path)
+	}
+
+	return macho.Identity{Certificate: certificate, Chain: chain, Key: signer}, nil
+}
+
+// Token and private key of a PKCS#11 module
+type PKCS11Config struct {
+	// Path of the PKCS#11 module (shared library)
+	Module string
+	// Label of the token, optional when the module has a single token
+	Token string
+	PIN   string
+	// Label of the private key, optional when the token has a single private key
+	KeyLabel string
+}
+
+// Load a signing identity from a certificate file (PEM or DER) and a PEM private key file
+// The certificate file may contain the intermediate certificates after the signing certificate
+func LoadIdentityFromFiles(certificatePath string, keyPath string) (macho.Identity, error) {
+	certificates, err := readCertificates(certificatePath)
+	if err != nil {
+		return macho.Identity{}, err
+	}
+
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return macho.Identity{}, err
+	}
+
+	block, _ := pem.Decode(keyData)
+	if block == nil {
+		return macho.Identity{}, fmt.Errorf("no PEM private key found in %s", keyPath)
+	}
+
+	key, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		return macho.Identity{}, fmt.Errorf("failed to parse the private key %s: %s", keyPath, err)
+	}
+
+	return macho.Identity{Certificate: certificates[0], Chain: certificates[1:], Key: key}, nil
+}
+
+// Read the certificates of a PEM or DER file
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.Contains(string(data), "-----BEGIN") {
+		certificates, err := x509.ParseCertificates(data)
+		if err != nil || len(certificates) == 0 {
+			return nil, fmt.Errorf("failed to parse the certificate %s: %v", path, err)
+		}
+		return certificates, nil
+	}
+
+	var certificates []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the certificate %s: %s", path, err)
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("no certificate found in %s", path)
+	}
+	return certificates, nil
+}
+
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+
+	return x509.ParseECPrivateKey(der)
+}
+
+// Name of the identity as shown by the keychain
+func IdentityName(identity macho.Identity) string {
+	return identity.Certificate.Subject.CommonName
+}
+
+// Team identifier of the identity (organizational unit of the certificate)
+func IdentityTeamID(identity macho.Identity) string {
+	if len(identity.Certificate.Subject.OrganizationalUnit) == 0 {
+		return ""
+	}
+	return identity.Certificate.Subject.OrganizationalUnit[0]
+}
@@ -0,0 +1,165 @@
+//go:build cgo
+
+package codesigning
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+	"github.com/miekg/pkcs11"
+)
+
+// DigestInfo prefixes of the PKCS#1 v1.5 signatures, the token only pads and encrypts
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1:   {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// Private key held by a PKCS#11 token, the session stays open while signing
+type pkcs11Signer struct {
+	mutex   sync.Mutex
+	context *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+	public  crypto.PublicKey
+}
+
+func (signer *pkcs11Signer) Public() crypto.PublicKey {
+	return signer.public
+}
+
+func (signer *pkcs11Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+
+	var mechanism uint
+	message := digest
+	switch signer.public.(type) {
+	case *rsa.PublicKey:
+		prefix, ok := digestInfoPrefixes[opts.HashFunc()]
+		if !ok {
+			return nil, fmt.Errorf("unsupported digest algorithm %s for the PKCS#11 key", opts.HashFunc())
+		}
+		mechanism = pkcs11.CKM_RSA_PKCS
+		message = append(append([]byte{}, prefix...), digest...)
+	case *ecdsa.PublicKey:
+		mechanism = pkcs11.CKM_ECDSA
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", signer.public)
+	}
+
+	if err := signer.context.SignInit(signer.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(mechanism, nil)}, signer.key); err != nil {
+		return nil, fmt.Errorf("the PKCS#11 token failed to sign: %s", err)
+	}
+	signature, err := signer.context.Sign(signer.session, message)
+	if err != nil {
+		return nil, fmt.Errorf("the PKCS#11 token failed to sign: %s", err)
+	}
+
+	// ECDSA signatures are returned as r || s
+	if _, ok := signer.public.(*ecdsa.PublicKey); ok {
+		half := len(signature) / 2
+		return asn1.Marshal(struct{ R, S *big.Int }{new(big.Int).SetBytes(signature[:half]), new(big.Int).SetBytes(signature[half:])})
+	}
+	return signature, nil
+}
+
+// Load a signing identity from a certificate file whose private key is held by a PKCS#11 token
+func LoadIdentityFromPKCS11(certificatePath string, config PKCS11Config) (macho.Identity, error) {
+	certificates, err := readCertificates(certificatePath)
+	if err != nil {
+		return macho.Identity{}, err
+	}
+
+	key, err := openPKCS11Key(config, certificates[0])
+	if err != nil {
+		return macho.Identity{}, err
+	}
+	return macho.Identity{Certificate: certificates[0], Chain: certificates[1:], Key: key}, nil
+}
+
+// Open a session on the token and find the private key
+func openPKCS11Key(config PKCS11Config, certificate *x509.Certificate) (*pkcs11Signer, error) {
+	context := pkcs11.New(config.Module)
+	if context == nil {
+		return nil, fmt.Errorf("failed to load the PKCS#11 module %s", config.Module)
+	}
+	if err := context.Initialize(); err != nil {
+		return nil, fmt.Errorf("failed to initialize the PKCS#11 module %s: %s", config.Module, err)
+	}
+
+	slot, err := findPKCS11Slot(context, config.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := context.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a session on the PKCS#11 token: %s", err)
+	}
+	if err := context.Login(session, pkcs11.CKU_USER, config.PIN); err != nil {
+		return nil, fmt.Errorf("failed to log in the PKCS#11 token: %s", err)
+	}
+
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY)}
+	if config.KeyLabel != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, config.KeyLabel))
+	}
+	if err := context.FindObjectsInit(session, template); err != nil {
+		return nil, err
+	}
+	keys, _, err := context.FindObjects(session, 2)
+	context.FindObjectsFinal(session)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(keys) == 0:
+		return nil, fmt.Errorf("no private key found in the PKCS#11 token")
+	case len(keys) > 1:
+		return nil, fmt.Errorf("several private keys found in the PKCS#11 token, select one with --pkcs11-key")
+	}
+
+	return &pkcs11Signer{context: context, session: session, key: keys[0], public: certificate.PublicKey}, nil
+}
+
+// Return the slot of the token with the label, or the only token when no label is given
+func findPKCS11Slot(context *pkcs11.Ctx, label string) (uint, error) {
+	slots, err := context.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list the PKCS#11 slots: %s", err)
+	}
+
+	var matching []uint
+	for _, slot := range slots {
+		info, err := context.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+		if label == "" || strings.TrimSpace(info.Label) == label {
+			matching = append(matching, slot)
+		}
+	}
+
+	switch {
+	case len(matching) == 0 && label != "":
+		return 0, fmt.Errorf("no PKCS#11 token with the label %q", label)
+	case len(matching) == 0:
+		return 0, fmt.Errorf("no PKCS#11 token found")
+	case len(matching) > 1:
+		return 0, fmt.Errorf("several PKCS#11 tokens found, select one with --pkcs11-token")
+	}
+	return matching[0], nil
+}
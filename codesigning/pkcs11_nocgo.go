@@ -0,0 +1,14 @@
+//go:build !cgo
+
+package codesigning
+
+import (
+	"fmt"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+)
+
+// Load a signing identity from a certificate file whose private key is held by a PKCS#11 token
+func LoadIdentityFromPKCS11(certificatePath string, config PKCS11Config) (macho.Identity, error) {
+	return macho.Identity{}, fmt.Errorf("PKCS#11 tokens are not supported by this build (cgo is required)")
+}
@@ -3,11 +3,15 @@ module github.com/e-n-0/sign-app-cli
 go 1.19
 
 require (
+	github.com/miekg/pkcs11 v1.1.2
 	github.com/spf13/cobra v1.6.1
+	gopkg.in/yaml.v3 v3.0.1
 	howett.net/plist v1.0.0
+	software.sslmate.com/src/go-pkcs12 v0.5.0
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.0.1 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/crypto v0.11.0 // indirect
 )
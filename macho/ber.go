@@ -0,0 +1,125 @@
+package macho
+
+import (
+	"fmt"
+)
+
+// Deepest nesting of BER elements accepted
+const maxBERDepth = 64
+
+// Convert BER encoded data to DER so that encoding/asn1 can read it: the indefinite lengths
+// are replaced by definite ones and the constructed octet strings by primitive ones
+// The CMS signatures of codesign and of the provisioning profiles are BER encoded
+func berToDER(data []byte) ([]byte, error) {
+	tag, content, rest, err := readBERElement(data, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("%d bytes after the BER element", len(rest))
+	}
+	return append(append(tag, derLength(len(content))...), content...), nil
+}
+
+// Read a BER element and return its identifier, its content converted to DER and the following data
+func readBERElement(data []byte, depth int) ([]byte, []byte, []byte, error) {
+	if depth > maxBERDepth {
+		return nil, nil, nil, fmt.Errorf("BER elements nested too deeply")
+	}
+	if len(data) < 2 {
+		return nil, nil, nil, fmt.Errorf("truncated BER element")
+	}
+
+	// Identifier, the high tag numbers are followed by base 128 bytes
+	tagLength := 1
+	if data[0]&0x1f == 0x1f {
+		for tagLength < len(data) && data[tagLength]&0x80 != 0 {
+			tagLength++
+		}
+		tagLength++
+	}
+	if tagLength >= len(data) {
+		return nil, nil, nil, fmt.Errorf("truncated BER identifier")
+	}
+	tag := data[:tagLength:tagLength]
+	constructed := data[0]&0x20 != 0
+	data = data[tagLength:]
+
+	// Length, 0x80 for the indefinite length of a constructed element ended by two zero bytes
+	indefinite := data[0] == 0x80
+	length := 0
+	switch {
+	case indefinite:
+		if !constructed {
+			return nil, nil, nil, fmt.Errorf("indefinite length of a primitive BER element")
+		}
+		data = data[1:]
+	case data[0] < 0x80:
+		length = int(data[0])
+		data = data[1:]
+	default:
+		count := int(data[0] & 0x7f)
+		if count > 4 || 1+count > len(data) {
+			return nil, nil, nil, fmt.Errorf("invalid BER length")
+		}
+		for _, b := range data[1 : 1+count] {
+			length = length<<8 | int(b)
+		}
+		data = data[1+count:]
+	}
+	if !indefinite && length > len(data) {
+		return nil, nil, nil, fmt.Errorf("truncated BER element")
+	}
+
+	if !constructed {
+		return tag, data[:length], data[length:], nil
+	}
+
+	// The constructed octet strings are made of primitive octet strings, they are joined
+	octetString := len(tag) == 1 && tag[0] == 0x24
+	if octetString {
+		tag = []byte{0x04}
+	}
+
+	children := data
+	if !indefinite {
+		children = data[:length]
+	}
+	var content []byte
+	for {
+		if indefinite && len(children) >= 2 && children[0] == 0 && children[1] == 0 {
+			children = children[2:]
+			break
+		}
+		if !indefinite && len(children) == 0 {
+			break
+		}
+		if len(children) == 0 {
+			return nil, nil, nil, fmt.Errorf("BER element without end of contents")
+		}
+
+		childTag, childContent, rest, err := readBERElement(children, depth+1)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		children = rest
+		if octetString {
+			if len(childTag) != 1 || childTag[0] != 0x04 {
+				return nil, nil, nil, fmt.Errorf("invalid element in a BER octet string")
+			}
+			content = append(content, childContent...)
+			continue
+		}
+		content = append(append(append(content, childTag...), derLength(len(childContent))...), childContent...)
+	}
+
+	if indefinite {
+		return tag, content, children, nil
+	}
+	return tag, content, data[length:], nil
+}
+
+// Encode a DER length
+func derLength(length int) []byte {
+	return derHeader(0, length)[1:]
+}
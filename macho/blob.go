@@ -0,0 +1,139 @@
+package macho
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+// Magic numbers of the code signature blobs
+const (
+	magicRequirement       = 0xfade0c00
+	magicRequirements      = 0xfade0c01
+	magicCodeDirectory     = 0xfade0c02
+	magicEmbeddedSignature = 0xfade0cc0
+	magicEntitlements      = 0xfade7171
+	magicEntitlementsDER   = 0xfade7172
+	magicBlobWrapper       = 0xfade0b01
+)
+
+// Slots of the embedded signature SuperBlob
+const (
+	SlotCodeDirectory          = 0
+	SlotInfoPlist              = 1
+	SlotRequirements           = 2
+	SlotResourceDirectory      = 3
+	SlotApplication            = 4
+	SlotEntitlements           = 5
+	SlotEntitlementsDER        = 7
+	SlotAlternateCodeDirectory = 0x1000
+	SlotSignature              = 0x10000
+)
+
+// Hash types of the CodeDirectory
+const (
+	HashTypeSHA1   = 1
+	HashTypeSHA256 = 2
+)
+
+// Flags of the CodeDirectory
+const (
+	FlagAdhoc        = 0x2
+	FlagRuntime      = 0x10000
+	FlagLinkerSigned = 0x20000
+)
+
+// Flags of the executable segment
+const (
+	execSegMainBinary    = 0x1
+	execSegAllowUnsigned = 0x10
+)
+
+const pageSizeBits = 12
+
+// Create the hash function of a CodeDirectory hash type
+func newHash(hashType uint8) hash.Hash {
+	if hashType == HashTypeSHA1 {
+		return sha1.New()
+	}
+	return sha256.New()
+}
+
+// Hash data with a CodeDirectory hash type
+func hashData(hashType uint8, data []byte) []byte {
+	h := newHash(hashType)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// Wrap data in a blob with the given magic
+func makeBlob(magic uint32, data []byte) []byte {
+	blob := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint32(blob, magic)
+	binary.BigEndian.PutUint32(blob[4:], uint32(len(blob)))
+	copy(blob[8:], data)
+	return blob
+}
+
+// An entry of a SuperBlob
+type blobEntry struct {
+	slot uint32
+	data []byte
+}
+
+// Build the embedded signature SuperBlob
+func makeSuperBlob(entries []blobEntry) []byte {
+	headerSize := 12 + 8*len(entries)
+	size := headerSize
+	for _, entry := range entries {
+		size += len(entry.data)
+	}
+
+	blob := make([]byte, size)
+	binary.BigEndian.PutUint32(blob, magicEmbeddedSignature)
+	binary.BigEndian.PutUint32(blob[4:], uint32(size))
+	binary.BigEndian.PutUint32(blob[8:], uint32(len(entries)))
+
+	offset := headerSize
+	for i, entry := range entries {
+		binary.BigEndian.PutUint32(blob[12+8*i:], entry.slot)
+		binary.BigEndian.PutUint32(blob[16+8*i:], uint32(offset))
+		copy(blob[offset:], entry.data)
+		offset += len(entry.data)
+	}
+
+	return blob
+}
+
+// Parse a SuperBlob into its entries, indexed by slot
+func parseSuperBlob(data []byte, magic uint32) (map[uint32][]byte, error) {
+	if len(data) < 12 || binary.BigEndian.Uint32(data) != magic {
+		return nil, fmt.Errorf("invalid super blob")
+	}
+
+	size := int(binary.BigEndian.Uint32(data[4:]))
+	count := int(binary.BigEndian.Uint32(data[8:]))
+	if size > len(data) || 12+8*count > size {
+		return nil, fmt.Errorf("truncated super blob")
+	}
+	data = data[:size]
+
+	entries := map[uint32][]byte{}
+	for i := 0; i < count; i++ {
+		slot := binary.BigEndian.Uint32(data[12+8*i:])
+		offset := int(binary.BigEndian.Uint32(data[16+8*i:]))
+		if offset+8 > size {
+			return nil, fmt.Errorf("invalid super blob entry")
+		}
+
+		length := int(binary.BigEndian.Uint32(data[offset+4:]))
+		if length < 8 || offset+length > size {
+			return nil, fmt.Errorf("invalid super blob entry")
+		}
+		entries[slot] = data[offset : offset+length]
+	}
+
+	return entries, nil
+}
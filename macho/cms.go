@@ -0,0 +1,376 @@
+package macho
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"howett.net/plist"
+)
+
+var (
+	oidData            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA1            = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+
+	// Apple attributes listing the hashes of every CodeDirectory
+	oidAppleCDHashes  = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 9, 1}
+	oidAppleCDHashes2 = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 9, 2}
+)
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	// [0] EXPLICIT content, Bytes holds the encoded content
+	Content asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      cmsEncapsulatedContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsEncapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	// [0] EXPLICIT content, absent from detached signatures
+	Content asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type cmsIssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SignerIdentifier   cmsIssuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type cmsHashAgility struct {
+	Algorithm asn1.ObjectIdentifier
+	Digest    []byte
+}
+
+// Identity used to create the CMS signature
+type Identity struct {
+	Certificate *x509.Certificate
+	// Intermediate certificates embedded in the signature
+	Chain []*x509.Certificate
+	Key   crypto.Signer
+}
+
+// Encode an attribute with its values
+func marshalAttribute(oid asn1.ObjectIdentifier, values ...[]byte) ([]byte, error) {
+	return asn1.Marshal(cmsAttribute{
+		Type:   oid,
+		Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(values, nil)},
+	})
+}
+
+// Build the signed attributes of the signature of the CodeDirectories
+func signedAttributes(codeDirectories []*CodeDirectory, signingTime time.Time) ([]byte, error) {
+	contentType, _ := asn1.Marshal(oidData)
+	signingTimeValue, _ := asn1.Marshal(signingTime.UTC())
+	digest := sha256.Sum256(codeDirectories[0].Raw)
+	messageDigest, _ := asn1.Marshal(digest[:])
+
+	// CDHashes contains a plist with the truncated hash of each CodeDirectory,
+	// CDHashes2 the full hashes with their algorithm
+	var cdhashes []interface{}
+	var agilityHashes [][]byte
+	for _, cd := range codeDirectories {
+		cdhashes = append(cdhashes, cd.CDHash())
+
+		algorithm := oidSHA256
+		if cd.HashType == HashTypeSHA1 {
+			algorithm = oidSHA1
+		}
+		agilityHash, err := asn1.Marshal(cmsHashAgility{Algorithm: algorithm, Digest: cd.FullHash()})
+		if err != nil {
+			return nil, err
+		}
+		agilityHashes = append(agilityHashes, agilityHash)
+	}
+
+	cdhashesPlist, err := plist.MarshalIndent(map[string]interface{}{"cdhashes": cdhashes}, plist.XMLFormat, "\t")
+	if err != nil {
+		return nil, err
+	}
+	cdhashesValue, _ := asn1.Marshal(cdhashesPlist)
+
+	var attributes [][]byte
+	for _, attribute := range []struct {
+		oid    asn1.ObjectIdentifier
+		values [][]byte
+	}{
+		{oidContentType, [][]byte{contentType}},
+		{oidSigningTime, [][]byte{signingTimeValue}},
+		{oidMessageDigest, [][]byte{messageDigest}},
+		{oidAppleCDHashes, [][]byte{cdhashesValue}},
+		{oidAppleCDHashes2, agilityHashes},
+	} {
+		encoded, err := marshalAttribute(attribute.oid, attribute.values...)
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, encoded)
+	}
+
+	// DER requires the elements of a SET OF to be sorted
+	sort.Slice(attributes, func(i, j int) bool { return bytes.Compare(attributes[i], attributes[j]) < 0 })
+	return bytes.Join(attributes, nil), nil
+}
+
+// Return the algorithm identifier of the signature made by the key
+func signatureAlgorithm(key crypto.Signer) (pkix.AlgorithmIdentifier, error) {
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}, nil
+	case *ecdsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+	default:
+		return pkix.AlgorithmIdentifier{}, fmt.Errorf("unsupported private key type %T", key.Public())
+	}
+}
+
+// Create the detached CMS signature of the CodeDirectories
+// The first CodeDirectory is the signed content, the signature is timestamped
+// by the RFC 3161 server when timestampServer is set
+func SignCodeDirectories(codeDirectories []*CodeDirectory, identity Identity, timestampServer string) ([]byte, error) {
+	attributes, err := signedAttributes(codeDirectories, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, err := signatureAlgorithm(identity.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature covers the attributes encoded as a SET
+	digest := sha256.Sum256(append(derHeader(asn1.TagSet|0x20, len(attributes)), attributes...))
+	signature, err := identity.Key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign the code directory: %s", err)
+	}
+
+	// The timestamp token is an unsigned attribute covering the signature value
+	var unsignedAttributes asn1.RawValue
+	if timestampServer != "" {
+		token, err := requestTimestamp(timestampServer, signature)
+		if err != nil {
+			return nil, err
+		}
+		attribute, err := marshalAttribute(oidTimestampToken, token)
+		if err != nil {
+			return nil, err
+		}
+		unsignedAttributes = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: attribute}
+	}
+
+	var certificates []byte
+	for _, certificate := range append([]*x509.Certificate{identity.Certificate}, identity.Chain...) {
+		certificates = append(certificates, certificate.Raw...)
+	}
+
+	digestAlgorithm := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+	signedData, err := asn1.Marshal(cmsSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlgorithm},
+		ContentInfo:      cmsEncapsulatedContentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificates},
+		SignerInfos: []cmsSignerInfo{{
+			Version: 1,
+			SignerIdentifier: cmsIssuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: identity.Certificate.RawIssuer},
+				SerialNumber: identity.Certificate.SerialNumber,
+			},
+			DigestAlgorithm:    digestAlgorithm,
+			SignedAttributes:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attributes},
+			SignatureAlgorithm: algorithm,
+			Signature:          signature,
+			UnsignedAttributes: unsignedAttributes,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(cmsContentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+}
+
+// Parsed CMS signature of a code signature
+type CMSSignature struct {
+	Certificates []*x509.Certificate
+	SigningTime  time.Time
+
+	// Time certified by the timestamp server, zero when the signature is not timestamped
+	Timestamp time.Time
+
+	// Signed content embedded in the signature, nil for the detached signatures of the code
+	Content []byte
+
+	signerInfo cmsSignerInfo
+	attributes []cmsAttribute
+}
+
+// Certificate used to sign, nil when not embedded in the signature
+func (signature *CMSSignature) SignerCertificate() *x509.Certificate {
+	for _, certificate := range signature.Certificates {
+		if certificate.SerialNumber.Cmp(signature.signerInfo.SignerIdentifier.SerialNumber) == 0 &&
+			bytes.Equal(certificate.RawIssuer, signature.signerInfo.SignerIdentifier.Issuer.FullBytes) {
+			return certificate
+		}
+	}
+	return nil
+}
+
+// Parse a CMS signature blob
+func ParseCMS(data []byte) (*CMSSignature, error) {
+	data, err := berToDER(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CMS signature: %s", err)
+	}
+
+	var contentInfo cmsContentInfo
+	if _, err := asn1.Unmarshal(data, &contentInfo); err != nil {
+		return nil, fmt.Errorf("invalid CMS signature: %s", err)
+	}
+	if !contentInfo.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("the CMS signature is not signed data")
+	}
+
+	var signedData cmsSignedData
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+		return nil, fmt.Errorf("invalid CMS signed data: %s", err)
+	}
+	if len(signedData.SignerInfos) != 1 {
+		return nil, fmt.Errorf("expected one CMS signer, found %d", len(signedData.SignerInfos))
+	}
+
+	certificates, err := x509.ParseCertificates(signedData.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CMS certificates: %s", err)
+	}
+
+	signature := &CMSSignature{Certificates: certificates, signerInfo: signedData.SignerInfos[0]}
+	if len(signedData.ContentInfo.Content.Bytes) > 0 {
+		if _, err := asn1.Unmarshal(signedData.ContentInfo.Content.Bytes, &signature.Content); err != nil {
+			return nil, fmt.Errorf("invalid CMS content: %s", err)
+		}
+	}
+
+	rest := signature.signerInfo.SignedAttributes.Bytes
+	for len(rest) > 0 {
+		var attribute cmsAttribute
+		rest, err = asn1.Unmarshal(rest, &attribute)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CMS attribute: %s", err)
+		}
+		signature.attributes = append(signature.attributes, attribute)
+
+		if attribute.Type.Equal(oidSigningTime) {
+			asn1.Unmarshal(attribute.Values.Bytes, &signature.SigningTime)
+		}
+	}
+
+	rest = signature.signerInfo.UnsignedAttributes.Bytes
+	for len(rest) > 0 {
+		var attribute cmsAttribute
+		rest, err = asn1.Unmarshal(rest, &attribute)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CMS attribute: %s", err)
+		}
+
+		if attribute.Type.Equal(oidTimestampToken) {
+			info, err := parseTimestampToken(attribute.Values.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			signature.Timestamp = info.GenTime
+		}
+	}
+
+	return signature, nil
+}
+
+// Verify the CMS signature of the signed content
+func (signature *CMSSignature) Verify(content []byte) error {
+	certificate := signature.SignerCertificate()
+	if certificate == nil {
+		return fmt.Errorf("the signing certificate is missing from the CMS signature")
+	}
+
+	// SHA-256 for the code signatures, the older provisioning profiles use SHA-1
+	hash, algorithm := crypto.SHA256, x509.SHA256WithRSA
+	if signature.signerInfo.DigestAlgorithm.Algorithm.Equal(oidSHA1) {
+		hash, algorithm = crypto.SHA1, x509.SHA1WithRSA
+	}
+	if _, ok := certificate.PublicKey.(*ecdsa.PublicKey); ok {
+		algorithm = x509.ECDSAWithSHA256
+		if hash == crypto.SHA1 {
+			algorithm = x509.ECDSAWithSHA1
+		}
+	}
+	hasher := hash.New()
+	hasher.Write(content)
+	digest := hasher.Sum(nil)
+
+	// The message digest attribute must match the content
+	found := false
+	for _, attribute := range signature.attributes {
+		if attribute.Type.Equal(oidMessageDigest) {
+			var messageDigest []byte
+			if _, err := asn1.Unmarshal(attribute.Values.Bytes, &messageDigest); err != nil {
+				return fmt.Errorf("invalid message digest attribute: %s", err)
+			}
+			if !bytes.Equal(messageDigest, digest) {
+				return fmt.Errorf("the CMS message digest does not match the signed content")
+			}
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("the CMS signature has no message digest")
+	}
+
+	attributes := signature.signerInfo.SignedAttributes.Bytes
+	signedContent := append(derHeader(asn1.TagSet|0x20, len(attributes)), attributes...)
+
+	if err := certificate.CheckSignature(algorithm, signedContent, signature.signerInfo.Signature); err != nil {
+		return fmt.Errorf("invalid CMS signature: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package macho
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	codeDirectoryVersion    = 0x20400
+	codeDirectoryHeaderSize = 88
+)
+
+// CodeDirectory holds the hashes of the code pages and of the special slots
+type CodeDirectory struct {
+	Version      uint32
+	Flags        uint32
+	HashType     uint8
+	Identifier   string
+	TeamID       string
+	CodeLimit    uint64
+	PageSizeBits uint8
+
+	// Hashes of the special slots, SpecialSlots[0] is slot 1 (Info.plist)
+	SpecialSlots [][]byte
+	// Hashes of the code pages
+	CodeSlots [][]byte
+
+	ExecSegBase  uint64
+	ExecSegLimit uint64
+	ExecSegFlags uint64
+
+	// Encoded blob, set when parsed or built
+	Raw []byte
+}
+
+// Hash of the CodeDirectory, truncated to 20 bytes
+func (cd *CodeDirectory) CDHash() []byte {
+	return hashData(cd.HashType, cd.Raw)[:20]
+}
+
+// Hash of the CodeDirectory
+func (cd *CodeDirectory) FullHash() []byte {
+	return hashData(cd.HashType, cd.Raw)
+}
+
+// Return the hash of a special slot, nil when not set
+func (cd *CodeDirectory) SpecialSlot(slot int) []byte {
+	if slot < 1 || slot > len(cd.SpecialSlots) {
+		return nil
+	}
+
+	hash := cd.SpecialSlots[slot-1]
+	for _, b := range hash {
+		if b != 0 {
+			return hash
+		}
+	}
+	return nil
+}
+
+// Hash the code pages of the data up to the code limit
+func hashCodePages(hashType uint8, data []byte, pageSizeBits uint8) [][]byte {
+	pageSize := 1 << pageSizeBits
+	var hashes [][]byte
+	for offset := 0; offset < len(data); offset += pageSize {
+		end := offset + pageSize
+		if end > len(data) {
+			end = len(data)
+		}
+		hashes = append(hashes, hashData(hashType, data[offset:end]))
+	}
+	return hashes
+}
+
+// Encode the CodeDirectory blob and store it in Raw
+func (cd *CodeDirectory) Bytes() []byte {
+	hashSize := len(hashData(cd.HashType, nil))
+
+	identOffset := codeDirectoryHeaderSize
+	teamOffset := identOffset + len(cd.Identifier) + 1
+	hashOffset := teamOffset
+	if cd.TeamID != "" {
+		hashOffset += len(cd.TeamID) + 1
+	} else {
+		teamOffset = 0
+	}
+	hashOffset += len(cd.SpecialSlots) * hashSize
+	size := hashOffset + len(cd.CodeSlots)*hashSize
+
+	blob := make([]byte, size)
+	binary.BigEndian.PutUint32(blob[0:], magicCodeDirectory)
+	binary.BigEndian.PutUint32(blob[4:], uint32(size))
+	binary.BigEndian.PutUint32(blob[8:], codeDirectoryVersion)
+	binary.BigEndian.PutUint32(blob[12:], cd.Flags)
+	binary.BigEndian.PutUint32(blob[16:], uint32(hashOffset))
+	binary.BigEndian.PutUint32(blob[20:], uint32(identOffset))
+	binary.BigEndian.PutUint32(blob[24:], uint32(len(cd.SpecialSlots)))
+	binary.BigEndian.PutUint32(blob[28:], uint32(len(cd.CodeSlots)))
+	if cd.CodeLimit <= 0xffffffff {
+		binary.BigEndian.PutUint32(blob[32:], uint32(cd.CodeLimit))
+	} else {
+		binary.BigEndian.PutUint64(blob[56:], cd.CodeLimit)
+	}
+	blob[36] = uint8(hashSize)
+	blob[37] = cd.HashType
+	blob[39] = cd.PageSizeBits
+	binary.BigEndian.PutUint32(blob[48:], uint32(teamOffset))
+	binary.BigEndian.PutUint64(blob[64:], cd.ExecSegBase)
+	binary.BigEndian.PutUint64(blob[72:], cd.ExecSegLimit)
+	binary.BigEndian.PutUint64(blob[80:], cd.ExecSegFlags)
+
+	copy(blob[identOffset:], cd.Identifier)
+	if teamOffset != 0 {
+		copy(blob[teamOffset:], cd.TeamID)
+	}
+
+	// Special slots are stored in reverse order before the code slots
+	for i, hash := range cd.SpecialSlots {
+		copy(blob[hashOffset-(i+1)*hashSize:], hash)
+	}
+	for i, hash := range cd.CodeSlots {
+		copy(blob[hashOffset+i*hashSize:], hash)
+	}
+
+	cd.Version = codeDirectoryVersion
+	cd.Raw = blob
+	return blob
+}
+
+// Parse a CodeDirectory blob
+func ParseCodeDirectory(blob []byte) (*CodeDirectory, error) {
+	if len(blob) < 44 || binary.BigEndian.Uint32(blob) != magicCodeDirectory {
+		return nil, fmt.Errorf("invalid code directory")
+	}
+
+	size := int(binary.BigEndian.Uint32(blob[4:]))
+	if size < 44 || size > len(blob) {
+		return nil, fmt.Errorf("truncated code directory")
+	}
+	blob = blob[:size]
+
+	cd := &CodeDirectory{
+		Version:      binary.BigEndian.Uint32(blob[8:]),
+		Flags:        binary.BigEndian.Uint32(blob[12:]),
+		CodeLimit:    uint64(binary.BigEndian.Uint32(blob[32:])),
+		HashType:     blob[37],
+		PageSizeBits: blob[39],
+		Raw:          blob,
+	}
+
+	hashOffset := int(binary.BigEndian.Uint32(blob[16:]))
+	identOffset := int(binary.BigEndian.Uint32(blob[20:]))
+	specialSlots := int(binary.BigEndian.Uint32(blob[24:]))
+	codeSlots := int(binary.BigEndian.Uint32(blob[28:]))
+	hashSize := int(blob[36])
+
+	if hashSize == 0 || cd.PageSizeBits > 30 || hashOffset-specialSlots*hashSize < 0 || hashOffset+codeSlots*hashSize > size || identOffset >= size {
+		return nil, fmt.Errorf("invalid code directory layout")
+	}
+
+	cd.Identifier = cString(blob[identOffset:])
+	if cd.Version >= 0x20200 && size >= 52 {
+		if teamOffset := int(binary.BigEndian.Uint32(blob[48:])); teamOffset != 0 && teamOffset < size {
+			cd.TeamID = cString(blob[teamOffset:])
+		}
+	}
+	if cd.Version >= 0x20300 && size >= 64 {
+		if codeLimit64 := binary.BigEndian.Uint64(blob[56:]); codeLimit64 != 0 {
+			cd.CodeLimit = codeLimit64
+		}
+	}
+	if cd.Version >= 0x20400 && size >= 88 {
+		cd.ExecSegBase = binary.BigEndian.Uint64(blob[64:])
+		cd.ExecSegLimit = binary.BigEndian.Uint64(blob[72:])
+		cd.ExecSegFlags = binary.BigEndian.Uint64(blob[80:])
+	}
+
+	for i := 1; i <= specialSlots; i++ {
+		start := hashOffset - i*hashSize
+		cd.SpecialSlots = append(cd.SpecialSlots, blob[start:start+hashSize])
+	}
+	for i := 0; i < codeSlots; i++ {
+		start := hashOffset + i*hashSize
+		cd.CodeSlots = append(cd.CodeSlots, blob[start:start+hashSize])
+	}
+
+	return cd, nil
+}
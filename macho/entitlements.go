@@ -0,0 +1,120 @@
+package macho
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"howett.net/plist"
+)
+
+// DER tags used by the entitlements encoding
+const (
+	derBoolean    = 0x01
+	derInteger    = 0x02
+	derOctets     = 0x04
+	derUTF8String = 0x0c
+	derSequence   = 0x30
+	// [APPLICATION 16], wraps the encoded entitlements
+	derEntitlements = 0x70
+	// [CONTEXT 16], a dictionary of key/value sequences
+	derDictionary = 0xb0
+)
+
+// Encode the DER header of a value
+func derHeader(tag byte, length int) []byte {
+	if length < 0x80 {
+		return []byte{tag, byte(length)}
+	}
+
+	var lengthBytes []byte
+	for n := length; n > 0; n >>= 8 {
+		lengthBytes = append([]byte{byte(n)}, lengthBytes...)
+	}
+	return append([]byte{tag, 0x80 | byte(len(lengthBytes))}, lengthBytes...)
+}
+
+// Encode a DER tag, length and content
+func derEncode(tag byte, content []byte) []byte {
+	return append(derHeader(tag, len(content)), content...)
+}
+
+func derEncodeInteger(value *big.Int) []byte {
+	content := value.Bytes()
+	if value.Sign() < 0 {
+		// Two's complement of negative values
+		length := len(content) + 1
+		modulus := new(big.Int).Lsh(big.NewInt(1), uint(length*8))
+		content = new(big.Int).Add(modulus, value).Bytes()
+		for len(content) > 1 && content[0] == 0xff && content[1]&0x80 != 0 {
+			content = content[1:]
+		}
+	} else if len(content) == 0 || content[0]&0x80 != 0 {
+		content = append([]byte{0}, content...)
+	}
+	return derEncode(derInteger, content)
+}
+
+// Encode a plist value with the DER entitlements encoding
+func derEncodeValue(value interface{}) ([]byte, error) {
+	switch value := value.(type) {
+	case bool:
+		if value {
+			return derEncode(derBoolean, []byte{0xff}), nil
+		}
+		return derEncode(derBoolean, []byte{0x00}), nil
+	case string:
+		return derEncode(derUTF8String, []byte(value)), nil
+	case uint64:
+		return derEncodeInteger(new(big.Int).SetUint64(value)), nil
+	case int64:
+		return derEncodeInteger(big.NewInt(value)), nil
+	case []byte:
+		return derEncode(derOctets, value), nil
+	case []interface{}:
+		var content []byte
+		for _, item := range value {
+			encoded, err := derEncodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			content = append(content, encoded...)
+		}
+		return derEncode(derSequence, content), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var content []byte
+		for _, key := range keys {
+			encoded, err := derEncodeValue(value[key])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", key, err)
+			}
+			pair := append(derEncode(derUTF8String, []byte(key)), encoded...)
+			content = append(content, derEncode(derSequence, pair)...)
+		}
+		return derEncode(derDictionary, content), nil
+	default:
+		return nil, fmt.Errorf("unsupported entitlement value type %T", value)
+	}
+}
+
+// Convert an entitlements plist to the DER encoding used by the EntitlementsDER slot
+func EntitlementsToDER(entitlements []byte) ([]byte, error) {
+	var data map[string]interface{}
+	if _, err := plist.Unmarshal(entitlements, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse the entitlements: %s", err)
+	}
+
+	dictionary, err := derEncodeValue(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the entitlements: %s", err)
+	}
+
+	version := derEncodeInteger(big.NewInt(1))
+	return derEncode(derEntitlements, append(version, dictionary...)), nil
+}
@@ -0,0 +1,124 @@
+package macho
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Largest alignment of a slice, 2^15 like lipo
+const maxFatAlign = 15
+
+// Arch is a slice of a universal (fat) binary
+type Arch struct {
+	CPUType    uint32
+	CPUSubtype uint32
+	Align      uint32
+	Data       []byte
+}
+
+// Split a universal binary into its slices
+func SplitFat(data []byte) ([]Arch, error) {
+	if !IsFat(data) {
+		return nil, fmt.Errorf("not a universal binary")
+	}
+
+	is64 := IsFat64(data)
+	count := int(binary.BigEndian.Uint32(data[4:]))
+	entrySize := 20
+	if is64 {
+		entrySize = 32
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("universal binary without architectures")
+	}
+	if 8+count*entrySize > len(data) {
+		return nil, fmt.Errorf("truncated universal binary header")
+	}
+
+	var arches []Arch
+	for i := 0; i < count; i++ {
+		entry := data[8+i*entrySize:]
+		arch := Arch{
+			CPUType:    binary.BigEndian.Uint32(entry),
+			CPUSubtype: binary.BigEndian.Uint32(entry[4:]),
+		}
+
+		var offset, size uint64
+		if is64 {
+			offset = binary.BigEndian.Uint64(entry[8:])
+			size = binary.BigEndian.Uint64(entry[16:])
+			arch.Align = binary.BigEndian.Uint32(entry[24:])
+		} else {
+			offset = uint64(binary.BigEndian.Uint32(entry[8:]))
+			size = uint64(binary.BigEndian.Uint32(entry[12:]))
+			arch.Align = binary.BigEndian.Uint32(entry[16:])
+		}
+
+		if arch.Align > maxFatAlign {
+			return nil, fmt.Errorf("invalid alignment 2^%d of the universal binary slice %d", arch.Align, i)
+		}
+		if offset%(1<<arch.Align) != 0 {
+			return nil, fmt.Errorf("the universal binary slice %d is not aligned on 2^%d", i, arch.Align)
+		}
+		if offset > uint64(len(data)) || size > uint64(len(data))-offset {
+			return nil, fmt.Errorf("truncated universal binary slice")
+		}
+		arch.Data = data[offset : offset+size]
+		arches = append(arches, arch)
+	}
+
+	return arches, nil
+}
+
+// Build a universal binary from its slices, with 64-bit offsets and sizes when fat64 is set
+func BuildFat(arches []Arch, fat64 bool) ([]byte, error) {
+	entrySize := 20
+	if fat64 {
+		entrySize = 32
+	}
+	headerSize := 8 + len(arches)*entrySize
+
+	// Compute the offset of each slice using its alignment
+	offsets := make([]int, len(arches))
+	end := headerSize
+	for i, arch := range arches {
+		if arch.Align > maxFatAlign {
+			return nil, fmt.Errorf("invalid alignment 2^%d of the universal binary slice %d", arch.Align, i)
+		}
+		offsets[i] = align(end, 1<<arch.Align)
+		end = offsets[i] + len(arch.Data)
+	}
+	if !fat64 && uint64(end) > 1<<32-1 {
+		return nil, fmt.Errorf("the universal binary is too large for 32-bit offsets")
+	}
+
+	data := make([]byte, end)
+	magic := uint32(magicFat)
+	if fat64 {
+		magic = magicFat64
+	}
+	binary.BigEndian.PutUint32(data, magic)
+	binary.BigEndian.PutUint32(data[4:], uint32(len(arches)))
+	for i, arch := range arches {
+		entry := data[8+i*entrySize:]
+		binary.BigEndian.PutUint32(entry, arch.CPUType)
+		binary.BigEndian.PutUint32(entry[4:], arch.CPUSubtype)
+		if fat64 {
+			binary.BigEndian.PutUint64(entry[8:], uint64(offsets[i]))
+			binary.BigEndian.PutUint64(entry[16:], uint64(len(arch.Data)))
+			binary.BigEndian.PutUint32(entry[24:], arch.Align)
+		} else {
+			binary.BigEndian.PutUint32(entry[8:], uint32(offsets[i]))
+			binary.BigEndian.PutUint32(entry[12:], uint32(len(arch.Data)))
+			binary.BigEndian.PutUint32(entry[16:], arch.Align)
+		}
+		copy(data[offsets[i]:], arch.Data)
+	}
+
+	return data, nil
+}
+
+// Check if a universal binary has 64-bit offsets and sizes
+func IsFat64(data []byte) bool {
+	return len(data) >= 4 && binary.BigEndian.Uint32(data) == magicFat64
+}
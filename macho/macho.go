@@ -0,0 +1,377 @@
+package macho
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Mach-O constants used by the signature code
+const (
+	magic32    = 0xfeedface
+	magic64    = 0xfeedfacf
+	magicFat   = 0xcafebabe
+	magicFat64 = 0xcafebabf
+
+	loadCommandSegment       = 0x1
+	loadCommandSegment64     = 0x19
+	loadCommandCodeSignature = 0x1d
+
+	fileTypeExecute = 0x2
+	fileTypeDylib   = 0x6
+	fileTypeBundle  = 0x8
+
+	cpuTypeARM64 = 0x0100000c
+	cpuTypeX8664 = 0x01000007
+)
+
+// Segment is a segment load command of a Mach-O file
+type Segment struct {
+	Name     string
+	VMAddr   uint64
+	VMSize   uint64
+	FileOff  uint64
+	FileSize uint64
+
+	// Offset of the load command in the file
+	commandOffset int
+}
+
+// File is a thin (single architecture) Mach-O image
+type File struct {
+	Data     []byte
+	Is64     bool
+	CPUType  uint32
+	FileType uint32
+	Segments []Segment
+
+	numberOfCommands int
+	sizeOfCommands   int
+
+	// Offset of the LC_CODE_SIGNATURE load command, -1 when the file is not signed
+	codeSignatureCommand int
+	// Lowest file offset of the section data, the load commands must stay below it
+	firstSectionOffset int
+}
+
+// Size of the Mach-O header
+func (file *File) headerSize() int {
+	if file.Is64 {
+		return 32
+	}
+	return 28
+}
+
+// Check if the data starts with a thin Mach-O magic
+func IsMachO(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	magic := binary.LittleEndian.Uint32(data)
+	return magic == magic32 || magic == magic64
+}
+
+// Check if the data starts with a universal (fat) binary magic
+func IsFat(data []byte) bool {
+	if len(data) < 8 {
+		return false
+	}
+	magic := binary.BigEndian.Uint32(data)
+	// Java class files share the fat magic, they have a large version number instead of an architecture count
+	return (magic == magicFat || magic == magicFat64) && binary.BigEndian.Uint32(data[4:]) < 32
+}
+
+// Check if the file starts with a thin or universal Mach-O magic
+func IsMachOFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	header := make([]byte, 8)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	header = header[:n]
+
+	return IsMachO(header) || IsFat(header), nil
+}
+
+// Check if the file is a Mach-O executable, dynamic library or loadable bundle
+// Object files and debug symbols are Mach-O files too but are not signed
+// The file type of a universal binary is read from its first architecture
+func IsSignableFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	header := make([]byte, 16)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, err
+	}
+	header = header[:n]
+
+	if IsFat(header) {
+		if binary.BigEndian.Uint32(header[4:]) == 0 {
+			return false, nil
+		}
+		// 32 and 64-bit fat_arch entries both start with the CPU type and subtype, then the offset
+		entry := make([]byte, 16)
+		if n, _ := file.ReadAt(entry, 8); n < len(entry) {
+			return false, nil
+		}
+		offset := int64(binary.BigEndian.Uint32(entry[8:]))
+		if binary.BigEndian.Uint32(header) == magicFat64 {
+			offset = int64(binary.BigEndian.Uint64(entry[8:]))
+		}
+		header = make([]byte, 16)
+		if n, _ := file.ReadAt(header, offset); n < len(header) {
+			return false, nil
+		}
+	}
+	if !IsMachO(header) || len(header) < 16 {
+		return false, nil
+	}
+
+	switch binary.LittleEndian.Uint32(header[12:]) {
+	case fileTypeExecute, fileTypeDylib, fileTypeBundle:
+		return true, nil
+	}
+	return false, nil
+}
+
+// Parse a thin Mach-O image
+func Parse(data []byte) (*File, error) {
+	if !IsMachO(data) {
+		return nil, fmt.Errorf("not a Mach-O file")
+	}
+
+	file := &File{
+		Data:                 data,
+		Is64:                 binary.LittleEndian.Uint32(data) == magic64,
+		codeSignatureCommand: -1,
+		firstSectionOffset:   len(data),
+	}
+	if len(data) < file.headerSize() {
+		return nil, fmt.Errorf("truncated Mach-O header")
+	}
+
+	file.CPUType = binary.LittleEndian.Uint32(data[4:])
+	file.FileType = binary.LittleEndian.Uint32(data[12:])
+	file.numberOfCommands = int(binary.LittleEndian.Uint32(data[16:]))
+	file.sizeOfCommands = int(binary.LittleEndian.Uint32(data[20:]))
+
+	if file.headerSize()+file.sizeOfCommands > len(data) {
+		return nil, fmt.Errorf("truncated Mach-O load commands")
+	}
+
+	offset := file.headerSize()
+	for i := 0; i < file.numberOfCommands; i++ {
+		if offset+8 > len(data) {
+			return nil, fmt.Errorf("truncated Mach-O load command")
+		}
+
+		command := binary.LittleEndian.Uint32(data[offset:])
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		if size < 8 || offset+size > file.headerSize()+file.sizeOfCommands {
+			return nil, fmt.Errorf("invalid Mach-O load command size")
+		}
+
+		var err error
+		switch command {
+		case loadCommandSegment64:
+			err = file.parseSegment(offset, size, true)
+		case loadCommandSegment:
+			err = file.parseSegment(offset, size, false)
+		case loadCommandCodeSignature:
+			if size < 16 {
+				err = fmt.Errorf("invalid LC_CODE_SIGNATURE load command size")
+			}
+			file.codeSignatureCommand = offset
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		offset += size
+	}
+
+	return file, nil
+}
+
+// Parse a segment load command of the given size
+func (file *File) parseSegment(offset int, size int, is64 bool) error {
+	commandSize := 56
+	if is64 {
+		commandSize = 72
+	}
+	if size < commandSize {
+		return fmt.Errorf("invalid Mach-O segment load command size")
+	}
+
+	// The sections are read from the load command only
+	data := file.Data[offset : offset+size]
+	segment := Segment{Name: cString(data[8:24]), commandOffset: offset}
+
+	var numberOfSections, sectionsOffset, sectionSize, sectionFileOffset int
+	if is64 {
+		segment.VMAddr = binary.LittleEndian.Uint64(data[24:])
+		segment.VMSize = binary.LittleEndian.Uint64(data[32:])
+		segment.FileOff = binary.LittleEndian.Uint64(data[40:])
+		segment.FileSize = binary.LittleEndian.Uint64(data[48:])
+		numberOfSections = int(binary.LittleEndian.Uint32(data[64:]))
+		sectionsOffset, sectionSize, sectionFileOffset = 72, 80, 48
+	} else {
+		segment.VMAddr = uint64(binary.LittleEndian.Uint32(data[24:]))
+		segment.VMSize = uint64(binary.LittleEndian.Uint32(data[28:]))
+		segment.FileOff = uint64(binary.LittleEndian.Uint32(data[32:]))
+		segment.FileSize = uint64(binary.LittleEndian.Uint32(data[36:]))
+		numberOfSections = int(binary.LittleEndian.Uint32(data[48:]))
+		sectionsOffset, sectionSize, sectionFileOffset = 56, 68, 40
+	}
+	if segment.FileOff > uint64(len(file.Data)) || segment.FileSize > uint64(len(file.Data))-segment.FileOff {
+		return fmt.Errorf("the Mach-O segment %s is past the end of the file", segment.Name)
+	}
+
+	for i := 0; i < numberOfSections; i++ {
+		start := sectionsOffset + i*sectionSize
+		if start+sectionSize > len(data) {
+			break
+		}
+
+		sectionOffset := int(binary.LittleEndian.Uint32(data[start+sectionFileOffset:]))
+		if sectionOffset > 0 && sectionOffset < file.firstSectionOffset {
+			file.firstSectionOffset = sectionOffset
+		}
+	}
+
+	file.Segments = append(file.Segments, segment)
+	return nil
+}
+
+// Find a segment by name
+func (file *File) Segment(name string) *Segment {
+	for i := range file.Segments {
+		if file.Segments[i].Name == name {
+			return &file.Segments[i]
+		}
+	}
+	return nil
+}
+
+// Return the offset and size of the embedded signature, ok is false when the file is not signed
+func (file *File) CodeSignature() (offset int, size int, ok bool) {
+	if file.codeSignatureCommand < 0 {
+		return 0, 0, false
+	}
+
+	offset = int(binary.LittleEndian.Uint32(file.Data[file.codeSignatureCommand+8:]))
+	size = int(binary.LittleEndian.Uint32(file.Data[file.codeSignatureCommand+12:]))
+	if offset+size > len(file.Data) {
+		return 0, 0, false
+	}
+	return offset, size, true
+}
+
+// Return the embedded signature data, nil when the file is not signed
+func (file *File) SignatureData() []byte {
+	offset, size, ok := file.CodeSignature()
+	if !ok {
+		return nil
+	}
+	return file.Data[offset : offset+size]
+}
+
+// Page size used to round the segment sizes
+func (file *File) pageSize() uint64 {
+	if file.CPUType == cpuTypeARM64 {
+		return 0x4000
+	}
+	return 0x1000
+}
+
+// Offset where the code ends and the signature starts
+// This is where the current signature starts, or the end of __LINKEDIT for unsigned files
+func (file *File) codeLimit() (int, error) {
+	linkedit := file.Segment("__LINKEDIT")
+	if linkedit == nil {
+		return 0, fmt.Errorf("missing __LINKEDIT segment")
+	}
+
+	codeLimit := len(file.Data)
+	if offset, _, ok := file.CodeSignature(); ok {
+		codeLimit = offset
+	}
+	if int(linkedit.FileOff+linkedit.FileSize) < codeLimit {
+		codeLimit = int(linkedit.FileOff + linkedit.FileSize)
+	}
+	return align(codeLimit, 16), nil
+}
+
+// Resize the file so a signature of the given size can be stored at its end
+// The LC_CODE_SIGNATURE load command is added when missing and __LINKEDIT is resized
+// Returns the new file data and the offset of the signature (the code limit)
+func (file *File) reserveSignature(signatureSize int) ([]byte, int, error) {
+	codeLimit, err := file.codeLimit()
+	if err != nil {
+		return nil, 0, err
+	}
+	linkedit := file.Segment("__LINKEDIT")
+
+	// The padding up to the code limit is filled with zeros
+	data := make([]byte, codeLimit+signatureSize)
+	if codeLimit < len(file.Data) {
+		copy(data, file.Data[:codeLimit])
+	} else {
+		copy(data, file.Data)
+	}
+
+	// Add the LC_CODE_SIGNATURE load command
+	commandOffset := file.codeSignatureCommand
+	if commandOffset < 0 {
+		commandOffset = file.headerSize() + file.sizeOfCommands
+		if commandOffset+16 > file.firstSectionOffset {
+			return nil, 0, fmt.Errorf("not enough space to add the LC_CODE_SIGNATURE load command")
+		}
+
+		binary.LittleEndian.PutUint32(data[commandOffset:], loadCommandCodeSignature)
+		binary.LittleEndian.PutUint32(data[commandOffset+4:], 16)
+		binary.LittleEndian.PutUint32(data[16:], uint32(file.numberOfCommands+1))
+		binary.LittleEndian.PutUint32(data[20:], uint32(file.sizeOfCommands+16))
+	}
+	binary.LittleEndian.PutUint32(data[commandOffset+8:], uint32(codeLimit))
+	binary.LittleEndian.PutUint32(data[commandOffset+12:], uint32(signatureSize))
+
+	// Resize __LINKEDIT so it covers the signature
+	fileSize := uint64(len(data)) - linkedit.FileOff
+	vmSize := uint64(align(int(fileSize), int(file.pageSize())))
+	segmentData := data[linkedit.commandOffset:]
+	if file.Is64 {
+		binary.LittleEndian.PutUint64(segmentData[32:], vmSize)
+		binary.LittleEndian.PutUint64(segmentData[48:], fileSize)
+	} else {
+		binary.LittleEndian.PutUint32(segmentData[28:], uint32(vmSize))
+		binary.LittleEndian.PutUint32(segmentData[36:], uint32(fileSize))
+	}
+
+	return data, codeLimit, nil
+}
+
+func align(value int, alignment int) int {
+	return (value + alignment - 1) / alignment * alignment
+}
+
+func cString(data []byte) string {
+	for i, b := range data {
+		if b == 0 {
+			return string(data[:i])
+		}
+	}
+	return string(data)
+}
@@ -0,0 +1,235 @@
+package macho
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	file, err := Parse(testImage(cpuTypeARM64, fileTypeExecute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.FileType != fileTypeExecute || file.CPUType != cpuTypeARM64 {
+		t.Errorf("file type %#x, CPU type %#x", file.FileType, file.CPUType)
+	}
+	if file.Segment("__TEXT") == nil || file.Segment("__LINKEDIT") == nil {
+		t.Errorf("segments %v", file.Segments)
+	}
+	if file.firstSectionOffset != 0x1000 {
+		t.Errorf("first section at %#x", file.firstSectionOffset)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(data []byte) []byte
+	}{
+		{"truncated header", func(data []byte) []byte { return data[:20] }},
+		{"load commands past the file", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[20:], uint32(len(data)))
+			return data
+		}},
+		{"load command past the load commands", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[32+152+4:], 0x1000)
+			return data
+		}},
+		{"load command too small", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[32+4:], 4)
+			return data
+		}},
+		{"segment command too small", func(data []byte) []byte {
+			// A 16 bytes segment command with the second command moved after it
+			binary.LittleEndian.PutUint32(data[32+4:], 16)
+			binary.LittleEndian.PutUint32(data[16:], 1)
+			return data
+		}},
+		{"sections past the segment command", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[32+64:], 1000)
+			return data
+		}},
+		{"segment past the file", func(data []byte) []byte {
+			binary.LittleEndian.PutUint64(data[32+152+48:], 1<<63)
+			return data
+		}},
+		{"code signature command too small", func(data []byte) []byte {
+			binary.LittleEndian.PutUint32(data[32+152:], loadCommandCodeSignature)
+			binary.LittleEndian.PutUint32(data[32+152+4:], 8)
+			binary.LittleEndian.PutUint32(data[20:], 152+8)
+			return data
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := test.modify(testImage(cpuTypeARM64, fileTypeExecute))
+			file, err := Parse(data)
+			if test.name == "sections past the segment command" {
+				// The sections outside the command are ignored
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Errorf("no error, segments %v", file.Segments)
+			}
+		})
+	}
+}
+
+func TestMalformedUniversalBinary(t *testing.T) {
+	empty := make([]byte, 8)
+	binary.BigEndian.PutUint32(empty, magicFat)
+	if _, err := SplitFat(empty); err == nil {
+		t.Error("no error for a universal binary without architectures")
+	}
+	if _, err := ReadSignatures(empty); err == nil {
+		t.Error("no signature error for a universal binary without architectures")
+	}
+
+	tests := []struct {
+		name   string
+		fat64  bool
+		modify func(data []byte)
+	}{
+		{"slice past the end of the file", false, func(data []byte) { binary.BigEndian.PutUint32(data[20:], 0xffffffff) }},
+		{"alignment too large", false, func(data []byte) { binary.BigEndian.PutUint32(data[24:], 64) }},
+		{"unaligned slice", false, func(data []byte) { binary.BigEndian.PutUint32(data[16:], 0x1000) }},
+		{"64-bit slice past the end of the file", true, func(data []byte) { binary.BigEndian.PutUint64(data[24:], 1<<40) }},
+		{"64-bit alignment too large", true, func(data []byte) { binary.BigEndian.PutUint32(data[32:], 16) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := testFat(t, test.fat64, Arch{CPUType: cpuTypeARM64, Align: 14, Data: testImage(cpuTypeARM64, fileTypeExecute)})
+			test.modify(data)
+			if _, err := SplitFat(data); err == nil {
+				t.Error("no error")
+			}
+		})
+	}
+}
+
+func TestBuildFat(t *testing.T) {
+	arches := []Arch{
+		{CPUType: cpuTypeARM64, Align: 14, Data: testImage(cpuTypeARM64, fileTypeExecute)},
+		{CPUType: cpuTypeX8664, Align: 12, Data: testImage(cpuTypeX8664, fileTypeExecute)},
+	}
+	for _, fat64 := range []bool{false, true} {
+		data := testFat(t, fat64, arches...)
+		if IsFat64(data) != fat64 {
+			t.Errorf("fat64 %v, built %v", fat64, IsFat64(data))
+		}
+		split, err := SplitFat(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range arches {
+			if split[i].CPUType != arches[i].CPUType || split[i].Align != arches[i].Align || string(split[i].Data) != string(arches[i].Data) {
+				t.Errorf("fat64 %v: slice %d changed", fat64, i)
+			}
+		}
+
+		// Signing keeps the format
+		signed, err := Sign(data, SignatureParams{Identifier: "com.example.test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if IsFat64(signed) != fat64 {
+			t.Errorf("fat64 %v, signed %v", fat64, IsFat64(signed))
+		}
+	}
+
+	if _, err := BuildFat([]Arch{{CPUType: cpuTypeARM64, Align: 64, Data: arches[0].Data}}, false); err == nil {
+		t.Error("no error for a 2^64 alignment")
+	}
+}
+
+func TestParseCodeDirectoryMalformed(t *testing.T) {
+	blob := make([]byte, 64)
+	binary.BigEndian.PutUint32(blob, magicCodeDirectory)
+	binary.BigEndian.PutUint32(blob[4:], 12)
+	if _, err := ParseCodeDirectory(blob); err == nil {
+		t.Error("no error for a code directory smaller than its header")
+	}
+}
+
+func TestIsSignableFile(t *testing.T) {
+	folder := t.TempDir()
+	tests := []struct {
+		fileType uint32
+		fat      bool
+		signable bool
+	}{
+		{fileTypeExecute, false, true},
+		{fileTypeDylib, false, true},
+		{fileTypeBundle, false, true},
+		{0x1, false, false},
+		{0xa, false, false},
+		{fileTypeDylib, true, true},
+		{0x1, true, false},
+	}
+
+	for i, test := range tests {
+		data := testImage(cpuTypeARM64, test.fileType)
+		if test.fat {
+			data = testFat(t, false, Arch{CPUType: cpuTypeARM64, Align: 14, Data: data})
+		}
+		path := filepath.Join(folder, fmt.Sprint(i))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		signable, err := IsSignableFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signable != test.signable {
+			t.Errorf("file type %#x (universal %v) signable %v", test.fileType, test.fat, signable)
+		}
+	}
+}
+
+func TestBERToDER(t *testing.T) {
+	tests := []struct {
+		name     string
+		ber      string
+		expected string
+	}{
+		{"definite", "3003020101", "3003020101"},
+		{"indefinite sequence", "308002010130000201020000", "30080201013000020102"},
+		{"constructed octet string", "2480040261620401630000", "0403616263"},
+		{"octet string in an explicit tag", "a080248004016104016200000000", "a00404026162"},
+		{"primitive with an indefinite length", "0480", ""},
+		{"missing end of contents", "30800201", ""},
+		{"integer in an octet string", "2480020101000000", ""},
+		{"trailing data", "300000", ""},
+	}
+
+	for _, test := range tests {
+		ber, _ := hex.DecodeString(test.ber)
+		der, err := berToDER(ber)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("%s: no error, %x", test.name, der)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if hex.EncodeToString(der) != test.expected {
+			t.Errorf("%s: %x, expected %s", test.name, der, test.expected)
+		}
+	}
+
+	deep := bytes.Repeat([]byte{0x30, 0x80}, maxBERDepth+2)
+	if _, err := berToDER(deep); err == nil {
+		t.Error("no error for deeply nested elements")
+	}
+}
@@ -0,0 +1,542 @@
+package macho
+
+import (
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Kinds of the tokens of the requirement language
+const (
+	tokenEnd = iota
+	tokenWord
+	tokenString
+	tokenHash
+	tokenSymbol
+)
+
+type requirementToken struct {
+	kind  int
+	value string
+}
+
+// Symbols of the requirement language, the longest first
+var requirementSymbols = []string{"=>", "<=", ">=", "&&", "||", "(", ")", "[", "]", "!", "=", "~", "<", ">", "*", ";"}
+
+// Split a text of the requirement language into tokens
+func tokenizeRequirements(text string) ([]requirementToken, error) {
+	var tokens []requirementToken
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case c == '#':
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case c == '"' || (c == 'H' && i+1 < len(text) && text[i+1] == '"'):
+			kind := tokenString
+			if c == 'H' {
+				kind = tokenHash
+				i++
+			}
+			var value strings.Builder
+			i++
+			for ; i < len(text) && text[i] != '"'; i++ {
+				if text[i] == '\\' && i+1 < len(text) {
+					i++
+				}
+				value.WriteByte(text[i])
+			}
+			if i >= len(text) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			i++
+			tokens = append(tokens, requirementToken{kind, value.String()})
+		case isRequirementWordChar(c):
+			start := i
+			for i < len(text) && isRequirementWordChar(text[i]) {
+				i++
+			}
+			tokens = append(tokens, requirementToken{tokenWord, text[start:i]})
+		default:
+			symbol := ""
+			for _, candidate := range requirementSymbols {
+				if strings.HasPrefix(text[i:], candidate) {
+					symbol = candidate
+					break
+				}
+			}
+			if symbol == "" {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			i += len(symbol)
+			tokens = append(tokens, requirementToken{tokenSymbol, symbol})
+		}
+	}
+	return append(tokens, requirementToken{kind: tokenEnd}), nil
+}
+
+func isRequirementWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-' || c == '/' || c == '$' || c >= 0x80
+}
+
+// Compiler of the requirement language
+type requirementParser struct {
+	tokens []requirementToken
+	offset int
+}
+
+func (parser *requirementParser) peek() requirementToken {
+	return parser.tokens[parser.offset]
+}
+
+func (parser *requirementParser) next() requirementToken {
+	token := parser.tokens[parser.offset]
+	if token.kind != tokenEnd {
+		parser.offset++
+	}
+	return token
+}
+
+// Check if the next token is the symbol or the keyword, and consume it
+func (parser *requirementParser) accept(values ...string) bool {
+	token := parser.peek()
+	if token.kind != tokenSymbol && token.kind != tokenWord {
+		return false
+	}
+	for _, value := range values {
+		if token.value == value {
+			parser.offset++
+			return true
+		}
+	}
+	return false
+}
+
+func (parser *requirementParser) expect(value string) error {
+	if !parser.accept(value) {
+		return parser.unexpected("expected " + strconv.Quote(value))
+	}
+	return nil
+}
+
+func (parser *requirementParser) unexpected(message string) error {
+	token := parser.peek()
+	if token.kind == tokenEnd {
+		return fmt.Errorf("%s at the end of the requirement", message)
+	}
+	return fmt.Errorf("%s, found %q", message, token.value)
+}
+
+// Compile a text of the requirement language, one or more "type => expression" entries, to a requirements set
+// A single expression without type is the designated requirement
+func CompileRequirements(text string) ([]byte, error) {
+	tokens, err := tokenizeRequirements(text)
+	if err != nil {
+		return nil, err
+	}
+	parser := &requirementParser{tokens: tokens}
+
+	requirements := map[uint32][]byte{}
+	for parser.peek().kind != tokenEnd {
+		requirementType := uint32(RequirementDesignated)
+		if parser.tokens[parser.offset+1].value == "=>" {
+			requirementType, err = parser.requirementType()
+			if err != nil {
+				return nil, err
+			}
+			parser.next()
+		} else if parser.offset > 0 {
+			return nil, parser.unexpected("expected a requirement type")
+		}
+
+		if _, ok := requirements[requirementType]; ok {
+			return nil, fmt.Errorf("duplicated %s requirement", requirementTypeNames[requirementType])
+		}
+
+		expression, err := parser.or()
+		if err != nil {
+			return nil, err
+		}
+		requirements[requirementType] = makeRequirement(expression)
+		parser.accept(";")
+	}
+
+	if len(requirements) == 0 {
+		return nil, fmt.Errorf("empty requirements")
+	}
+	return MakeRequirements(requirements), nil
+}
+
+// Compile a single expression of the requirement language to a requirement blob
+func CompileRequirement(text string) ([]byte, error) {
+	tokens, err := tokenizeRequirements(text)
+	if err != nil {
+		return nil, err
+	}
+	parser := &requirementParser{tokens: tokens}
+
+	expression, err := parser.or()
+	if err != nil {
+		return nil, err
+	}
+	if parser.peek().kind != tokenEnd {
+		return nil, parser.unexpected("unexpected text after the requirement")
+	}
+	return makeRequirement(expression), nil
+}
+
+func (parser *requirementParser) requirementType() (uint32, error) {
+	token := parser.next()
+	for requirementType, name := range requirementTypeNames {
+		if token.value == name {
+			return requirementType, nil
+		}
+	}
+	if value, err := strconv.ParseUint(token.value, 10, 32); err == nil {
+		return uint32(value), nil
+	}
+	return 0, fmt.Errorf("unknown requirement type %q", token.value)
+}
+
+// Binary operators are left associative: a and b and c is (a and b) and c
+func (parser *requirementParser) or() ([]byte, error) {
+	left, err := parser.and()
+	if err != nil {
+		return nil, err
+	}
+	for parser.accept("or", "||") {
+		right, err := parser.and()
+		if err != nil {
+			return nil, err
+		}
+		left = append(append(binary.BigEndian.AppendUint32(nil, opOr), left...), right...)
+	}
+	return left, nil
+}
+
+func (parser *requirementParser) and() ([]byte, error) {
+	left, err := parser.unary()
+	if err != nil {
+		return nil, err
+	}
+	for parser.accept("and", "&&") {
+		right, err := parser.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = append(append(binary.BigEndian.AppendUint32(nil, opAnd), left...), right...)
+	}
+	return left, nil
+}
+
+func (parser *requirementParser) unary() ([]byte, error) {
+	if parser.accept("!") {
+		operand, err := parser.unary()
+		if err != nil {
+			return nil, err
+		}
+		return append(binary.BigEndian.AppendUint32(nil, opNot), operand...), nil
+	}
+	return parser.primary()
+}
+
+func (parser *requirementParser) primary() ([]byte, error) {
+	writer := &requirementWriter{}
+
+	if parser.accept("(") {
+		expression, err := parser.or()
+		if err != nil {
+			return nil, err
+		}
+		return expression, parser.expect(")")
+	}
+
+	token := parser.peek()
+	if token.kind != tokenWord {
+		return nil, parser.unexpected("expected a requirement")
+	}
+	parser.next()
+
+	switch token.value {
+	case "always", "true":
+		writer.uint32(opTrue)
+	case "never", "false":
+		writer.uint32(opFalse)
+	case "notarized":
+		writer.uint32(opNotarized)
+	case "legacy":
+		writer.uint32(opLegacyDevID)
+	case "identifier":
+		parser.accept("=")
+		value, err := parser.value()
+		if err != nil {
+			return nil, err
+		}
+		writer.uint32(opIdent)
+		writer.bytes(value)
+	case "cdhash":
+		parser.accept("=")
+		hash, err := parser.hash()
+		if err != nil {
+			return nil, err
+		}
+		writer.uint32(opCDHash)
+		writer.bytes(hash)
+	case "platform":
+		if err := parser.expect("="); err != nil {
+			return nil, err
+		}
+		platform, err := strconv.ParseUint(parser.next().value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid platform: %s", err)
+		}
+		writer.uint32(opPlatform)
+		writer.uint32(uint32(platform))
+	case "anchor":
+		switch {
+		case parser.accept("apple"):
+			if parser.accept("generic") {
+				writer.uint32(opAppleGenericAnchor)
+			} else if next := parser.peek(); next.kind == tokenWord && next.value != "and" && next.value != "or" && parser.tokens[parser.offset+1].value != "=>" {
+				// A word followed by => is the type of the next requirement
+				parser.next()
+				writer.uint32(opNamedAnchor)
+				writer.bytes([]byte(next.value))
+			} else {
+				writer.uint32(opAppleAnchor)
+			}
+		case parser.accept("trusted"):
+			writer.uint32(opTrustedCerts)
+		default:
+			// anchor = H"hash" pins the root certificate
+			parser.accept("=")
+			hash, err := parser.hash()
+			if err != nil {
+				return nil, err
+			}
+			root := int32(certificateRoot)
+			writer.uint32(opAnchorHash)
+			writer.uint32(uint32(root))
+			writer.bytes(hash)
+		}
+	case "certificate", "cert":
+		return parser.certificate()
+	case "info", "entitlement":
+		if err := parser.expect("["); err != nil {
+			return nil, err
+		}
+		key, err := parser.value()
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.expect("]"); err != nil {
+			return nil, err
+		}
+		match, err := parser.match()
+		if err != nil {
+			return nil, err
+		}
+		if token.value == "info" {
+			writer.uint32(opInfoKeyField)
+		} else {
+			writer.uint32(opEntitlementField)
+		}
+		writer.bytes(key)
+		writer.data = append(writer.data, match...)
+	default:
+		parser.offset--
+		return nil, parser.unexpected("unknown requirement")
+	}
+
+	return writer.data, nil
+}
+
+// Compile the certificate requirements: certificate <slot> (= hash | trusted | [field] match)
+func (parser *requirementParser) certificate() ([]byte, error) {
+	writer := &requirementWriter{}
+
+	var slot int32
+	switch token := parser.next(); token.value {
+	case "leaf":
+		slot = certificateLeaf
+	case "root", "anchor":
+		slot = certificateRoot
+	default:
+		value, err := strconv.ParseInt(token.value, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate slot %q", token.value)
+		}
+		slot = int32(value)
+	}
+
+	switch {
+	case parser.accept("="):
+		hash, err := parser.hash()
+		if err != nil {
+			return nil, err
+		}
+		writer.uint32(opAnchorHash)
+		writer.uint32(uint32(slot))
+		writer.bytes(hash)
+	case parser.accept("trusted"):
+		writer.uint32(opTrustedCert)
+		writer.uint32(uint32(slot))
+	case parser.accept("["):
+		field, err := parser.value()
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.expect("]"); err != nil {
+			return nil, err
+		}
+		match, err := parser.match()
+		if err != nil {
+			return nil, err
+		}
+
+		op := uint32(opCertField)
+		for prefix, prefixOp := range map[string]uint32{"field.": opCertGeneric, "policy.": opCertPolicy, "timestamp.": opCertFieldDate} {
+			if oid := strings.TrimPrefix(string(field), prefix); oid != string(field) {
+				op = prefixOp
+				field, err = encodeOID(oid)
+				if err != nil {
+					return nil, err
+				}
+				break
+			}
+		}
+
+		writer.uint32(op)
+		writer.uint32(uint32(slot))
+		writer.bytes(field)
+		writer.data = append(writer.data, match...)
+	default:
+		return nil, parser.unexpected("expected =, trusted or [field] after the certificate")
+	}
+
+	return writer.data, nil
+}
+
+// Compile a match operation and its value, a missing operation checks that the value exists
+func (parser *requirementParser) match() ([]byte, error) {
+	writer := &requirementWriter{}
+
+	if parser.accept("exists") {
+		writer.uint32(matchExists)
+		return writer.data, nil
+	}
+	if parser.accept("absent") {
+		writer.uint32(matchAbsent)
+		return writer.data, nil
+	}
+
+	operators := map[string]uint32{"=": matchEqual, "~": matchContains, "<": matchLessThan, ">": matchGreaterThan, "<=": matchLessEqual, ">=": matchGreaterEqual}
+	dateOperators := map[string]uint32{"=": matchOn, "<": matchBefore, ">": matchAfter, "<=": matchOnOrBefore, ">=": matchOnOrAfter}
+
+	token := parser.peek()
+	op, ok := operators[token.value]
+	if token.kind != tokenSymbol || !ok {
+		writer.uint32(matchExists)
+		return writer.data, nil
+	}
+	parser.next()
+
+	if parser.accept("timestamp") {
+		value, err := parser.value()
+		if err != nil {
+			return nil, err
+		}
+		date, err := time.Parse("2006-01-02 15:04:05 -0700", string(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", value)
+		}
+		seconds := date.Sub(absoluteTimeEpoch).Seconds()
+		writer.uint32(dateOperators[token.value])
+		writer.bytes(binary.BigEndian.AppendUint64(nil, math.Float64bits(seconds)))
+		return writer.data, nil
+	}
+
+	// Wildcards: = *value* contains, = value* begins with, = *value ends with
+	leading := op == matchEqual && parser.accept("*")
+	value, err := parser.value()
+	if err != nil {
+		return nil, err
+	}
+	trailing := op == matchEqual && parser.accept("*")
+
+	switch {
+	case leading && trailing:
+		op = matchContains
+	case leading:
+		op = matchEndsWith
+	case trailing:
+		op = matchBeginsWith
+	}
+
+	writer.uint32(op)
+	writer.bytes(value)
+	return writer.data, nil
+}
+
+// Read a string, a word or a hash value
+func (parser *requirementParser) value() ([]byte, error) {
+	switch token := parser.peek(); token.kind {
+	case tokenString, tokenWord:
+		parser.next()
+		return []byte(token.value), nil
+	case tokenHash:
+		parser.next()
+		return decodeHash(token.value)
+	}
+	return nil, parser.unexpected("expected a value")
+}
+
+func (parser *requirementParser) hash() ([]byte, error) {
+	token := parser.peek()
+	if token.kind != tokenHash {
+		return nil, parser.unexpected("expected a hash H\"...\"")
+	}
+	parser.next()
+	return decodeHash(token.value)
+}
+
+func decodeHash(value string) ([]byte, error) {
+	hash, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hash %q", value)
+	}
+	return hash, nil
+}
+
+// Encode a dotted OID without its DER tag and length
+func encodeOID(text string) ([]byte, error) {
+	var oid asn1.ObjectIdentifier
+	for _, part := range strings.Split(text, ".") {
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", text)
+		}
+		oid = append(oid, value)
+	}
+
+	der, err := asn1.Marshal(oid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OID %q: %s", text, err)
+	}
+	return der[2:], nil
+}
@@ -0,0 +1,199 @@
+package macho
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// Requirements and their blobs as written by csreq -b
+var compiledRequirements = []struct {
+	text string
+	blob string
+}{
+	{
+		`anchor apple`,
+		"fade0c00000000100000000100000003",
+	},
+	{
+		`identifier "com.apple.Safari" and anchor apple`,
+		"fade0c000000002c00000001000000060000000200000010636f6d2e6170706c652e53616661726900000003",
+	},
+	{
+		`identifier "com.example.app" and anchor apple generic and certificate leaf[subject.CN] = "Apple Development: Jane Doe (ABCDE12345)" and certificate 1[field.1.2.840.113635.100.6.2.1] /* exists */`,
+		"fade0c000000009800000001000000060000000600000006000000020000000f636f6d2e6578616d706c652e617070000000000f0000000b000000000000000a7375626a6563742e434e000000000001000000284170706c6520446576656c6f706d656e743a204a616e6520446f65202841424344453132333435290000000e000000010000000a2a864886f76364060201000000000000",
+	},
+	{
+		`identifier "com.example.app" and certificate leaf = H"0123456789abcdef0123456789abcdef01234567"`,
+		"fade0c00000000480000000100000006000000020000000f636f6d2e6578616d706c652e617070000000000400000000000000140123456789abcdef0123456789abcdef01234567",
+	},
+	{
+		`info[CFBundleShortVersionString] >= "1.0" or entitlement["com.apple.security.app-sandbox"] exists`,
+		"fade0c000000006c00000001000000070000000a0000001a434642756e646c6553686f727456657273696f6e537472696e6700000000000800000003312e3000000000100000001e636f6d2e6170706c652e73656375726974792e6170702d73616e64626f78000000000000",
+	},
+	{
+		`anchor apple generic and certificate leaf[field.1.2.840.113635.100.6.1.9] /* exists */ or anchor apple generic and certificate 1[field.1.2.840.113635.100.6.2.6] /* exists */ and certificate leaf[field.1.2.840.113635.100.6.1.13] /* exists */ and certificate leaf[subject.OU] = TEAM123456`,
+		"fade0c00000000a80000000100000007000000060000000f0000000e000000000000000a2a864886f763640601090000000000000000000600000006000000060000000f0000000e000000010000000a2a864886f763640602060000000000000000000e000000000000000a2a864886f7636406010d0000000000000000000b000000000000000a7375626a6563742e4f550000000000010000000a5445414d3132333435360000",
+	},
+	{
+		`!cdhash H"0123456789abcdef0123456789abcdef01234567"`,
+		"fade0c000000002c000000010000000900000008000000140123456789abcdef0123456789abcdef01234567",
+	},
+}
+
+func TestCompileRequirement(t *testing.T) {
+	for _, test := range compiledRequirements {
+		blob, err := CompileRequirement(test.text)
+		if err != nil {
+			t.Errorf("%s: %s", test.text, err)
+			continue
+		}
+		if hex.EncodeToString(blob) != test.blob {
+			t.Errorf("%s:\ncompiled %x\nexpected %s", test.text, blob, test.blob)
+		}
+	}
+}
+
+func TestCompileRequirements(t *testing.T) {
+	expected := "fade0c010000003c00000002000000010000001c000000030000002cfade0c0000000010000000010000000ffade0c00000000100000000100000003"
+	for _, text := range []string{
+		"designated => anchor apple\nhost => anchor apple generic",
+		"host => anchor apple generic; designated => anchor apple",
+	} {
+		blob, err := CompileRequirements(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(blob) != expected {
+			t.Errorf("%q:\ncompiled %x\nexpected %s", text, blob, expected)
+		}
+	}
+
+	// A single expression is the designated requirement
+	blob, err := CompileRequirements("anchor apple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(blob) != "fade0c0100000024000000010000000300000014fade0c00000000100000000100000003" {
+		t.Errorf("compiled %x", blob)
+	}
+
+	for _, text := range []string{"", "designated => anchor apple; designated => anchor apple", "anchor apple anchor apple", "unknown => anchor apple", "identifier"} {
+		if _, err := CompileRequirements(text); err == nil {
+			t.Errorf("no error for %q", text)
+		}
+	}
+}
+
+func mustDecodeHex(t *testing.T, text string) []byte {
+	t.Helper()
+
+	data, err := hex.DecodeString(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Create a certificate issued by a certificate authority of the organization
+func testIssuedCertificate(t *testing.T, organization string, commonName string) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authority := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: organization + " Certification Authority", Organization: []string{organization}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, leaf, authority, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certificate
+}
+
+func TestCompileDefaultDesignatedRequirement(t *testing.T) {
+	apple := testIssuedCertificate(t, "Apple Inc.", "Apple Development: Jane Doe (ABCDE12345)")
+	other := testIssuedCertificate(t, "Example", "Example Developer")
+	otherHash := sha1.Sum(other.Raw)
+
+	tests := []struct {
+		certificate *x509.Certificate
+		text        string
+	}{
+		{apple, `identifier "com.example.app" and anchor apple generic and certificate leaf[subject.CN] = "Apple Development: Jane Doe (ABCDE12345)" and certificate 1[field.1.2.840.113635.100.6.2.1] /* exists */`},
+		{other, fmt.Sprintf(`identifier "com.example.app" and certificate leaf = H"%x"`, otherHash)},
+	}
+
+	for _, test := range tests {
+		expected := DefaultDesignatedRequirement("com.example.app", test.certificate)
+		blob, err := CompileRequirement(test.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(blob, expected) {
+			t.Errorf("%s:\ncompiled %x\nexpected %x", test.text, blob, expected)
+		}
+	}
+}
+
+func TestFormatRequirementRoundTrip(t *testing.T) {
+	for _, test := range compiledRequirements {
+		blob := mustDecodeHex(t, test.blob)
+		text, err := FormatRequirement(blob)
+		if err != nil {
+			t.Errorf("%s: %s", test.text, err)
+			continue
+		}
+		compiled, err := CompileRequirement(text)
+		if err != nil {
+			t.Errorf("%s: the formatted requirement %q does not compile: %s", test.text, text, err)
+			continue
+		}
+		if !bytes.Equal(compiled, blob) {
+			t.Errorf("%s: the formatted requirement %q compiles to %x", test.text, text, compiled)
+		}
+	}
+
+	set := mustDecodeHex(t, "fade0c010000003c00000002000000010000001c000000030000002cfade0c0000000010000000010000000ffade0c00000000100000000100000003")
+	text, err := FormatRequirements(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "host => anchor apple generic\ndesignated => anchor apple" {
+		t.Errorf("formatted %q", text)
+	}
+	compiled, err := CompileRequirements(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(compiled, set) {
+		t.Errorf("%q compiles to %x", text, compiled)
+	}
+}
@@ -0,0 +1,388 @@
+package macho
+
+import (
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Names of the requirement types in the requirement language
+var requirementTypeNames = map[uint32]string{
+	1: "host",
+	2: "guest",
+	3: "designated",
+	4: "library",
+	5: "plugin",
+}
+
+// Precedence levels of the requirement operators, used to place the parentheses
+const (
+	levelOr = iota
+	levelAnd
+	levelPrimary
+)
+
+// Reference date of the timestamps stored in the requirements (CFAbsoluteTime)
+var absoluteTimeEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Decoder of requirement expressions
+type requirementReader struct {
+	data   []byte
+	offset int
+}
+
+func (reader *requirementReader) uint32() (uint32, error) {
+	if reader.offset+4 > len(reader.data) {
+		return 0, fmt.Errorf("truncated requirement")
+	}
+	value := binary.BigEndian.Uint32(reader.data[reader.offset:])
+	reader.offset += 4
+	return value, nil
+}
+
+// Read length prefixed data, padded to 4 bytes
+func (reader *requirementReader) bytes() ([]byte, error) {
+	length, err := reader.uint32()
+	if err != nil {
+		return nil, err
+	}
+	if int(length) > len(reader.data)-reader.offset {
+		return nil, fmt.Errorf("truncated requirement")
+	}
+	value := reader.data[reader.offset : reader.offset+int(length)]
+	reader.offset = align(reader.offset+int(length), 4)
+	return value, nil
+}
+
+// Parse a requirements set into requirement blobs indexed by requirement type
+func ParseRequirements(blob []byte) (map[uint32][]byte, error) {
+	return parseSuperBlob(blob, magicRequirements)
+}
+
+// Decompile a requirements set to the requirement language, one requirement per line
+func FormatRequirements(blob []byte) (string, error) {
+	requirements, err := ParseRequirements(blob)
+	if err != nil {
+		return "", err
+	}
+
+	var types []uint32
+	for requirementType := range requirements {
+		types = append(types, requirementType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	var lines []string
+	for _, requirementType := range types {
+		text, err := FormatRequirement(requirements[requirementType])
+		if err != nil {
+			return "", err
+		}
+
+		name, ok := requirementTypeNames[requirementType]
+		if !ok {
+			name = fmt.Sprintf("%d", requirementType)
+		}
+		lines = append(lines, name+" => "+text)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// Decompile a requirement blob to the requirement language
+func FormatRequirement(blob []byte) (string, error) {
+	if len(blob) < 12 || binary.BigEndian.Uint32(blob) != magicRequirement {
+		return "", fmt.Errorf("invalid requirement")
+	}
+	size := int(binary.BigEndian.Uint32(blob[4:]))
+	if size > len(blob) || size < 12 {
+		return "", fmt.Errorf("truncated requirement")
+	}
+	if kind := binary.BigEndian.Uint32(blob[8:]); kind != 1 {
+		return "", fmt.Errorf("unsupported requirement kind %d", kind)
+	}
+
+	reader := &requirementReader{data: blob[12:size]}
+	text, err := reader.expression(levelOr)
+	if err != nil {
+		return "", err
+	}
+	if reader.offset != len(reader.data) {
+		return "", fmt.Errorf("trailing data after the requirement expression")
+	}
+	return text, nil
+}
+
+// Decompile the next expression, with parentheses when its operator binds less than level
+func (reader *requirementReader) expression(level int) (string, error) {
+	op, err := reader.uint32()
+	if err != nil {
+		return "", err
+	}
+
+	switch op &^ opFlagMask {
+	case opFalse:
+		return "never", nil
+	case opTrue:
+		return "always", nil
+	case opIdent:
+		identifier, err := reader.bytes()
+		if err != nil {
+			return "", err
+		}
+		return "identifier " + formatValue(identifier), nil
+	case opAppleAnchor:
+		return "anchor apple", nil
+	case opAppleGenericAnchor:
+		return "anchor apple generic", nil
+	case opTrustedCerts:
+		return "anchor trusted", nil
+	case opNotarized:
+		return "notarized", nil
+	case opLegacyDevID:
+		return "legacy", nil
+	case opAnchorHash:
+		slot, err := reader.certificateSlot()
+		if err != nil {
+			return "", err
+		}
+		hash, err := reader.bytes()
+		if err != nil {
+			return "", err
+		}
+		return "certificate " + slot + " = " + formatHash(hash), nil
+	case opTrustedCert:
+		slot, err := reader.certificateSlot()
+		if err != nil {
+			return "", err
+		}
+		return "certificate " + slot + " trusted", nil
+	case opCDHash:
+		hash, err := reader.bytes()
+		if err != nil {
+			return "", err
+		}
+		return "cdhash " + formatHash(hash), nil
+	case opNamedAnchor:
+		name, err := reader.bytes()
+		if err != nil {
+			return "", err
+		}
+		return "anchor apple " + string(name), nil
+	case opNamedCode:
+		name, err := reader.bytes()
+		if err != nil {
+			return "", err
+		}
+		return "(" + string(name) + ")", nil
+	case opPlatform:
+		platform, err := reader.uint32()
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("platform = %d", platform), nil
+	case opInfoKeyValue:
+		key, err := reader.bytes()
+		if err != nil {
+			return "", err
+		}
+		value, err := reader.bytes()
+		if err != nil {
+			return "", err
+		}
+		return "info[" + formatKey(key) + "] = " + formatValue(value), nil
+	case opInfoKeyField, opEntitlementField:
+		key, err := reader.bytes()
+		if err != nil {
+			return "", err
+		}
+		match, err := reader.match()
+		if err != nil {
+			return "", err
+		}
+		if op&^opFlagMask == opInfoKeyField {
+			return "info[" + formatKey(key) + "]" + match, nil
+		}
+		return "entitlement[" + formatValue(key) + "]" + match, nil
+	case opCertField, opCertGeneric, opCertPolicy, opCertFieldDate:
+		slot, err := reader.certificateSlot()
+		if err != nil {
+			return "", err
+		}
+		field, err := reader.bytes()
+		if err != nil {
+			return "", err
+		}
+		match, err := reader.match()
+		if err != nil {
+			return "", err
+		}
+
+		name := string(field)
+		switch op &^ opFlagMask {
+		case opCertGeneric:
+			name = "field." + formatOID(field)
+		case opCertPolicy:
+			name = "policy." + formatOID(field)
+		case opCertFieldDate:
+			name = "timestamp." + formatOID(field)
+		}
+		return "certificate " + slot + "[" + name + "]" + match, nil
+	case opNot:
+		operand, err := reader.expression(levelPrimary)
+		if err != nil {
+			return "", err
+		}
+		return "! " + operand, nil
+	case opAnd, opOr:
+		operatorLevel, keyword := levelAnd, " and "
+		if op&^opFlagMask == opOr {
+			operatorLevel, keyword = levelOr, " or "
+		}
+
+		left, err := reader.expression(operatorLevel)
+		if err != nil {
+			return "", err
+		}
+		right, err := reader.expression(operatorLevel)
+		if err != nil {
+			return "", err
+		}
+
+		text := left + keyword + right
+		if level > operatorLevel {
+			text = "(" + text + ")"
+		}
+		return text, nil
+	default:
+		return "", fmt.Errorf("unknown requirement operator %d", op)
+	}
+}
+
+// Decompile a certificate slot: leaf, root or its index in the chain
+func (reader *requirementReader) certificateSlot() (string, error) {
+	slot, err := reader.uint32()
+	if err != nil {
+		return "", err
+	}
+
+	switch int32(slot) {
+	case certificateLeaf:
+		return "leaf", nil
+	case certificateRoot:
+		return "root", nil
+	default:
+		return fmt.Sprintf("%d", int32(slot)), nil
+	}
+}
+
+// Decompile a match operation and its value
+func (reader *requirementReader) match() (string, error) {
+	op, err := reader.uint32()
+	if err != nil {
+		return "", err
+	}
+
+	switch op {
+	case matchExists:
+		return " /* exists */", nil
+	case matchAbsent:
+		return " absent", nil
+	case matchOn, matchBefore, matchAfter, matchOnOrBefore, matchOnOrAfter:
+		value, err := reader.bytes()
+		if err != nil {
+			return "", err
+		}
+		if len(value) != 8 {
+			return "", fmt.Errorf("invalid timestamp in requirement")
+		}
+		seconds := math.Float64frombits(binary.BigEndian.Uint64(value))
+		date := absoluteTimeEpoch.Add(time.Duration(seconds * float64(time.Second)))
+		operators := map[uint32]string{matchOn: "=", matchBefore: "<", matchAfter: ">", matchOnOrBefore: "<=", matchOnOrAfter: ">="}
+		return " " + operators[op] + " timestamp \"" + date.Format("2006-01-02 15:04:05 -0700") + "\"", nil
+	}
+
+	value, err := reader.bytes()
+	if err != nil {
+		return "", err
+	}
+	text := formatValue(value)
+
+	switch op {
+	case matchEqual:
+		return " = " + text, nil
+	case matchContains:
+		return " ~ " + text, nil
+	case matchBeginsWith:
+		return " = " + text + "*", nil
+	case matchEndsWith:
+		return " = *" + text, nil
+	case matchLessThan:
+		return " < " + text, nil
+	case matchGreaterThan:
+		return " > " + text, nil
+	case matchLessEqual:
+		return " <= " + text, nil
+	case matchGreaterEqual:
+		return " >= " + text, nil
+	default:
+		return "", fmt.Errorf("unknown requirement match operator %d", op)
+	}
+}
+
+// Format a value as a quoted string, or as hexadecimal data when it is not printable
+func formatValue(value []byte) string {
+	if !isPrintable(value) {
+		return formatHash(value)
+	}
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(string(value)) + "\""
+}
+
+// Format a key, quoted only when it is not a plain word
+func formatKey(key []byte) string {
+	for _, r := range string(key) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '.' && r != '-' {
+			return formatValue(key)
+		}
+	}
+	if len(key) == 0 {
+		return "\"\""
+	}
+	return string(key)
+}
+
+func formatHash(hash []byte) string {
+	return "H\"" + hex.EncodeToString(hash) + "\""
+}
+
+// Format an OID stored without its DER tag and length
+func formatOID(raw []byte) string {
+	var oid asn1.ObjectIdentifier
+	der := append([]byte{0x06, byte(len(raw))}, raw...)
+	if len(raw) > 127 {
+		return hex.EncodeToString(raw)
+	}
+	if _, err := asn1.Unmarshal(der, &oid); err != nil {
+		return hex.EncodeToString(raw)
+	}
+	return oid.String()
+}
+
+func isPrintable(value []byte) bool {
+	if !utf8.Valid(value) {
+		return false
+	}
+	for _, r := range string(value) {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
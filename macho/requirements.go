@@ -0,0 +1,169 @@
+package macho
+
+import (
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"sort"
+	"strings"
+)
+
+// Operators of the requirement expressions
+const (
+	opFalse              = 0
+	opTrue               = 1
+	opIdent              = 2
+	opAppleAnchor        = 3
+	opAnchorHash         = 4
+	opInfoKeyValue       = 5
+	opAnd                = 6
+	opOr                 = 7
+	opCDHash             = 8
+	opNot                = 9
+	opInfoKeyField       = 10
+	opCertField          = 11
+	opTrustedCert        = 12
+	opTrustedCerts       = 13
+	opCertGeneric        = 14
+	opAppleGenericAnchor = 15
+	opEntitlementField   = 16
+	opCertPolicy         = 17
+	opNamedAnchor        = 18
+	opNamedCode          = 19
+	opPlatform           = 20
+	opNotarized          = 21
+	opCertFieldDate      = 22
+	opLegacyDevID        = 23
+
+	// Flags stored in the high byte of the operators
+	opFlagMask = 0xff000000
+)
+
+// Match operators of the requirement expressions
+const (
+	matchExists       = 0
+	matchEqual        = 1
+	matchContains     = 2
+	matchBeginsWith   = 3
+	matchEndsWith     = 4
+	matchLessThan     = 5
+	matchGreaterThan  = 6
+	matchLessEqual    = 7
+	matchGreaterEqual = 8
+	matchOn           = 9
+	matchBefore       = 10
+	matchAfter        = 11
+	matchOnOrBefore   = 12
+	matchOnOrAfter    = 13
+	matchAbsent       = 14
+)
+
+// Certificate slots with a name in the requirement language
+const (
+	certificateLeaf = 0
+	certificateRoot = -1
+)
+
+// Requirement types of a requirements set
+const RequirementDesignated = 3
+
+// Certificate extension marking Apple's WWDR intermediate authority
+var oidAppleWWDRIntermediate = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 2, 1}
+
+// Encoder of requirement expressions
+type requirementWriter struct {
+	data []byte
+}
+
+func (writer *requirementWriter) uint32(value uint32) {
+	writer.data = binary.BigEndian.AppendUint32(writer.data, value)
+}
+
+// Write length prefixed data, padded to 4 bytes
+func (writer *requirementWriter) bytes(value []byte) {
+	writer.uint32(uint32(len(value)))
+	writer.data = append(writer.data, value...)
+	for len(writer.data)%4 != 0 {
+		writer.data = append(writer.data, 0)
+	}
+}
+
+// Wrap a requirement expression in a requirement blob
+func makeRequirement(expression []byte) []byte {
+	// The requirement kind is 1 (expression form)
+	return makeBlob(magicRequirement, append([]byte{0, 0, 0, 1}, expression...))
+}
+
+// Build a requirements set from requirement blobs indexed by requirement type
+func MakeRequirements(requirements map[uint32][]byte) []byte {
+	var types []uint32
+	for requirementType := range requirements {
+		types = append(types, requirementType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	header := make([]byte, 4+8*len(types))
+	binary.BigEndian.PutUint32(header, uint32(len(types)))
+
+	offset := 8 + len(header)
+	var content []byte
+	for i, requirementType := range types {
+		binary.BigEndian.PutUint32(header[4+8*i:], requirementType)
+		binary.BigEndian.PutUint32(header[8+8*i:], uint32(offset))
+		content = append(content, requirements[requirementType]...)
+		offset += len(requirements[requirementType])
+	}
+
+	return makeBlob(magicRequirements, append(header, content...))
+}
+
+// Build the designated requirement codesign generates for an identifier and a certificate
+// Certificates issued by Apple are pinned by their common name and Apple's anchor,
+// other certificates are pinned by their hash
+func DefaultDesignatedRequirement(identifier string, certificate *x509.Certificate) []byte {
+	writer := &requirementWriter{}
+
+	if isAppleIssued(certificate) {
+		// identifier "id" and anchor apple generic and certificate leaf[subject.CN] = "name"
+		// and certificate 1[field.1.2.840.113635.100.6.2.1] exists
+		writer.uint32(opAnd)
+		writer.uint32(opAnd)
+		writer.uint32(opAnd)
+		writer.uint32(opIdent)
+		writer.bytes([]byte(identifier))
+		writer.uint32(opAppleGenericAnchor)
+		writer.uint32(opCertField)
+		writer.uint32(0)
+		writer.bytes([]byte("subject.CN"))
+		writer.uint32(matchEqual)
+		writer.bytes([]byte(certificate.Subject.CommonName))
+		writer.uint32(opCertGeneric)
+		writer.uint32(1)
+		oid, _ := asn1.Marshal(oidAppleWWDRIntermediate)
+		// The OID is stored without its DER tag and length
+		writer.bytes(oid[2:])
+		writer.uint32(matchExists)
+	} else {
+		// identifier "id" and certificate leaf = H"sha1"
+		hash := sha1.Sum(certificate.Raw)
+		writer.uint32(opAnd)
+		writer.uint32(opIdent)
+		writer.bytes([]byte(identifier))
+		writer.uint32(opAnchorHash)
+		writer.uint32(0)
+		writer.bytes(hash[:])
+	}
+
+	return makeRequirement(writer.data)
+}
+
+// Check if the certificate has been issued by Apple
+func isAppleIssued(certificate *x509.Certificate) bool {
+	for _, organization := range certificate.Issuer.Organization {
+		if strings.HasPrefix(organization, "Apple") {
+			return true
+		}
+	}
+	return false
+}
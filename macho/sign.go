@@ -0,0 +1,246 @@
+package macho
+
+import (
+	"fmt"
+
+	"howett.net/plist"
+)
+
+// Parameters of an embedded signature
+type SignatureParams struct {
+	Identifier string
+	TeamID     string
+
+	// Content of the Info.plist and _CodeSignature/CodeResources files of the bundle,
+	// nil when the file is not the main executable of a bundle
+	InfoPlist     []byte
+	CodeResources []byte
+
+	// Entitlements plist, nil when the file has no entitlements
+	Entitlements []byte
+
+	// Requirements set, the default designated requirement is used when nil
+	Requirements []byte
+
+	// CodeDirectory flags
+	Flags uint32
+
+	// Identity used for the CMS signature, the file is signed ad-hoc when nil
+	Identity *Identity
+
+	// URL of the RFC 3161 server timestamping the CMS signature, no timestamp when empty
+	TimestampServer string
+}
+
+// Blobs of the signature that do not depend on the code
+type signatureBlobs struct {
+	requirements    []byte
+	entitlements    []byte
+	entitlementsDER []byte
+	execSegFlags    uint64
+}
+
+func (params SignatureParams) blobs(file *File) (signatureBlobs, error) {
+	var blobs signatureBlobs
+
+	blobs.requirements = params.Requirements
+	if blobs.requirements == nil {
+		requirements := map[uint32][]byte{}
+		if params.Identity != nil {
+			requirements[RequirementDesignated] = DefaultDesignatedRequirement(params.Identifier, params.Identity.Certificate)
+		}
+		blobs.requirements = MakeRequirements(requirements)
+	}
+
+	if file.FileType == fileTypeExecute {
+		blobs.execSegFlags |= execSegMainBinary
+	}
+
+	if params.Entitlements != nil {
+		blobs.entitlements = makeBlob(magicEntitlements, params.Entitlements)
+
+		der, err := EntitlementsToDER(params.Entitlements)
+		if err != nil {
+			return blobs, err
+		}
+		blobs.entitlementsDER = makeBlob(magicEntitlementsDER, der)
+
+		var entitlements map[string]interface{}
+		plist.Unmarshal(params.Entitlements, &entitlements)
+		if allowed, _ := entitlements["get-task-allow"].(bool); allowed {
+			blobs.execSegFlags |= execSegAllowUnsigned
+		}
+	}
+
+	return blobs, nil
+}
+
+// Hashes of the special slots, indexed from slot 1
+func (params SignatureParams) specialSlots(blobs signatureBlobs, hashType uint8) [][]byte {
+	slots := map[int][]byte{
+		SlotInfoPlist:         params.InfoPlist,
+		SlotRequirements:      blobs.requirements,
+		SlotResourceDirectory: params.CodeResources,
+		SlotEntitlements:      blobs.entitlements,
+		SlotEntitlementsDER:   blobs.entitlementsDER,
+	}
+
+	// Only the slots up to the last one used are stored
+	count := 0
+	for slot, data := range slots {
+		if data != nil && slot > count {
+			count = slot
+		}
+	}
+
+	hashes := make([][]byte, count)
+	emptyHash := make([]byte, len(hashData(hashType, nil)))
+	for slot := 1; slot <= count; slot++ {
+		if data := slots[slot]; data != nil {
+			hashes[slot-1] = hashData(hashType, data)
+		} else {
+			hashes[slot-1] = emptyHash
+		}
+	}
+	return hashes
+}
+
+// Build the CodeDirectory of the code for a hash type
+func (params SignatureParams) codeDirectory(file *File, blobs signatureBlobs, codeLimit int, hashType uint8) *CodeDirectory {
+	cd := &CodeDirectory{
+		Flags:        params.Flags,
+		HashType:     hashType,
+		Identifier:   params.Identifier,
+		TeamID:       params.TeamID,
+		CodeLimit:    uint64(codeLimit),
+		PageSizeBits: pageSizeBits,
+		SpecialSlots: params.specialSlots(blobs, hashType),
+		CodeSlots:    hashCodePages(hashType, file.Data[:codeLimit], pageSizeBits),
+		ExecSegFlags: blobs.execSegFlags,
+	}
+	if params.Identity == nil {
+		cd.Flags |= FlagAdhoc
+		cd.TeamID = ""
+	}
+
+	if text := file.Segment("__TEXT"); text != nil {
+		cd.ExecSegBase = text.FileOff
+		cd.ExecSegLimit = text.FileSize
+	}
+
+	cd.Bytes()
+	return cd
+}
+
+// Estimate the size of the signature so it can be reserved before hashing the code
+func (params SignatureParams) estimateSize(file *File, blobs signatureBlobs) (int, error) {
+	codeLimit, err := file.codeLimit()
+	if err != nil {
+		return 0, err
+	}
+
+	size := 12 + 8*6 + len(blobs.requirements) + len(blobs.entitlements) + len(blobs.entitlementsDER)
+	for _, hashType := range []uint8{HashTypeSHA1, HashTypeSHA256} {
+		hashSize := len(hashData(hashType, nil))
+		pages := (codeLimit + (1 << pageSizeBits) - 1) >> pageSizeBits
+		size += codeDirectoryHeaderSize + len(params.Identifier) + len(params.TeamID) + 2 + (7+pages)*hashSize
+	}
+
+	// The CMS signature holds the certificates, the signed attributes and the signature itself
+	size += 8
+	if params.Identity != nil {
+		size += len(params.Identity.Certificate.Raw) + 4096
+		if params.TimestampServer != "" {
+			// The timestamp token holds the certificates of the timestamp server
+			size += 8192
+		}
+		for _, certificate := range params.Identity.Chain {
+			size += len(certificate.Raw)
+		}
+	}
+
+	return align(size, 16), nil
+}
+
+// Sign a thin Mach-O image and return the signed image
+func signThin(data []byte, params SignatureParams) ([]byte, error) {
+	file, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs, err := params.blobs(file)
+	if err != nil {
+		return nil, err
+	}
+
+	signatureSize, err := params.estimateSize(file, blobs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update the load commands first, they are part of the hashed code
+	signedData, codeLimit, err := file.reserveSignature(signatureSize)
+	if err != nil {
+		return nil, err
+	}
+	signedFile, err := Parse(signedData)
+	if err != nil {
+		return nil, err
+	}
+
+	// SHA-1 for older systems and SHA-256 as the alternate CodeDirectory
+	codeDirectories := []*CodeDirectory{
+		params.codeDirectory(signedFile, blobs, codeLimit, HashTypeSHA1),
+		params.codeDirectory(signedFile, blobs, codeLimit, HashTypeSHA256),
+	}
+
+	var cms []byte
+	if params.Identity != nil {
+		cms, err = SignCodeDirectories(codeDirectories, *params.Identity, params.TimestampServer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries := []blobEntry{
+		{SlotCodeDirectory, codeDirectories[0].Raw},
+		{SlotRequirements, blobs.requirements},
+	}
+	if blobs.entitlements != nil {
+		entries = append(entries, blobEntry{SlotEntitlements, blobs.entitlements}, blobEntry{SlotEntitlementsDER, blobs.entitlementsDER})
+	}
+	entries = append(entries,
+		blobEntry{SlotAlternateCodeDirectory, codeDirectories[1].Raw},
+		blobEntry{SlotSignature, makeBlob(magicBlobWrapper, cms)},
+	)
+
+	superBlob := makeSuperBlob(entries)
+	if len(superBlob) > signatureSize {
+		return nil, fmt.Errorf("the signature (%d bytes) is larger than the reserved space (%d bytes)", len(superBlob), signatureSize)
+	}
+	copy(signedData[codeLimit:], superBlob)
+
+	return signedData, nil
+}
+
+// Sign a Mach-O file, thin or universal, and return the signed file
+func Sign(data []byte, params SignatureParams) ([]byte, error) {
+	if !IsFat(data) {
+		return signThin(data, params)
+	}
+
+	arches, err := SplitFat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range arches {
+		arches[i].Data, err = signThin(arches[i].Data, params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign the slice %d: %s", i, err)
+		}
+	}
+
+	return BuildFat(arches, IsFat64(data))
+}
@@ -0,0 +1,186 @@
+package macho
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Size of the code and of the __LINKEDIT segment of the test images
+const (
+	testTextSize     = 0x3000
+	testLinkeditSize = 0x200
+)
+
+// Build an unsigned thin 64-bit Mach-O image with a __TEXT segment holding one section
+// and a __LINKEDIT segment, with room for the LC_CODE_SIGNATURE load command
+func testImage(cpuType uint32, fileType uint32) []byte {
+	data := make([]byte, testTextSize+testLinkeditSize)
+	binary.LittleEndian.PutUint32(data, magic64)
+	binary.LittleEndian.PutUint32(data[4:], cpuType)
+	binary.LittleEndian.PutUint32(data[12:], fileType)
+	binary.LittleEndian.PutUint32(data[16:], 2)
+	binary.LittleEndian.PutUint32(data[20:], 152+72)
+
+	text := data[32:]
+	binary.LittleEndian.PutUint32(text, loadCommandSegment64)
+	binary.LittleEndian.PutUint32(text[4:], 152)
+	copy(text[8:], "__TEXT")
+	binary.LittleEndian.PutUint64(text[32:], testTextSize)
+	binary.LittleEndian.PutUint64(text[48:], testTextSize)
+	binary.LittleEndian.PutUint32(text[64:], 1)
+	section := text[72:]
+	copy(section, "__text")
+	copy(section[16:], "__TEXT")
+	binary.LittleEndian.PutUint64(section[40:], testTextSize-0x1000)
+	binary.LittleEndian.PutUint32(section[48:], 0x1000)
+
+	linkedit := data[32+152:]
+	binary.LittleEndian.PutUint32(linkedit, loadCommandSegment64)
+	binary.LittleEndian.PutUint32(linkedit[4:], 72)
+	copy(linkedit[8:], "__LINKEDIT")
+	binary.LittleEndian.PutUint64(linkedit[24:], testTextSize)
+	binary.LittleEndian.PutUint64(linkedit[32:], testLinkeditSize)
+	binary.LittleEndian.PutUint64(linkedit[40:], testTextSize)
+	binary.LittleEndian.PutUint64(linkedit[48:], testLinkeditSize)
+
+	for i := 0x1000; i < len(data); i++ {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+// Build a universal binary from test slices
+func testFat(t *testing.T, fat64 bool, arches ...Arch) []byte {
+	t.Helper()
+
+	data, err := BuildFat(arches, fat64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Create a self-signed identity
+func testIdentity(t *testing.T) *Identity {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Apple Development: Test (ABC)", OrganizationalUnit: []string{"TEAM123456"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Identity{Certificate: certificate, Key: key}
+}
+
+// Offset of a code page of the first slice, inside the hashed code
+func testCodeOffset(data []byte) int {
+	if IsFat(data) {
+		return int(binary.BigEndian.Uint32(data[16:])) + 0x1800
+	}
+	return 0x1800
+}
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	infoPlist := []byte("<plist><dict/></plist>")
+	entitlements := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0"><dict><key>get-task-allow</key><true/></dict></plist>`)
+
+	thin := testImage(cpuTypeARM64, fileTypeExecute)
+	fat := testFat(t, false,
+		Arch{CPUType: cpuTypeARM64, Align: 14, Data: testImage(cpuTypeARM64, fileTypeExecute)},
+		Arch{CPUType: cpuTypeX8664, Align: 12, Data: testImage(cpuTypeX8664, fileTypeExecute)},
+	)
+
+	for _, image := range []struct {
+		name   string
+		data   []byte
+		slices int
+	}{{"thin", thin, 1}, {"fat", fat, 2}} {
+		for _, signer := range []struct {
+			name     string
+			identity *Identity
+		}{{"ad-hoc", nil}, {"identity", testIdentity(t)}} {
+			t.Run(image.name+" "+signer.name, func(t *testing.T) {
+				params := SignatureParams{
+					Identifier:   "com.example.test",
+					TeamID:       "TEAM123456",
+					InfoPlist:    infoPlist,
+					Entitlements: entitlements,
+					Identity:     signer.identity,
+				}
+				signed, err := Sign(image.data, params)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				signatures, err := Verify(signed, infoPlist, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(signatures) != image.slices {
+					t.Fatalf("%d signatures for %d slices", len(signatures), image.slices)
+				}
+				for _, signature := range signatures {
+					cd := signature.BestCodeDirectory()
+					if cd.Identifier != params.Identifier {
+						t.Errorf("identifier %q, expected %q", cd.Identifier, params.Identifier)
+					}
+					if (signature.CMS != nil) != (signer.identity != nil) {
+						t.Errorf("CMS signature %v with the identity %v", signature.CMS != nil, signer.identity != nil)
+					}
+					if string(signature.EntitlementsPlist()) != string(entitlements) {
+						t.Errorf("entitlements %q", signature.EntitlementsPlist())
+					}
+				}
+
+				// Signing again replaces the signature
+				resigned, err := Sign(signed, params)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := Verify(resigned, infoPlist, nil); err != nil {
+					t.Fatalf("signed again: %s", err)
+				}
+
+				// A modified page or Info.plist breaks the signature
+				tampered := append([]byte{}, signed...)
+				tampered[testCodeOffset(tampered)] ^= 0xff
+				if _, err := Verify(tampered, infoPlist, nil); err == nil || !strings.Contains(err.Error(), "code page") {
+					t.Errorf("tampered page: %v", err)
+				}
+				if _, err := Verify(signed, []byte("<plist><dict><key>a</key><true/></dict></plist>"), nil); err == nil {
+					t.Error("no error for a modified Info.plist")
+				}
+			})
+		}
+	}
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	if _, err := Verify(testImage(cpuTypeARM64, fileTypeExecute), nil, nil); err == nil {
+		t.Error("no error for an unsigned file")
+	}
+}
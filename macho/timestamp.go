@@ -0,0 +1,144 @@
+package macho
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// Timestamp server used by codesign
+const DefaultTimestampServer = "http://timestamp.apple.com/ts01"
+
+var (
+	oidTimestampToken = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 14}
+	oidTSTInfo        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+)
+
+// RFC 3161 time-stamp request
+type timestampRequest struct {
+	Version        int
+	MessageImprint timestampMessageImprint
+	Nonce          *big.Int
+	CertReq        bool
+}
+
+type timestampMessageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+// RFC 3161 time-stamp response
+type timestampResponse struct {
+	Status         timestampStatus
+	TimestampToken asn1.RawValue `asn1:"optional"`
+}
+
+type timestampStatus struct {
+	Status       int
+	StatusString asn1.RawValue `asn1:"optional"`
+	FailInfo     asn1.RawValue `asn1:"optional"`
+}
+
+// Content of a time-stamp token
+type timestampInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint timestampMessageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+// Timeout of the requests to the timestamp server
+var timestampTimeout = 30 * time.Second
+
+// Request a time-stamp token for a signature value from an RFC 3161 server
+func requestTimestamp(server string, signature []byte) ([]byte, error) {
+	digest := sha256.Sum256(signature)
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := asn1.Marshal(timestampRequest{
+		Version: 1,
+		MessageImprint: timestampMessageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest[:],
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: timestampTimeout}
+	response, err := client.Post(server, "application/timestamp-query", bytes.NewReader(request))
+	if err != nil {
+		return nil, fmt.Errorf("the timestamp server %s is unavailable: %s", server, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the timestamp server %s returned the HTTP status %d", server, response.StatusCode)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var timestamp timestampResponse
+	if _, err := asn1.Unmarshal(body, &timestamp); err != nil {
+		return nil, fmt.Errorf("invalid response from the timestamp server %s: %s", server, err)
+	}
+
+	// 0 is granted, 1 is granted with modifications
+	if timestamp.Status.Status > 1 || len(timestamp.TimestampToken.FullBytes) == 0 {
+		return nil, fmt.Errorf("the timestamp server %s rejected the request (status %d)", server, timestamp.Status.Status)
+	}
+
+	info, err := parseTimestampToken(timestamp.TimestampToken.FullBytes)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(info.MessageImprint.HashedMessage, digest[:]) {
+		return nil, fmt.Errorf("the timestamp from %s does not match the signature", server)
+	}
+
+	return timestamp.TimestampToken.FullBytes, nil
+}
+
+// Parse the content of a time-stamp token
+func parseTimestampToken(token []byte) (*timestampInfo, error) {
+	var contentInfo cmsContentInfo
+	if _, err := asn1.Unmarshal(token, &contentInfo); err != nil {
+		return nil, fmt.Errorf("invalid timestamp token: %s", err)
+	}
+
+	var signedData cmsSignedData
+	if _, err := asn1.Unmarshal(contentInfo.Content.Bytes, &signedData); err != nil {
+		return nil, fmt.Errorf("invalid timestamp token: %s", err)
+	}
+	if !signedData.ContentInfo.ContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("the timestamp token has no timestamp information")
+	}
+
+	var content []byte
+	if _, err := asn1.Unmarshal(signedData.ContentInfo.Content.Bytes, &content); err != nil {
+		return nil, fmt.Errorf("invalid timestamp token: %s", err)
+	}
+
+	var info timestampInfo
+	if _, err := asn1.Unmarshal(content, &info); err != nil {
+		return nil, fmt.Errorf("invalid timestamp information: %s", err)
+	}
+	return &info, nil
+}
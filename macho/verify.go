@@ -0,0 +1,215 @@
+package macho
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Signature is the parsed embedded signature of a thin Mach-O image
+type Signature struct {
+	CodeDirectories []*CodeDirectory
+	Requirements    []byte
+	Entitlements    []byte
+	EntitlementsDER []byte
+
+	// CMS signature, nil for ad-hoc signatures
+	CMS *CMSSignature
+}
+
+// The CodeDirectory used for display, SHA-256 when available
+func (signature *Signature) BestCodeDirectory() *CodeDirectory {
+	best := signature.CodeDirectories[0]
+	for _, cd := range signature.CodeDirectories {
+		if cd.HashType == HashTypeSHA256 {
+			best = cd
+		}
+	}
+	return best
+}
+
+// Entitlements plist embedded in the signature, nil when there are none
+func (signature *Signature) EntitlementsPlist() []byte {
+	if len(signature.Entitlements) < 8 {
+		return nil
+	}
+	return signature.Entitlements[8:]
+}
+
+// Parse the embedded signature of the file
+func (file *File) Signature() (*Signature, error) {
+	data := file.SignatureData()
+	if data == nil {
+		return nil, fmt.Errorf("the file is not signed")
+	}
+
+	entries, err := parseSuperBlob(data, magicEmbeddedSignature)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := &Signature{
+		Requirements:    entries[SlotRequirements],
+		Entitlements:    entries[SlotEntitlements],
+		EntitlementsDER: entries[SlotEntitlementsDER],
+	}
+
+	for _, slot := range []uint32{SlotCodeDirectory, SlotAlternateCodeDirectory, SlotAlternateCodeDirectory + 1, SlotAlternateCodeDirectory + 2} {
+		if blob, ok := entries[slot]; ok {
+			cd, err := ParseCodeDirectory(blob)
+			if err != nil {
+				return nil, err
+			}
+			signature.CodeDirectories = append(signature.CodeDirectories, cd)
+		}
+	}
+	if len(signature.CodeDirectories) == 0 {
+		return nil, fmt.Errorf("the signature has no code directory")
+	}
+
+	// Ad-hoc signatures have an empty CMS wrapper
+	if wrapper, ok := entries[SlotSignature]; ok && len(wrapper) > 8 {
+		signature.CMS, err = ParseCMS(wrapper[8:])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return signature, nil
+}
+
+// Return the thin images of a Mach-O file, one for each slice of universal binaries
+func Slices(data []byte) ([][]byte, error) {
+	if !IsFat(data) {
+		return [][]byte{data}, nil
+	}
+
+	arches, err := SplitFat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var slices [][]byte
+	for _, arch := range arches {
+		slices = append(slices, arch.Data)
+	}
+	return slices, nil
+}
+
+// Parse the embedded signatures of a Mach-O file, one for each slice of universal binaries
+func ReadSignatures(data []byte) ([]*Signature, error) {
+	slices, err := Slices(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var signatures []*Signature
+	for _, slice := range slices {
+		file, err := Parse(slice)
+		if err != nil {
+			return nil, err
+		}
+
+		signature, err := file.Signature()
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, signature)
+	}
+
+	return signatures, nil
+}
+
+// Check a special slot hash against the data it covers
+func checkSpecialSlot(cd *CodeDirectory, slot int, name string, data []byte) error {
+	expected := cd.SpecialSlot(slot)
+	switch {
+	case expected == nil && data == nil:
+		return nil
+	case expected == nil:
+		return fmt.Errorf("the %s is not sealed by the signature", name)
+	case data == nil:
+		return fmt.Errorf("the %s sealed by the signature is missing", name)
+	case !bytes.Equal(expected, hashData(cd.HashType, data)):
+		return fmt.Errorf("the %s has been modified", name)
+	}
+	return nil
+}
+
+// Verify the embedded signature of a thin Mach-O image
+// infoPlist and codeResources are the bundle files sealed by the signature, nil when not in a bundle
+func (file *File) VerifySignature(infoPlist []byte, codeResources []byte) (*Signature, error) {
+	signature, err := file.Signature()
+	if err != nil {
+		return nil, err
+	}
+
+	signatureOffset, _, _ := file.CodeSignature()
+	for _, cd := range signature.CodeDirectories {
+		if cd.CodeLimit > uint64(signatureOffset) {
+			return nil, fmt.Errorf("the code limit is past the signature")
+		}
+
+		pages := hashCodePages(cd.HashType, file.Data[:cd.CodeLimit], cd.PageSizeBits)
+		if len(pages) != len(cd.CodeSlots) {
+			return nil, fmt.Errorf("the code directory has %d pages, the file has %d", len(cd.CodeSlots), len(pages))
+		}
+		for i := range pages {
+			if !bytes.Equal(pages[i], cd.CodeSlots[i]) {
+				return nil, fmt.Errorf("the code page %d has been modified", i)
+			}
+		}
+
+		for _, slot := range []struct {
+			slot int
+			name string
+			data []byte
+		}{
+			{SlotInfoPlist, "Info.plist", infoPlist},
+			{SlotRequirements, "requirements", signature.Requirements},
+			{SlotResourceDirectory, "CodeResources", codeResources},
+			{SlotEntitlements, "entitlements", signature.Entitlements},
+			{SlotEntitlementsDER, "DER entitlements", signature.EntitlementsDER},
+		} {
+			if err := checkSpecialSlot(cd, slot.slot, slot.name, slot.data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if signature.CMS != nil {
+		if err := signature.CMS.Verify(signature.CodeDirectories[0].Raw); err != nil {
+			return nil, err
+		}
+	} else if signature.CodeDirectories[0].Flags&FlagAdhoc == 0 {
+		return nil, fmt.Errorf("the signature is not ad-hoc but has no CMS signature")
+	}
+
+	return signature, nil
+}
+
+// Verify the embedded signatures of a Mach-O file, thin or universal
+func Verify(data []byte, infoPlist []byte, codeResources []byte) ([]*Signature, error) {
+	slices, err := Slices(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var signatures []*Signature
+	for i, slice := range slices {
+		file, err := Parse(slice)
+		if err != nil {
+			return nil, err
+		}
+
+		signature, err := file.VerifySignature(infoPlist, codeResources)
+		if err != nil {
+			if len(slices) > 1 {
+				return nil, fmt.Errorf("slice %d: %s", i, err)
+			}
+			return nil, err
+		}
+		signatures = append(signatures, signature)
+	}
+
+	return signatures, nil
+}
@@ -16,12 +16,16 @@ import (
 type ProvisioningProfile struct {
 	Filename     string
 	Name         string
+	UUID         string
 	Created      time.Time
 	Expires      time.Time
 	AppID        string
 	TeamID       string
 	Entitlements map[string]interface{}
 	Path         string
+
+	// DER certificates allowed to sign with the profile
+	DeveloperCertificates [][]byte
 }
 
 func sortProfilesByCreationDateAndName(profiles []ProvisioningProfile) {
@@ -103,52 +107,89 @@ type mobileProvision struct {
 	ExpirationDate time.Time              `xml:"ExpirationDate"`
 	CreationDate   time.Time              `xml:"CreationDate"`
 	Name           string                 `xml:"Name"`
+	UUID           string                 `xml:"UUID"`
 	Entitlements   map[string]interface{} `xml:"Entitlements"`
 	_              map[string]interface{} `xml:",any"`
+
+	DeveloperCertificates [][]byte `xml:"DeveloperCertificates"`
 }
 
 func CreateProvisioningProfile(filename string) (ProvisioningProfile, error) {
-	var provisioningProfile ProvisioningProfile
-
 	// Execute the security command
 	bytes, status, err := utils.ExecuteProcess("/usr/bin/security", "cms", "-D", "-i", filename)
 	if err != nil {
-		return ProvisioningProfile{}, err
+		// The security tool is only available on macOS, read the plist embedded in the CMS envelope instead
+		bytes, err = readEmbeddedPlist(filename)
+		if err != nil {
+			return ProvisioningProfile{}, err
+		}
+		status = 0
+	}
+	if status != 0 {
+		return ProvisioningProfile{}, nil
 	}
 
-	if status == 0 {
-		// Get the output of the security command
-		output := string(bytes)
+	return ParseProvisioningProfile(filename, bytes)
+}
 
-		// Get the xml start tag
-		xmlIndex := strings.Index(string(output), "<?xml")
+// Read a provisioning profile from its plist, the content of its CMS envelope
+func ParseProvisioningProfile(filename string, content []byte) (ProvisioningProfile, error) {
+	var provisioningProfile ProvisioningProfile
 
-		// Get the raw xml
-		rawXML := string(output)[xmlIndex:]
+	// Get the xml start tag
+	xmlIndex := strings.Index(string(content), "<?xml")
+	if xmlIndex < 0 {
+		return ProvisioningProfile{}, fmt.Errorf("the provisioning profile %s has no plist", filename)
+	}
 
-		// Parse the plist
-		var mobileProvision mobileProvision
-		_, err := plist.Unmarshal([]byte(rawXML), &mobileProvision)
-		if err != nil {
-			return ProvisioningProfile{}, err
-		}
+	// Get the raw xml
+	rawXML := string(content)[xmlIndex:]
 
-		// Fill the provisioning profile information
-		appID := mobileProvision.Entitlements["application-identifier"].(string)
-		periodIndex := strings.Index(appID, ".")
-		provisioningProfile.AppID = appID[periodIndex+1:]
-		provisioningProfile.TeamID = appID[:periodIndex]
-
-		provisioningProfile.Filename = filename
-		provisioningProfile.Expires = mobileProvision.ExpirationDate
-		provisioningProfile.Created = mobileProvision.CreationDate
-		provisioningProfile.Name = mobileProvision.Name
-		provisioningProfile.Entitlements = mobileProvision.Entitlements
+	// Parse the plist
+	var mobileProvision mobileProvision
+	_, err := plist.Unmarshal([]byte(rawXML), &mobileProvision)
+	if err != nil {
+		return ProvisioningProfile{}, err
 	}
 
+	// Fill the provisioning profile information
+	appID, _ := mobileProvision.Entitlements["application-identifier"].(string)
+	periodIndex := strings.Index(appID, ".")
+	if periodIndex < 0 {
+		return ProvisioningProfile{}, fmt.Errorf("the provisioning profile %s has no application identifier", filename)
+	}
+	provisioningProfile.AppID = appID[periodIndex+1:]
+	provisioningProfile.TeamID = appID[:periodIndex]
+
+	provisioningProfile.Filename = filename
+	provisioningProfile.Path = filename
+	provisioningProfile.Expires = mobileProvision.ExpirationDate
+	provisioningProfile.Created = mobileProvision.CreationDate
+	provisioningProfile.Name = mobileProvision.Name
+	provisioningProfile.UUID = mobileProvision.UUID
+	provisioningProfile.Entitlements = mobileProvision.Entitlements
+	provisioningProfile.DeveloperCertificates = mobileProvision.DeveloperCertificates
+
 	return provisioningProfile, nil
 }
 
+// Read the plist of a provisioning profile without decoding its CMS envelope
+// The plist is stored as is in the signed content of the envelope
+func readEmbeddedPlist(filename string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	start := strings.Index(string(data), "<?xml")
+	end := strings.LastIndex(string(data), "</plist>")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("failed to find the plist of the provisioning profile %s", filename)
+	}
+
+	return data[start : end+len("</plist>")], nil
+}
+
 func (profile ProvisioningProfile) RemoveGetTaskAllow() {
 	delete(profile.Entitlements, "get-task-allow")
 }
@@ -0,0 +1,104 @@
+package sign
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// Folders of the work folder zipped next to the Payload folder when they exist
+var ipaSupportFolders = []string{"SwiftSupport", "Symbols"}
+
+// Return the path of the app of an Xcode archive
+// The app is read from the ApplicationProperties of the archive Info.plist,
+// or is the first app of Products/Applications
+func locateArchiveApp(archiveFolder string) (string, map[string]interface{}, error) {
+	var properties map[string]interface{}
+	if infoPlist, _, err := utils.ReadPlist(filepath.Join(archiveFolder, "Info.plist")); err == nil {
+		properties, _ = infoPlist["ApplicationProperties"].(map[string]interface{})
+	}
+
+	if applicationPath, ok := properties["ApplicationPath"].(string); ok && applicationPath != "" {
+		appFolder := filepath.Join(archiveFolder, "Products", applicationPath)
+		if !utils.IsFolder(appFolder) {
+			return "", nil, fmt.Errorf("the archive app %s does not exist", applicationPath)
+		}
+		return appFolder, properties, nil
+	}
+
+	applicationsFolder := filepath.Join(archiveFolder, "Products", "Applications")
+	entries, err := os.ReadDir(applicationsFolder)
+	if err != nil {
+		return "", nil, fmt.Errorf("the archive has no Products/Applications folder")
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && filepath.Ext(entry.Name()) == ".app" {
+			return filepath.Join(applicationsFolder, entry.Name()), properties, nil
+		}
+	}
+	return "", nil, fmt.Errorf("the archive has no app in Products/Applications")
+}
+
+// Copy the app of an Xcode archive and its support folders to the work folder
+// Return the app folder inside the Payload folder
+func exportArchive(out io.Writer, archiveFolder string, workFolder string, includeSymbols bool) (string, error) {
+	archiveApp, properties, err := locateArchiveApp(archiveFolder)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Fprintln(out, "Exporting the archived app", filepath.Base(archiveApp))
+	for _, key := range []string{"CFBundleIdentifier", "CFBundleShortVersionString", "CFBundleVersion"} {
+		if value, ok := properties[key].(string); ok {
+			fmt.Fprintf(out, "  %s: %s\n", key, value)
+		}
+	}
+
+	appFolder := filepath.Join(workFolder, "Payload", filepath.Base(archiveApp))
+	if err := utils.CopyFolder(archiveApp, appFolder); err != nil {
+		return "", fmt.Errorf("failed to copy the archived app, error: %s", err)
+	}
+
+	// The Swift libraries are signed by Apple and copied as they are
+	if swiftSupport := filepath.Join(archiveFolder, "SwiftSupport"); utils.IsFolder(swiftSupport) {
+		if err := utils.CopyFolder(swiftSupport, filepath.Join(workFolder, "SwiftSupport")); err != nil {
+			return "", fmt.Errorf("failed to copy the SwiftSupport folder, error: %s", err)
+		}
+	}
+
+	if includeSymbols {
+		if err := exportSymbols(out, archiveFolder, filepath.Join(workFolder, "Symbols")); err != nil {
+			return "", err
+		}
+	}
+
+	return appFolder, nil
+}
+
+// Create the symbol files of the archive dSYMs with the symbols tool of Xcode
+func exportSymbols(out io.Writer, archiveFolder string, symbolsFolder string) error {
+	dSYMs, err := filepath.Glob(filepath.Join(archiveFolder, "dSYMs", "*.dSYM"))
+	if err != nil {
+		return err
+	}
+	if len(dSYMs) == 0 {
+		fmt.Fprintln(out, "The archive has no dSYMs, no symbols to include")
+		return nil
+	}
+
+	if err := os.MkdirAll(symbolsFolder, 0755); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "Creating the symbol files...")
+	for _, dSYM := range dSYMs {
+		_, _, err := utils.ExecuteProcess("xcrun", "symbols", "-noTextInSOD", "-noDaemon", "-arch", "all", "-symbolsPackageDir", symbolsFolder, dSYM)
+		if err != nil {
+			return fmt.Errorf("failed to create the symbols of %s (the Xcode symbols tool is required), error: %s", filepath.Base(dSYM), err)
+		}
+	}
+	return nil
+}
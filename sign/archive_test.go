@@ -0,0 +1,162 @@
+package sign
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/e-n-0/sign-app-cli/utils"
+	"howett.net/plist"
+)
+
+// Write an Xcode archive of the signable test app, with the given archive Info.plist when not nil
+// Return the archive folder
+func writeTestArchive(t *testing.T, infoPlist map[string]interface{}) string {
+	t.Helper()
+
+	archive := filepath.Join(t.TempDir(), "Test.xcarchive")
+	writeSignableTestApp(t, filepath.Join(archive, "Products", "Applications"))
+	writeTestFiles(t, archive, map[string]string{
+		"SwiftSupport/iphoneos/libswiftCore.dylib": "swift",
+		"dSYMs/Test.app.dSYM/Contents/Info.plist":  "dsym",
+	})
+	if infoPlist != nil {
+		if err := utils.WritePlist(filepath.Join(archive, "Info.plist"), infoPlist, plist.XMLFormat); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return archive
+}
+
+func TestLocateArchiveApp(t *testing.T) {
+	tests := []struct {
+		name      string
+		infoPlist map[string]interface{}
+		// Other apps written in Products
+		apps     []string
+		expected string
+		err      string
+	}{
+		{"application path", map[string]interface{}{"ApplicationProperties": map[string]interface{}{
+			"ApplicationPath":    "Applications/Test.app",
+			"CFBundleIdentifier": "com.example.test",
+		}}, []string{"Applications/Another.app"}, "Applications/Test.app", ""},
+		{"first app", nil, nil, "Applications/Test.app", ""},
+		{"first app without application path", map[string]interface{}{"ApplicationProperties": map[string]interface{}{}}, nil, "Applications/Test.app", ""},
+		{"missing application path", map[string]interface{}{"ApplicationProperties": map[string]interface{}{
+			"ApplicationPath": "Applications/Missing.app",
+		}}, nil, "", "the archive app Applications/Missing.app does not exist"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			archive := writeTestArchive(t, test.infoPlist)
+			for _, app := range test.apps {
+				writeTestBundle(t, filepath.Join(archive, "Products", filepath.FromSlash(app)), "com.example.another")
+			}
+
+			app, properties, err := locateArchiveApp(archive)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if app != filepath.Join(archive, "Products", filepath.FromSlash(test.expected)) {
+				t.Errorf("app %s, expected %s", app, test.expected)
+			}
+			if test.infoPlist != nil && len(properties) != len(test.infoPlist["ApplicationProperties"].(map[string]interface{})) {
+				t.Errorf("properties %v", properties)
+			}
+		})
+	}
+
+	archive := filepath.Join(t.TempDir(), "Empty.xcarchive")
+	if err := os.MkdirAll(filepath.Join(archive, "Products", "Applications"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := locateArchiveApp(archive); err == nil || !strings.Contains(err.Error(), "no app in Products/Applications") {
+		t.Errorf("empty archive: %v", err)
+	}
+}
+
+// List the files of a zip archive
+func zipFiles(t *testing.T, path string) []string {
+	t.Helper()
+
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	var files []string
+	for _, file := range reader.File {
+		if !strings.HasSuffix(file.Name, "/") {
+			files = append(files, file.Name)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestSignArchive(t *testing.T) {
+	archive := writeTestArchive(t, map[string]interface{}{"ApplicationProperties": map[string]interface{}{
+		"ApplicationPath":    "Applications/Test.app",
+		"CFBundleIdentifier": "com.example.test",
+		"CFBundleVersion":    "42",
+	}})
+	output := filepath.Join(t.TempDir(), "Test.ipa")
+
+	signer, err := NewSigner("native", SignerConfig{Adhoc: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	err = Sign(SignerParams{
+		Signer:              signer,
+		CodesignCertificate: AdhocIdentity,
+		Adhoc:               true,
+		InputFile:           archive,
+		OutputFile:          output,
+		Output:              &out,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Exporting the archived app Test.app\n  CFBundleIdentifier: com.example.test\n  CFBundleVersion: 42\n") {
+		t.Errorf("output %q", out.String())
+	}
+
+	// The app is signed in the Payload folder, the Swift libraries are copied as they are
+	expected := []string{
+		"Payload/Test.app/Info.plist",
+		"Payload/Test.app/PlugIns/Share.appex/Info.plist",
+		"Payload/Test.app/PlugIns/Share.appex/Share",
+		"Payload/Test.app/PlugIns/Share.appex/_CodeSignature/CodeResources",
+		"Payload/Test.app/Test",
+		"Payload/Test.app/_CodeSignature/CodeResources",
+		"SwiftSupport/iphoneos/libswiftCore.dylib",
+	}
+	if files := zipFiles(t, output); strings.Join(files, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("ipa files %q", files)
+	}
+
+	// The archive is not changed
+	if utils.FileExists(filepath.Join(archive, "Products", "Applications", "Test.app", "_CodeSignature")) {
+		t.Error("the archived app was signed")
+	}
+
+	// An archive is exported, never signed in place
+	err = Sign(SignerParams{Signer: signer, Adhoc: true, InputFile: archive, InPlace: true, Output: io.Discard})
+	if err == nil || !strings.Contains(err.Error(), "cannot be signed in place") {
+		t.Errorf("archive signed in place: %v", err)
+	}
+}
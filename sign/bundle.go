@@ -0,0 +1,163 @@
+package sign
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// Layout of a bundle folder
+// iOS bundles are flat, macOS bundles keep their files in Contents
+// and versioned frameworks in Versions/<version>
+type bundle struct {
+	// Folder of the bundle
+	path string
+	// Folder sealed by the signature, containing _CodeSignature
+	contents string
+	// Folder of the resources and the localizations
+	resources string
+	// Info.plist of the bundle, empty for frameworks without one
+	infoPlist string
+	// Main executable, empty for bundles without code
+	executable string
+	// macOS layout, sealed with the macOS resource rules
+	macOS bool
+}
+
+// Path of the provisioning profile embedded in the bundle
+func (b *bundle) profilePath() string {
+	if b.macOS {
+		return filepath.Join(b.contents, "embedded.provisionprofile")
+	}
+	return filepath.Join(b.path, "embedded.mobileprovision")
+}
+
+// Path of the resource seal of the bundle
+func (b *bundle) codeResourcesPath() string {
+	return filepath.Join(b.contents, "_CodeSignature", "CodeResources")
+}
+
+// Read the layout of a bundle folder, nil when the folder is not a bundle
+// An error is returned when the bundle declares an executable that cannot be signed
+func readBundle(folder string) (*bundle, error) {
+	var b *bundle
+	executableFolder := folder
+
+	switch {
+	case filepath.Ext(folder) != "" && utils.FileExists(filepath.Join(folder, "Contents", "Info.plist")):
+		// macOS apps, app extensions, XPC services and plug-ins
+		contents := filepath.Join(folder, "Contents")
+		b = &bundle{path: folder, contents: contents, resources: filepath.Join(contents, "Resources"), infoPlist: filepath.Join(contents, "Info.plist"), macOS: true}
+		executableFolder = filepath.Join(contents, "MacOS")
+	case filepath.Base(filepath.Dir(folder)) == "Versions" && filepath.Ext(filepath.Dir(filepath.Dir(folder))) == ".framework":
+		// Version of a macOS framework
+		b = &bundle{path: folder, contents: folder, resources: filepath.Join(folder, "Resources"), macOS: true}
+		if infoPlist := filepath.Join(folder, "Resources", "Info.plist"); utils.FileExists(infoPlist) {
+			b.infoPlist = infoPlist
+		}
+	case filepath.Ext(folder) == ".framework" && utils.IsFolder(filepath.Join(folder, "Versions")):
+		// Versioned frameworks are signed through their versions
+		return nil, nil
+	case filepath.Ext(folder) != "" && utils.FileExists(filepath.Join(folder, "Info.plist")):
+		// iOS bundles
+		b = &bundle{path: folder, contents: folder, resources: folder, infoPlist: filepath.Join(folder, "Info.plist")}
+	case filepath.Ext(folder) == ".framework":
+		// iOS frameworks without an Info.plist
+		b = &bundle{path: folder, contents: folder, resources: folder}
+	default:
+		return nil, nil
+	}
+
+	var executable string
+	if b.infoPlist != "" {
+		infoPlist, _, err := utils.ReadPlist(b.infoPlist)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %s", b.infoPlist, err)
+		}
+		executable, _ = infoPlist["CFBundleExecutable"].(string)
+	}
+
+	// Frameworks without an executable name use the name of the framework
+	if executable == "" {
+		if framework := frameworkFolder(folder); framework != "" {
+			executable = strings.TrimSuffix(filepath.Base(framework), ".framework")
+			if !utils.FileExists(filepath.Join(executableFolder, executable)) {
+				return b, nil
+			}
+		}
+	}
+
+	if executable == "" {
+		return b, nil
+	}
+
+	executablePath := filepath.Join(executableFolder, executable)
+	isMachO, err := macho.IsMachOFile(executablePath)
+	if err != nil {
+		return nil, fmt.Errorf("missing bundle executable %s", executable)
+	}
+	if !isMachO {
+		return nil, fmt.Errorf("the bundle executable %s is not a Mach-O file", executable)
+	}
+
+	b.executable = executablePath
+	return b, nil
+}
+
+// Return the framework folder of a framework or a framework version, empty otherwise
+func frameworkFolder(folder string) string {
+	if filepath.Ext(folder) == ".framework" {
+		return folder
+	}
+	if framework := filepath.Dir(filepath.Dir(folder)); filepath.Base(filepath.Dir(folder)) == "Versions" && filepath.Ext(framework) == ".framework" {
+		return framework
+	}
+	return ""
+}
+
+// Return the bundle whose main executable is the file, nil when the file is not a main executable
+func findExecutableBundle(path string) *bundle {
+	// The executable is at the root of iOS bundles and framework versions, in Contents/MacOS for macOS bundles
+	candidates := []string{filepath.Dir(path)}
+	if filepath.Base(filepath.Dir(path)) == "MacOS" {
+		candidates = append(candidates, filepath.Dir(filepath.Dir(filepath.Dir(path))))
+	}
+
+	for _, candidate := range candidates {
+		if b, err := readBundle(candidate); err == nil && b != nil && b.executable == path {
+			return b
+		}
+	}
+	return nil
+}
+
+// Return the main executable of nested code sealed as a whole by its parent bundle,
+// empty when the item is not code
+func nestedCodeExecutable(path string, info os.FileInfo) (string, error) {
+	if !info.IsDir() {
+		signable, err := macho.IsSignableFile(path)
+		if err != nil || !signable {
+			return "", err
+		}
+		return path, nil
+	}
+
+	// Versioned frameworks are represented by their current version
+	if filepath.Ext(path) == ".framework" && utils.IsFolder(filepath.Join(path, "Versions")) {
+		current, err := filepath.EvalSymlinks(filepath.Join(path, "Versions", "Current"))
+		if err != nil {
+			return "", fmt.Errorf("the framework %s has no current version", filepath.Base(path))
+		}
+		path = current
+	}
+
+	b, err := readBundle(path)
+	if err != nil || b == nil {
+		return "", err
+	}
+	return b.executable, nil
+}
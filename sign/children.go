@@ -0,0 +1,232 @@
+package sign
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/e-n-0/sign-app-cli/provisioningprofiles"
+	"github.com/e-n-0/sign-app-cli/utils"
+
+	"howett.net/plist"
+)
+
+// Folders of the app containing child apps, signed with their own profile
+var childAppFolders = []struct {
+	folder string
+	kind   string
+}{
+	{"Watch", "watch app"},
+	{"AppClips", "app clip"},
+}
+
+// Folder of the watch apps containing their extensions, signed with their own profile
+const watchExtensionsFolder = "PlugIns"
+
+// Entitlement linking an app clip to its parent app
+const parentApplicationIdentifiersKey = "com.apple.developer.parent-application-identifiers"
+
+// Info.plist key linking a watch app to its parent app
+const companionAppIdentifierKey = "WKCompanionAppBundleIdentifier"
+
+// Info.plist key of the WatchKit extensions (in NSExtension.NSExtensionAttributes) naming their watch app
+const watchAppIdentifierKey = "WKAppBundleIdentifier"
+
+// Provisioning profile used for the child apps matching a pattern
+type ChildProfile struct {
+	// Path of the child app relative to the app (glob pattern) or its bundle identifier
+	Pattern string
+	Profile provisioningprofiles.ProvisioningProfile
+}
+
+// Parse a --child-profile argument (pattern=profile path)
+func ParseChildProfile(arg string) (ChildProfile, error) {
+	index := strings.Index(arg, "=")
+	if index <= 0 || index == len(arg)-1 {
+		return ChildProfile{}, fmt.Errorf("invalid child profile %q, expected pattern=profile", arg)
+	}
+
+	profilePath := arg[index+1:]
+	if !utils.FileExists(profilePath) {
+		return ChildProfile{}, fmt.Errorf("the provisioning profile %s does not exist", profilePath)
+	}
+
+	profile, err := provisioningprofiles.CreateProvisioningProfile(profilePath)
+	if err != nil {
+		return ChildProfile{}, fmt.Errorf("failed to read the provisioning profile %s: %s", profilePath, err)
+	}
+	return ChildProfile{Pattern: arg[:index], Profile: profile}, nil
+}
+
+// A watch app, a watch extension or an app clip nested in the app
+type childApp struct {
+	// Folder of the child app
+	path string
+	// Path relative to the app
+	relativePath string
+	kind         string
+	identifier   string
+	// Child app containing the watch extension, nil for the child apps
+	parent *childApp
+
+	profile          provisioningprofiles.ProvisioningProfile
+	entitlementsFile string
+}
+
+// Check if the item is the child app or is nested in it
+func (child childApp) contains(path string) bool {
+	return path == child.path || strings.HasPrefix(path, child.path+string(filepath.Separator))
+}
+
+// Return the innermost child app containing the item, nil when the item belongs to the app
+func findChildApp(children []childApp, path string) *childApp {
+	var found *childApp
+	for i := range children {
+		if children[i].contains(path) && (found == nil || len(children[i].path) > len(found.path)) {
+			found = &children[i]
+		}
+	}
+	return found
+}
+
+// List the watch apps, their extensions and the app clips of the app
+// The watch extensions are listed after their watch app
+func findChildApps(appFolder string) ([]childApp, error) {
+	var children []childApp
+	for _, folder := range childAppFolders {
+		paths, err := filepath.Glob(filepath.Join(appFolder, folder.folder, "*.app"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range paths {
+			relativePath, _ := filepath.Rel(appFolder, path)
+			children = append(children, childApp{path: path, relativePath: filepath.ToSlash(relativePath), kind: folder.kind})
+			if folder.kind != "watch app" {
+				continue
+			}
+
+			extensions, err := filepath.Glob(filepath.Join(path, watchExtensionsFolder, "*.appex"))
+			if err != nil {
+				return nil, err
+			}
+			for _, extension := range extensions {
+				relativePath, _ := filepath.Rel(appFolder, extension)
+				children = append(children, childApp{path: extension, relativePath: filepath.ToSlash(relativePath), kind: "watch extension"})
+			}
+		}
+	}
+
+	// Link the watch extensions to their watch app
+	for i := range children {
+		if children[i].kind == "watch extension" {
+			children[i].parent = findChildApp(children[:i], filepath.Dir(children[i].path))
+		}
+	}
+	return children, nil
+}
+
+// Find the child apps, link them to the app and write their entitlements
+// The entitlements files are written in entitlementsFolder
+func prepareChildApps(appFolder string, entitlementsFolder string, params SignerParams) ([]childApp, error) {
+	children, err := findChildApps(appFolder)
+	if err != nil || len(children) == 0 {
+		return nil, err
+	}
+
+	appInfoPlist, _, err := utils.ReadPlist(filepath.Join(appFolder, "Info.plist"))
+	if err != nil {
+		return nil, err
+	}
+	parentIdentifier, _ := appInfoPlist["CFBundleIdentifier"].(string)
+
+	for i := range children {
+		child := &children[i]
+
+		infoPlistPath := filepath.Join(child.path, "Info.plist")
+		infoPlist, format, err := utils.ReadPlist(infoPlistPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the Info.plist of the %s %s: %s", child.kind, child.relativePath, err)
+		}
+		child.identifier, _ = infoPlist["CFBundleIdentifier"].(string)
+
+		// The watch extensions without their own profile use the profile of their watch app
+		child.profile = params.ProvisioninngProfile
+		fallback := "the app profile"
+		if child.parent != nil {
+			child.profile = child.parent.profile
+			fallback = "the profile of the " + child.parent.kind
+		}
+		matched := false
+		for _, childProfile := range params.ChildProfiles {
+			if childProfile.Pattern == child.relativePath || childProfile.Pattern == child.identifier || utils.MatchGlob(childProfile.Pattern, child.relativePath) {
+				child.profile = childProfile.Profile
+				matched = true
+			}
+		}
+		if !matched {
+			fmt.Fprintf(params.output(), "\033[33mWarning: no profile for the %s %s, %s is used (use --child-profile)\033[0m\n", child.kind, child.relativePath, fallback)
+		}
+
+		// Copy the entitlements, the profiles may be shared
+		entitlements := map[string]interface{}{}
+		for key, value := range child.profile.GetEntitlements() {
+			entitlements[key] = value
+		}
+
+		switch child.kind {
+		case "app clip":
+			if parentIdentifier != "" {
+				entitlements[parentApplicationIdentifiersKey] = []string{params.ProvisioninngProfile.TeamID + "." + parentIdentifier}
+			}
+		case "watch app":
+			if companion, _ := infoPlist[companionAppIdentifierKey].(string); parentIdentifier != "" && companion != parentIdentifier {
+				infoPlist[companionAppIdentifierKey] = parentIdentifier
+				if err := utils.WritePlist(infoPlistPath, infoPlist, format); err != nil {
+					return nil, err
+				}
+			}
+		case "watch extension":
+			// The WatchKit extensions name their watch app
+			extension, _ := infoPlist["NSExtension"].(map[string]interface{})
+			attributes, _ := extension["NSExtensionAttributes"].(map[string]interface{})
+			watchApp, hasWatchApp := attributes[watchAppIdentifierKey].(string)
+			if (hasWatchApp || extension["NSExtensionPointIdentifier"] == "com.apple.watchkit") && child.parent.identifier != "" && watchApp != child.parent.identifier {
+				if attributes == nil {
+					attributes = map[string]interface{}{}
+					extension["NSExtensionAttributes"] = attributes
+				}
+				attributes[watchAppIdentifierKey] = child.parent.identifier
+				if err := utils.WritePlist(infoPlistPath, infoPlist, format); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		child.entitlementsFile = filepath.Join(entitlementsFolder, fmt.Sprintf("entitlements-%d.plist", i+1))
+		if err := writeEntitlements(child.entitlementsFile, entitlements); err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(params.output(), "Found the %s %s (%s), profile: %s\n", child.kind, child.relativePath, child.identifier, child.profile.Name)
+	}
+
+	return children, nil
+}
+
+// Write entitlements to an xml plist file
+func writeEntitlements(path string, entitlements map[string]interface{}) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create entitlements file, error: %s", err)
+	}
+	defer file.Close()
+
+	encoder := plist.NewEncoder(file)
+	encoder.Indent("\t")
+	if err := encoder.Encode(entitlements); err != nil {
+		return fmt.Errorf("failed to encode entitlements, error: %s", err)
+	}
+	return nil
+}
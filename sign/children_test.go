@@ -0,0 +1,190 @@
+package sign
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/e-n-0/sign-app-cli/provisioningprofiles"
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// Return a profile of the bundle identifier, its entitlements hold its application identifier
+func testProfile(name string, identifier string) provisioningprofiles.ProvisioningProfile {
+	return provisioningprofiles.ProvisioningProfile{
+		Name:         name,
+		Path:         "/profiles/" + name + ".mobileprovision",
+		TeamID:       "TEAM123456",
+		Entitlements: map[string]interface{}{"application-identifier": "TEAM123456." + identifier},
+	}
+}
+
+func TestPrepareChildAppsWatchExtensions(t *testing.T) {
+	watchProfile := testProfile("watch", "com.example.test.watchkitapp")
+	complicationProfile := testProfile("complication", "com.example.test.watchkitapp.complication")
+
+	tests := []struct {
+		name          string
+		childProfiles []ChildProfile
+		expected      string
+	}{
+		{"profile by identifier", []ChildProfile{
+			{Pattern: "Watch/*.app", Profile: watchProfile},
+			{Pattern: "com.example.test.watchkitapp.complication", Profile: complicationProfile},
+		}, "complication"},
+		{"profile by path", []ChildProfile{
+			{Pattern: "Watch/Watch.app", Profile: watchProfile},
+			{Pattern: "Watch/Watch.app/PlugIns/Complication.appex", Profile: complicationProfile},
+		}, "complication"},
+		{"profile of the watch app", []ChildProfile{
+			{Pattern: "Watch/Watch.app", Profile: watchProfile},
+		}, "watch"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := writeTestApp(t)
+			params := SignerParams{
+				Output:               io.Discard,
+				ProvisioninngProfile: testProfile("app", "com.example.test"),
+				ChildProfiles:        test.childProfiles,
+			}
+
+			children, err := prepareChildApps(app, t.TempDir(), params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(children) != 2 {
+				t.Fatalf("found %d child apps", len(children))
+			}
+
+			extension := findChildApp(children, filepath.Join(app, "Watch", "Watch.app", "PlugIns", "Complication.appex", "Complication"))
+			if extension == nil || extension.kind != "watch extension" {
+				t.Fatalf("watch extension not found: %v", extension)
+			}
+			if extension.profile.Name != test.expected {
+				t.Errorf("watch extension signed with the profile %s, expected %s", extension.profile.Name, test.expected)
+			}
+			watchApp := findChildApp(children, filepath.Join(app, "Watch", "Watch.app", "Watch"))
+			if watchApp == nil || watchApp.profile.Name != "watch" {
+				t.Errorf("watch app signed with %v", watchApp)
+			}
+
+			entitlements, _, err := utils.ReadPlist(extension.entitlementsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entitlements["application-identifier"] != extension.profile.Entitlements["application-identifier"] {
+				t.Errorf("watch extension entitlements %v", entitlements)
+			}
+		})
+	}
+}
+
+func TestPrepareChildAppsWatchIdentifiers(t *testing.T) {
+	tests := []struct {
+		name      string
+		watchApp  map[string]interface{}
+		extension map[string]interface{}
+		watchKit  bool
+	}{
+		{"old identifiers", map[string]interface{}{companionAppIdentifierKey: "com.old.test"}, map[string]interface{}{
+			"NSExtensionPointIdentifier": "com.apple.watchkit",
+			"NSExtensionAttributes":      map[string]interface{}{watchAppIdentifierKey: "com.old.test.watchkitapp"},
+		}, true},
+		{"missing identifiers", map[string]interface{}{}, map[string]interface{}{"NSExtensionPointIdentifier": "com.apple.watchkit"}, true},
+		{"widget extension", map[string]interface{}{}, map[string]interface{}{"NSExtensionPointIdentifier": "com.apple.widgetkit-extension"}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := writeTestApp(t)
+			watchApp := filepath.Join(app, "Watch", "Watch.app")
+			extension := filepath.Join(watchApp, "PlugIns", "Complication.appex")
+			for _, bundle := range []struct {
+				path   string
+				values map[string]interface{}
+				key    string
+			}{{watchApp, test.watchApp, ""}, {extension, test.extension, "NSExtension"}} {
+				infoPlist, format, err := utils.ReadPlist(filepath.Join(bundle.path, "Info.plist"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bundle.key == "" {
+					for key, value := range bundle.values {
+						infoPlist[key] = value
+					}
+				} else {
+					infoPlist[bundle.key] = bundle.values
+				}
+				if err := utils.WritePlist(filepath.Join(bundle.path, "Info.plist"), infoPlist, format); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			params := SignerParams{Output: io.Discard, ProvisioninngProfile: testProfile("app", "com.example.test")}
+			if _, err := prepareChildApps(app, t.TempDir(), params); err != nil {
+				t.Fatal(err)
+			}
+
+			infoPlist, _, err := utils.ReadPlist(filepath.Join(watchApp, "Info.plist"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if infoPlist[companionAppIdentifierKey] != "com.example.test" {
+				t.Errorf("companion app %v", infoPlist[companionAppIdentifierKey])
+			}
+
+			infoPlist, _, err = utils.ReadPlist(filepath.Join(extension, "Info.plist"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			attributes, _ := infoPlist["NSExtension"].(map[string]interface{})["NSExtensionAttributes"].(map[string]interface{})
+			if test.watchKit && attributes[watchAppIdentifierKey] != "com.example.test.watchkitapp" {
+				t.Errorf("watch app of the extension %v", attributes[watchAppIdentifierKey])
+			}
+			if !test.watchKit && attributes != nil {
+				t.Errorf("attributes added to a widget extension: %v", attributes)
+			}
+		})
+	}
+}
+
+func TestPlanSigningWatchExtension(t *testing.T) {
+	app := writeTestApp(t)
+	params := SignerParams{
+		Output:               io.Discard,
+		ProvisioninngProfile: testProfile("app", "com.example.test"),
+		ChildProfiles: []ChildProfile{
+			{Pattern: "com.example.test.watchkitapp", Profile: testProfile("watch", "com.example.test.watchkitapp")},
+			{Pattern: "com.example.test.watchkitapp.complication", Profile: testProfile("complication", "com.example.test.watchkitapp.complication")},
+		},
+	}
+	children, err := prepareChildApps(app, t.TempDir(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, _, err := planSigning(app, params, children)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"Watch/Watch.app/PlugIns/Complication.appex": "/profiles/complication.mobileprovision",
+		"Watch/Watch.app":     "/profiles/watch.mobileprovision",
+		"PlugIns/Share.appex": "/profiles/app.mobileprovision",
+		".":                   "/profiles/app.mobileprovision",
+	}
+	found := 0
+	for _, item := range items {
+		if profilePath, ok := expected[item.relativePath]; ok {
+			found++
+			if item.profilePath != profilePath {
+				t.Errorf("%s signed with %s, expected %s", item.relativePath, item.profilePath, profilePath)
+			}
+		}
+	}
+	if found != len(expected) {
+		t.Errorf("planned %d of the %d bundles", found, len(expected))
+	}
+}
@@ -0,0 +1,375 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+	"howett.net/plist"
+)
+
+// A rule of the resource seal (_CodeSignature/CodeResources)
+type resourceRule struct {
+	pattern  string
+	omit     bool
+	optional bool
+	nested   bool
+	weight   int
+
+	matcher *regexp.Regexp
+}
+
+// Rules of the first version of the resource seal ("files") of iOS bundles
+var resourceRules = []resourceRule{
+	{pattern: "^.*", weight: 1},
+	{pattern: "^.*\\.lproj/", optional: true, weight: 1000},
+	{pattern: "^.*\\.lproj/locversion.plist$", omit: true, weight: 1100},
+	{pattern: "^Base\\.lproj/", weight: 1010},
+	{pattern: "^version.plist$", weight: 1},
+}
+
+// Rules of the second version of the resource seal ("files2") of iOS bundles
+var resourceRules2 = []resourceRule{
+	{pattern: ".*\\.dSYM($|/)", weight: 11},
+	{pattern: "^(.*/)?\\.DS_Store$", omit: true, weight: 2000},
+	{pattern: "^.*", weight: 1},
+	{pattern: "^.*\\.lproj/", optional: true, weight: 1000},
+	{pattern: "^.*\\.lproj/locversion.plist$", omit: true, weight: 1100},
+	{pattern: "^Base\\.lproj/", weight: 1010},
+	{pattern: "^Info\\.plist$", omit: true, weight: 20},
+	{pattern: "^PkgInfo$", omit: true, weight: 20},
+	{pattern: "^embedded\\.provisionprofile$", weight: 20},
+	{pattern: "^version\\.plist$", weight: 20},
+}
+
+// Rules of the first version of the resource seal of macOS bundles
+var macOSResourceRules = []resourceRule{
+	{pattern: "^Resources/", weight: 1},
+	{pattern: "^Resources/.*\\.lproj/", optional: true, weight: 1000},
+	{pattern: "^Resources/.*\\.lproj/locversion.plist$", omit: true, weight: 1100},
+	{pattern: "^Resources/Base\\.lproj/", weight: 1010},
+	{pattern: "^version.plist$", weight: 1},
+}
+
+// Rules of the second version of the resource seal of macOS bundles
+// Nested code is sealed by its code directory hash instead of its files
+var macOSResourceRules2 = []resourceRule{
+	{pattern: ".*\\.dSYM($|/)", weight: 11},
+	{pattern: "^(.*/)?\\.DS_Store$", omit: true, weight: 2000},
+	{pattern: "^(Frameworks|SharedFrameworks|PlugIns|Plug-ins|XPCServices|Helpers|MacOS|Library/(Automator|Spotlight|LoadableBundles|LoginItems))/", nested: true, weight: 10},
+	{pattern: "^.*", weight: 1},
+	{pattern: "^Info\\.plist$", omit: true, weight: 20},
+	{pattern: "^PkgInfo$", omit: true, weight: 20},
+	{pattern: "^Resources/", weight: 20},
+	{pattern: "^Resources/.*\\.lproj/", optional: true, weight: 1000},
+	{pattern: "^Resources/.*\\.lproj/locversion.plist$", omit: true, weight: 1100},
+	{pattern: "^Resources/Base\\.lproj/", weight: 1010},
+	{pattern: "^[^/]+$", nested: true, weight: 10},
+	{pattern: "^embedded\\.provisionprofile$", weight: 20},
+	{pattern: "^version\\.plist$", weight: 20},
+}
+
+// Rules of the resource seal for the bundle layout
+func bundleResourceRules(b *bundle) ([]resourceRule, []resourceRule) {
+	if b.macOS {
+		return macOSResourceRules, macOSResourceRules2
+	}
+	return resourceRules, resourceRules2
+}
+
+func init() {
+	for _, rules := range [][]resourceRule{resourceRules, resourceRules2, macOSResourceRules, macOSResourceRules2} {
+		for i := range rules {
+			rules[i].matcher = regexp.MustCompile(rules[i].pattern)
+		}
+	}
+}
+
+// Encode the rules as they are stored in CodeResources
+func encodeResourceRules(rules []resourceRule) map[string]interface{} {
+	encoded := map[string]interface{}{}
+	for _, rule := range rules {
+		if !rule.omit && !rule.optional && !rule.nested && rule.weight == 1 {
+			encoded[rule.pattern] = true
+			continue
+		}
+
+		value := map[string]interface{}{}
+		if rule.omit {
+			value["omit"] = true
+		}
+		if rule.optional {
+			value["optional"] = true
+		}
+		if rule.nested {
+			value["nested"] = true
+		}
+		if rule.weight != 1 {
+			value["weight"] = float64(rule.weight)
+		}
+		encoded[rule.pattern] = value
+	}
+	return encoded
+}
+
+// Decode the rules stored in CodeResources
+func decodeResourceRules(encoded map[string]interface{}) ([]resourceRule, error) {
+	var rules []resourceRule
+	for pattern, value := range encoded {
+		matcher, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource rule %s: %s", pattern, err)
+		}
+
+		rule := resourceRule{pattern: pattern, weight: 1, matcher: matcher}
+		if options, ok := value.(map[string]interface{}); ok {
+			rule.omit, _ = options["omit"].(bool)
+			rule.optional, _ = options["optional"].(bool)
+			rule.nested, _ = options["nested"].(bool)
+			if weight, ok := options["weight"].(float64); ok {
+				rule.weight = int(weight)
+			} else if weight, ok := options["weight"].(uint64); ok {
+				rule.weight = int(weight)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Find the rule with the highest weight matching the path, nil if none
+func matchResourceRule(rules []resourceRule, path string) *resourceRule {
+	var best *resourceRule
+	for i, rule := range rules {
+		if rule.matcher.MatchString(path) && (best == nil || rule.weight > best.weight) {
+			best = &rules[i]
+		}
+	}
+	return best
+}
+
+// A file of the bundle covered by the resource seal
+type resourceFile struct {
+	path    string
+	symlink string
+	sha1    []byte
+	sha256  []byte
+
+	// Nested code, sealed by the hash of its code directory and its designated requirement
+	nested      bool
+	cdhash      []byte
+	requirement string
+}
+
+// Read the seal of nested code from the signature of its main executable
+func readNestedCode(file *resourceFile, executable string) error {
+	data, err := os.ReadFile(executable)
+	if err != nil {
+		return err
+	}
+
+	signatures, err := macho.ReadSignatures(data)
+	if err != nil {
+		return fmt.Errorf("the nested code %s is not signed: %s", file.path, err)
+	}
+	signature := signatures[0]
+
+	file.nested = true
+	file.cdhash = signature.BestCodeDirectory().CDHash()
+	if signature.Requirements != nil {
+		if requirements, err := macho.ParseRequirements(signature.Requirements); err == nil {
+			if designated, ok := requirements[macho.RequirementDesignated]; ok {
+				file.requirement, err = macho.FormatRequirement(designated)
+				if err != nil {
+					return fmt.Errorf("invalid designated requirement of %s: %s", file.path, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// List the files of the bundle covered by the resource seal
+// The main executable and the signature folder of the bundle are excluded,
+// the nested code matching a nested rule is listed as a single item
+func listResourceFiles(b *bundle, rules []resourceRule) ([]resourceFile, error) {
+	var files []resourceFile
+	err := filepath.Walk(b.contents, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, _ := filepath.Rel(b.contents, path)
+		relativePath = filepath.ToSlash(relativePath)
+		if relativePath == "." || path == b.executable {
+			return nil
+		}
+		if relativePath == "_CodeSignature" && info.IsDir() {
+			return filepath.SkipDir
+		}
+
+		file := resourceFile{path: relativePath}
+		if rule := matchResourceRule(rules, relativePath); rule != nil && rule.nested && info.Mode()&os.ModeSymlink == 0 {
+			executable, err := nestedCodeExecutable(path, info)
+			if err != nil {
+				return err
+			}
+			if executable != "" {
+				if err := readNestedCode(&file, executable); err != nil {
+					return err
+				}
+				files = append(files, file)
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			file.symlink, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		} else {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			sha1Hash := sha1.Sum(content)
+			sha256Hash := sha256.Sum256(content)
+			file.sha1, file.sha256 = sha1Hash[:], sha256Hash[:]
+		}
+
+		files = append(files, file)
+		return nil
+	})
+
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, err
+}
+
+// Generate the _CodeSignature/CodeResources file sealing the resources of the bundle
+func makeCodeResources(b *bundle) ([]byte, error) {
+	rules, rules2 := bundleResourceRules(b)
+	files, err := listResourceFiles(b, rules2)
+	if err != nil {
+		return nil, err
+	}
+
+	files1 := map[string]interface{}{}
+	files2 := map[string]interface{}{}
+	for _, file := range files {
+		if rule := matchResourceRule(rules, file.path); rule != nil && !rule.omit && file.symlink == "" && !file.nested {
+			if rule.optional {
+				files1[file.path] = map[string]interface{}{"hash": file.sha1, "optional": true}
+			} else {
+				files1[file.path] = file.sha1
+			}
+		}
+
+		if rule := matchResourceRule(rules2, file.path); rule != nil && !rule.omit {
+			entry := map[string]interface{}{}
+			if file.nested {
+				entry["cdhash"] = file.cdhash
+				if file.requirement != "" {
+					entry["requirement"] = file.requirement
+				}
+			} else if file.symlink != "" {
+				entry["symlink"] = file.symlink
+			} else {
+				entry["hash"] = file.sha1
+				entry["hash2"] = file.sha256
+			}
+			if rule.optional {
+				entry["optional"] = true
+			}
+			files2[file.path] = entry
+		}
+	}
+
+	return plist.MarshalIndent(map[string]interface{}{
+		"files":  files1,
+		"files2": files2,
+		"rules":  encodeResourceRules(rules),
+		"rules2": encodeResourceRules(rules2),
+	}, plist.XMLFormat, "\t")
+}
+
+// Check the files of the bundle against its CodeResources
+func verifyCodeResources(b *bundle, codeResources []byte) error {
+	var seal struct {
+		Files2 map[string]interface{} `plist:"files2"`
+		Rules2 map[string]interface{} `plist:"rules2"`
+	}
+	if _, err := plist.Unmarshal(codeResources, &seal); err != nil {
+		return fmt.Errorf("invalid CodeResources: %s", err)
+	}
+
+	rules, err := decodeResourceRules(seal.Rules2)
+	if err != nil {
+		return err
+	}
+
+	files, err := listResourceFiles(b, rules)
+	if err != nil {
+		return err
+	}
+
+	found := map[string]bool{}
+	for _, file := range files {
+		rule := matchResourceRule(rules, file.path)
+		if rule == nil || rule.omit {
+			continue
+		}
+
+		entry, ok := seal.Files2[file.path].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("file added: %s", file.path)
+		}
+		found[file.path] = true
+
+		if file.nested {
+			if cdhash, ok := entry["cdhash"].([]byte); !ok || !bytes.Equal(cdhash, file.cdhash) {
+				return fmt.Errorf("nested code modified: %s", file.path)
+			}
+			continue
+		}
+
+		if file.symlink != "" {
+			if entry["symlink"] != file.symlink {
+				return fmt.Errorf("symbolic link modified: %s", file.path)
+			}
+			continue
+		}
+
+		if hash2, ok := entry["hash2"].([]byte); ok {
+			if !bytes.Equal(hash2, file.sha256) {
+				return fmt.Errorf("file modified: %s", file.path)
+			}
+		} else if hash, ok := entry["hash"].([]byte); !ok || !bytes.Equal(hash, file.sha1) {
+			return fmt.Errorf("file modified: %s", file.path)
+		}
+	}
+
+	for path, value := range seal.Files2 {
+		if entry, ok := value.(map[string]interface{}); ok && entry["optional"] == true {
+			continue
+		}
+		if !found[path] {
+			return fmt.Errorf("file missing: %s", path)
+		}
+	}
+
+	return nil
+}
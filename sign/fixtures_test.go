@@ -0,0 +1,120 @@
+package sign
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"howett.net/plist"
+)
+
+// Mach-O file types of the fixtures
+const (
+	testMachOExecute = 0x2
+	testMachODylib   = 0x6
+	testMachOObject  = 0x1
+	testMachODSYM    = 0xa
+)
+
+// Write a thin arm64 Mach-O header of the given file type, without load commands
+func writeTestMachO(t *testing.T, path string, fileType uint32) {
+	t.Helper()
+
+	header := make([]byte, 32)
+	binary.LittleEndian.PutUint32(header, 0xfeedfacf)
+	binary.LittleEndian.PutUint32(header[4:], 0x0100000c)
+	binary.LittleEndian.PutUint32(header[12:], fileType)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, header, 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Write a thin arm64 executable with a __TEXT and a __LINKEDIT segment, that can be signed
+func writeSignableTestMachO(t *testing.T, path string) {
+	t.Helper()
+
+	data := make([]byte, 0x2100)
+	binary.LittleEndian.PutUint32(data, 0xfeedfacf)
+	binary.LittleEndian.PutUint32(data[4:], 0x0100000c)
+	binary.LittleEndian.PutUint32(data[12:], testMachOExecute)
+	binary.LittleEndian.PutUint32(data[16:], 2)
+	binary.LittleEndian.PutUint32(data[20:], 152+72)
+
+	// __TEXT with its code section at 0x1000
+	text := data[32:]
+	binary.LittleEndian.PutUint32(text, 0x19)
+	binary.LittleEndian.PutUint32(text[4:], 152)
+	copy(text[8:], "__TEXT")
+	binary.LittleEndian.PutUint64(text[32:], 0x2000)
+	binary.LittleEndian.PutUint64(text[48:], 0x2000)
+	binary.LittleEndian.PutUint32(text[64:], 1)
+	copy(text[72:], "__text")
+	copy(text[72+16:], "__TEXT")
+	binary.LittleEndian.PutUint64(text[72+40:], 0x1000)
+	binary.LittleEndian.PutUint32(text[72+48:], 0x1000)
+
+	linkedit := data[32+152:]
+	binary.LittleEndian.PutUint32(linkedit, 0x19)
+	binary.LittleEndian.PutUint32(linkedit[4:], 72)
+	copy(linkedit[8:], "__LINKEDIT")
+	binary.LittleEndian.PutUint64(linkedit[24:], 0x2000)
+	binary.LittleEndian.PutUint64(linkedit[32:], 0x100)
+	binary.LittleEndian.PutUint64(linkedit[40:], 0x2000)
+	binary.LittleEndian.PutUint64(linkedit[48:], 0x100)
+
+	for i := 0x1000; i < len(data); i++ {
+		data[i] = byte(i * 7)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Write an iOS bundle with an Info.plist and its main executable
+// Return the path of the executable
+func writeTestBundle(t *testing.T, folder string, identifier string) string {
+	t.Helper()
+
+	name := filepath.Base(folder)
+	name = name[:len(name)-len(filepath.Ext(name))]
+	executable := filepath.Join(folder, name)
+	writeTestMachO(t, executable, testMachOExecute)
+
+	infoPlist, err := plist.Marshal(map[string]interface{}{
+		"CFBundleExecutable": name,
+		"CFBundleIdentifier": identifier,
+	}, plist.XMLFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(folder, "Info.plist"), infoPlist, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return executable
+}
+
+// Write an app with nested frameworks, a dylib, an extension and a watch app with its own extension
+// Return the app folder
+func writeTestApp(t *testing.T) string {
+	t.Helper()
+
+	app := filepath.Join(t.TempDir(), "Payload", "Test.app")
+	writeTestBundle(t, app, "com.example.test")
+	writeTestBundle(t, filepath.Join(app, "Frameworks", "A.framework"), "com.example.a")
+	writeTestBundle(t, filepath.Join(app, "Frameworks", "B.framework"), "com.example.b")
+	writeTestMachO(t, filepath.Join(app, "Frameworks", "libC.dylib"), testMachODylib)
+	writeTestBundle(t, filepath.Join(app, "PlugIns", "Share.appex"), "com.example.test.share")
+	writeTestBundle(t, filepath.Join(app, "PlugIns", "Share.appex", "Frameworks", "D.framework"), "com.example.d")
+	writeTestBundle(t, filepath.Join(app, "Watch", "Watch.app"), "com.example.test.watchkitapp")
+	writeTestBundle(t, filepath.Join(app, "Watch", "Watch.app", "PlugIns", "Complication.appex"), "com.example.test.watchkitapp.complication")
+	return app
+}
@@ -0,0 +1,139 @@
+package sign
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// Prefix of the icon files written into the app bundle
+const iconFilePrefix = "AppIcon"
+
+// An icon size in points and the scales it is rendered at
+type iconSize struct {
+	points float64
+	scales []int
+}
+
+var iPhoneIconSizes = []iconSize{
+	{20, []int{2, 3}},
+	{29, []int{2, 3}},
+	{40, []int{2, 3}},
+	{60, []int{2, 3}},
+}
+
+var iPadIconSizes = []iconSize{
+	{20, []int{1, 2}},
+	{29, []int{1, 2}},
+	{40, []int{1, 2}},
+	{76, []int{1, 2}},
+	{83.5, []int{2}},
+}
+
+// Base name of an icon file, as listed in CFBundleIconFiles (e.g. "AppIcon60x60")
+func iconBaseName(points float64) string {
+	size := strconv.FormatFloat(points, 'f', -1, 64)
+	return iconFilePrefix + size + "x" + size
+}
+
+// Render the icon sizes into the app folder and return the CFBundleIconFiles entries
+func writeIconFiles(appFolder string, source image.Image, sizes []iconSize, suffix string) ([]interface{}, error) {
+	var iconFiles []interface{}
+	for _, size := range sizes {
+		baseName := iconBaseName(size.points)
+		for _, scale := range size.scales {
+			fileName := baseName
+			if scale > 1 {
+				fileName += "@" + strconv.Itoa(scale) + "x"
+			}
+			fileName += suffix + ".png"
+
+			pixels := int(math.Round(size.points * float64(scale)))
+			err := utils.WritePNG(filepath.Join(appFolder, fileName), utils.ResizeSquare(source, pixels))
+			if err != nil {
+				return nil, fmt.Errorf("failed to write the icon %s: %s", fileName, err)
+			}
+		}
+		iconFiles = append(iconFiles, baseName)
+	}
+
+	return iconFiles, nil
+}
+
+// Check if the app supports iPad (UIDeviceFamily contains 2)
+func supportsIPad(infoPlist map[string]interface{}) bool {
+	if _, ok := infoPlist["CFBundleIcons~ipad"]; ok {
+		return true
+	}
+
+	families, _ := infoPlist["UIDeviceFamily"].([]interface{})
+	for _, family := range families {
+		if fmt.Sprint(family) == "2" {
+			return true
+		}
+	}
+	return false
+}
+
+// Point the CFBundleIcons entry of the Info.plist to the new icon files
+func setPrimaryIconFiles(infoPlist map[string]interface{}, key string, iconFiles []interface{}) {
+	icons, ok := infoPlist[key].(map[string]interface{})
+	if !ok {
+		icons = map[string]interface{}{}
+	}
+
+	primaryIcon, ok := icons["CFBundlePrimaryIcon"].(map[string]interface{})
+	if !ok {
+		primaryIcon = map[string]interface{}{}
+	}
+
+	primaryIcon["CFBundleIconFiles"] = iconFiles
+	icons["CFBundlePrimaryIcon"] = primaryIcon
+	infoPlist[key] = icons
+}
+
+// Replace the icon of the app with the given PNG file
+func replaceAppIcon(out io.Writer, appFolder string, iconPath string) error {
+	if iconPath == "" {
+		return nil
+	}
+
+	fmt.Fprintln(out, "Replacing the app icon...")
+	infoPlistPath := filepath.Join(appFolder, "Info.plist")
+	infoPlist, format, err := utils.ReadPlist(infoPlistPath)
+	if err != nil {
+		return err
+	}
+
+	source, err := utils.ReadPNG(iconPath)
+	if err != nil {
+		return fmt.Errorf("failed to read the icon %s: %s", iconPath, err)
+	}
+
+	iconFiles, err := writeIconFiles(appFolder, source, iPhoneIconSizes, "")
+	if err != nil {
+		return err
+	}
+	setPrimaryIconFiles(infoPlist, "CFBundleIcons", iconFiles)
+
+	if supportsIPad(infoPlist) {
+		iconFiles, err := writeIconFiles(appFolder, source, iPadIconSizes, "~ipad")
+		if err != nil {
+			return err
+		}
+		setPrimaryIconFiles(infoPlist, "CFBundleIcons~ipad", iconFiles)
+	}
+
+	// An icon from the asset catalog takes precedence over the icon files
+	if _, hasIconName := infoPlist["CFBundleIconName"]; hasIconName && utils.FileExists(filepath.Join(appFolder, "Assets.car")) {
+		// Print in yellow
+		fmt.Fprintln(out, "\033[33m"+"Warning: the app uses an asset catalog icon (CFBundleIconName), the icon in Assets.car will still be used on recent iOS versions"+"\033[0m")
+	}
+
+	return utils.WritePlist(infoPlistPath, infoPlist, format)
+}
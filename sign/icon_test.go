@@ -0,0 +1,144 @@
+package sign
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// Write a square PNG of the given size
+func writeTestPNG(t *testing.T, path string, size int) {
+	t.Helper()
+
+	source := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			source.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 0x80, A: 0xff})
+		}
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, source); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplaceAppIcon(t *testing.T) {
+	iPhoneFiles := []interface{}{"AppIcon20x20", "AppIcon29x29", "AppIcon40x40", "AppIcon60x60"}
+	iPadFiles := []interface{}{"AppIcon20x20", "AppIcon29x29", "AppIcon40x40", "AppIcon76x76", "AppIcon83.5x83.5"}
+
+	tests := []struct {
+		name      string
+		infoPlist map[string]interface{}
+		// Icon files and their size in pixels
+		files    map[string]int
+		iPad     bool
+		warning  bool
+		expected map[string]interface{}
+	}{
+		{"iPhone", map[string]interface{}{}, map[string]int{
+			"AppIcon20x20@2x.png": 40,
+			"AppIcon60x60@3x.png": 180,
+		}, false, false, map[string]interface{}{"CFBundlePrimaryIcon": map[string]interface{}{"CFBundleIconFiles": iPhoneFiles}}},
+		{"iPad", map[string]interface{}{"UIDeviceFamily": []interface{}{uint64(1), uint64(2)}}, map[string]int{
+			"AppIcon20x20@2x.png":          40,
+			"AppIcon20x20~ipad.png":        20,
+			"AppIcon76x76@2x~ipad.png":     152,
+			"AppIcon83.5x83.5@2x~ipad.png": 167,
+		}, true, false, map[string]interface{}{"CFBundlePrimaryIcon": map[string]interface{}{"CFBundleIconFiles": iPhoneFiles}}},
+		{"existing icons", map[string]interface{}{
+			"CFBundleIcons": map[string]interface{}{
+				"CFBundlePrimaryIcon":    map[string]interface{}{"CFBundleIconFiles": []interface{}{"Old60x60"}, "CFBundleIconName": "AppIcon"},
+				"CFBundleAlternateIcons": map[string]interface{}{"Dark": map[string]interface{}{}},
+			},
+			"CFBundleIconName": "AppIcon",
+		}, map[string]int{"AppIcon40x40@3x.png": 120}, false, true, map[string]interface{}{
+			"CFBundlePrimaryIcon":    map[string]interface{}{"CFBundleIconFiles": iPhoneFiles, "CFBundleIconName": "AppIcon"},
+			"CFBundleAlternateIcons": map[string]interface{}{"Dark": map[string]interface{}{}},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := filepath.Join(t.TempDir(), "Test.app")
+			writeTestBundle(t, app, "com.example.test")
+			infoPlist, format, err := utils.ReadPlist(filepath.Join(app, "Info.plist"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range test.infoPlist {
+				infoPlist[key] = value
+			}
+			if err := utils.WritePlist(filepath.Join(app, "Info.plist"), infoPlist, format); err != nil {
+				t.Fatal(err)
+			}
+			if test.warning {
+				if err := os.WriteFile(filepath.Join(app, "Assets.car"), []byte("assets"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			icon := filepath.Join(t.TempDir(), "icon.png")
+			writeTestPNG(t, icon, 256)
+
+			var output strings.Builder
+			if err := replaceAppIcon(&output, app, icon); err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(output.String(), "Warning") != test.warning {
+				t.Errorf("output %q", output.String())
+			}
+
+			for name, size := range test.files {
+				image, err := utils.ReadPNG(filepath.Join(app, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bounds := image.Bounds(); bounds.Dx() != size || bounds.Dy() != size {
+					t.Errorf("%s of %dx%d pixels, expected %d", name, bounds.Dx(), bounds.Dy(), size)
+				}
+			}
+
+			infoPlist, _, err = utils.ReadPlist(filepath.Join(app, "Info.plist"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(infoPlist["CFBundleIcons"], test.expected) {
+				t.Errorf("CFBundleIcons %v", infoPlist["CFBundleIcons"])
+			}
+			iPadIcons, hasIPad := infoPlist["CFBundleIcons~ipad"]
+			if hasIPad != test.iPad {
+				t.Errorf("CFBundleIcons~ipad %v", iPadIcons)
+			}
+			if test.iPad && !reflect.DeepEqual(iPadIcons, map[string]interface{}{"CFBundlePrimaryIcon": map[string]interface{}{"CFBundleIconFiles": iPadFiles}}) {
+				t.Errorf("CFBundleIcons~ipad %v", iPadIcons)
+			}
+		})
+	}
+}
+
+func TestReplaceAppIconInvalid(t *testing.T) {
+	app := filepath.Join(t.TempDir(), "Test.app")
+	writeTestBundle(t, app, "com.example.test")
+	icon := filepath.Join(t.TempDir(), "icon.png")
+	if err := os.WriteFile(icon, []byte("not a png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := replaceAppIcon(io.Discard, app, icon); err == nil || !strings.Contains(err.Error(), "failed to read the icon") {
+		t.Errorf("error %v", err)
+	}
+	if err := replaceAppIcon(io.Discard, app, ""); err != nil {
+		t.Errorf("no icon: %v", err)
+	}
+}
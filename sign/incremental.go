@@ -0,0 +1,220 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/e-n-0/sign-app-cli/codesigning"
+	"github.com/e-n-0/sign-app-cli/macho"
+	"github.com/e-n-0/sign-app-cli/utils"
+
+	"howett.net/plist"
+)
+
+// Action of the items already signed as requested, skipped by the incremental mode
+const actionUpToDate = "already signed"
+
+// Check if an item is already signed as requested: valid hashes, same identity, flags, timestamp
+// and designated requirement, same entitlements and same embedded profile
+// The app itself and the bundles containing re-signed items are always signed
+// resigned lists the paths of the items signed before this one
+func alreadySigned(item plannedItem, certificates *identityCertificates, folder string, resigned []string) bool {
+	if item.target.path == folder {
+		return false
+	}
+	if item.target.isBundle() {
+		for _, path := range resigned {
+			if strings.HasPrefix(path, item.target.path+string(filepath.Separator)) {
+				return false
+			}
+		}
+	}
+
+	signature, err := checkSignature(item.target)
+	if err != nil || !signedByIdentity(signature, certificates, item.options) || !signedWithOptions(signature, item.options) || !signedWithRequirements(signature, item.options) {
+		return false
+	}
+
+	entitlements, err := effectiveEntitlements(item)
+	if err != nil {
+		return false
+	}
+	var signed map[string]interface{}
+	if data := signature.EntitlementsPlist(); data != nil {
+		if _, err := plist.Unmarshal(data, &signed); err != nil {
+			return false
+		}
+	}
+	if len(entitlements)+len(signed) > 0 && !reflect.DeepEqual(entitlements, signed) {
+		return false
+	}
+
+	switch filepath.Ext(item.target.path) {
+	case ".app", ".appex":
+		if item.profilePath == "" {
+			break
+		}
+		b, err := readBundle(item.target.path)
+		if err != nil {
+			return false
+		}
+		embedded, err := os.ReadFile(b.profilePath())
+		if err != nil {
+			return false
+		}
+		profile, err := os.ReadFile(item.profilePath)
+		if err != nil || !bytes.Equal(embedded, profile) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Certificates of the signing identities, resolved once per run and safe for concurrent use
+// The certificates are given by their SHA-1 hash, in uppercase hexadecimal
+type identityCertificates struct {
+	signer Signer
+	lock   sync.Mutex
+	hashes map[string][]string
+}
+
+func newIdentityCertificates(signer Signer) *identityCertificates {
+	return &identityCertificates{signer: signer, hashes: map[string][]string{}}
+}
+
+// Return the certificates of an identity, the PKCS#12 file or the keychain are only read the first time
+func (certificates *identityCertificates) resolve(identity string) []string {
+	certificates.lock.Lock()
+	defer certificates.lock.Unlock()
+	if hashes, ok := certificates.hashes[identity]; ok {
+		return hashes
+	}
+
+	// The native backend signs with its own identity, ldid with the identity of its PKCS#12 file,
+	// codesign takes the SHA-1 of the certificate or the name of an installed identity
+	var hashes []string
+	switch signer := certificates.signer.(type) {
+	case NativeSigner:
+		if signer.Identity != nil {
+			hashes = []string{certificateHash(signer.Identity.Certificate)}
+		}
+	case LdidSigner:
+		if p12Identity, err := codesigning.LoadIdentityFromP12(signer.P12File, signer.P12Password); err == nil {
+			hashes = []string{certificateHash(p12Identity.Certificate)}
+		}
+	default:
+		if isCertificateHash(identity) {
+			hashes = []string{strings.ToUpper(identity)}
+		} else {
+			hashes, _ = codesigning.GetCodesigningCertHashes(identity)
+		}
+	}
+
+	certificates.hashes[identity] = hashes
+	return hashes
+}
+
+func certificateHash(certificate *x509.Certificate) string {
+	return fmt.Sprintf("%X", sha1.Sum(certificate.Raw))
+}
+
+// Check if a signature was made with the identity of the signing options
+func signedByIdentity(signature *macho.Signature, certificates *identityCertificates, options SignOptions) bool {
+	if options.Identity == AdhocIdentity || options.Pseudo {
+		return signature.CMS == nil
+	}
+	if signature.CMS == nil {
+		return false
+	}
+
+	certificate := signature.CMS.SignerCertificate()
+	if certificate == nil {
+		return false
+	}
+	return utils.StringInSlice(certificateHash(certificate), certificates.resolve(options.Identity))
+}
+
+// Check if a signature has the designated requirement of the signing options: the requested one,
+// or the default one, embedded by the native backend and implicit with codesign
+func signedWithRequirements(signature *macho.Signature, options SignOptions) bool {
+	if options.preserves("requirements") {
+		return true
+	}
+
+	var signed []byte
+	if signature.Requirements != nil {
+		requirements, err := macho.ParseRequirements(signature.Requirements)
+		if err != nil {
+			return false
+		}
+		signed = requirements[macho.RequirementDesignated]
+	}
+
+	if options.Requirements != "" {
+		compiled, err := macho.CompileRequirements(options.Requirements)
+		if err != nil {
+			return false
+		}
+		requested, err := macho.ParseRequirements(compiled)
+		if err != nil {
+			return false
+		}
+		if designated, ok := requested[macho.RequirementDesignated]; ok {
+			return bytes.Equal(signed, designated)
+		}
+	}
+
+	if signed == nil {
+		return true
+	}
+	if signature.CMS == nil || signature.CMS.SignerCertificate() == nil {
+		return false
+	}
+	return bytes.Equal(signed, macho.DefaultDesignatedRequirement(signature.BestCodeDirectory().Identifier, signature.CMS.SignerCertificate()))
+}
+
+// Check if an identity is given by the SHA-1 of its certificate
+func isCertificateHash(identity string) bool {
+	if len(identity) != 2*sha1.Size {
+		return false
+	}
+	_, err := hex.DecodeString(identity)
+	return err == nil
+}
+
+// Check if a signature has the code signing flags and the timestamp of the signing options
+func signedWithOptions(signature *macho.Signature, options SignOptions) bool {
+	var known, requested uint32
+	for _, flag := range signatureFlags {
+		known |= flag
+	}
+	for _, flag := range options.Flags {
+		requested |= signatureFlags[flag]
+	}
+
+	// The preserved flags are added to the requested ones
+	signed := signature.BestCodeDirectory().Flags & known
+	if options.preserves("flags") {
+		if signed&requested != requested {
+			return false
+		}
+	} else if signed != requested {
+		return false
+	}
+
+	// Without a timestamp option the backend chooses, ad-hoc signatures are never timestamped
+	if options.Timestamp == "" || signature.CMS == nil {
+		return true
+	}
+	timestamped := !signature.CMS.Timestamp.IsZero()
+	return timestamped == (options.Timestamp != TimestampNone)
+}
@@ -0,0 +1,206 @@
+package sign
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Create a self-signed identity
+func testIdentity(t *testing.T, commonName string) *macho.Identity {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName, OrganizationalUnit: []string{"TEAM123456"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &macho.Identity{Certificate: certificate, Key: key}
+}
+
+// Sign the signable test executable and return its signature
+func testSignature(t *testing.T, identity *macho.Identity, flags uint32) *macho.Signature {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "Test")
+	writeSignableTestMachO(t, path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := macho.Sign(data, macho.SignatureParams{Identifier: "Test", Identity: identity, Flags: flags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatures, err := macho.ReadSignatures(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signatures[0]
+}
+
+func TestSignedByIdentity(t *testing.T) {
+	identity := testIdentity(t, "Apple Development: Jane Doe (ABCDE12345)")
+	other := testIdentity(t, "Apple Development: Jane Doe (ABCDE12345)")
+	signature := testSignature(t, identity, 0)
+	hash := fmt.Sprintf("%X", sha1.Sum(identity.Certificate.Raw))
+
+	p12File := filepath.Join(t.TempDir(), "identity.p12")
+	p12, err := pkcs12.Encode(rand.Reader, identity.Key, identity.Certificate, nil, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p12File, p12, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		signer   Signer
+		identity string
+		expected bool
+	}{
+		{"codesign with the SHA-1", CodesignSigner{}, hash, true},
+		{"codesign with the lowercase SHA-1", CodesignSigner{}, strings.ToLower(hash), true},
+		{"codesign with another SHA-1", CodesignSigner{}, fmt.Sprintf("%X", sha1.Sum(other.Certificate.Raw)), false},
+		{"native with the identity", NativeSigner{Identity: identity}, "Apple Development", true},
+		{"native with another identity", NativeSigner{Identity: other}, "Apple Development", false},
+		{"ldid with the PKCS#12 file", LdidSigner{P12File: p12File, P12Password: "secret"}, "Apple Development", true},
+		{"ldid with a wrong password", LdidSigner{P12File: p12File, P12Password: "wrong"}, "Apple Development", false},
+		{"ad-hoc", CodesignSigner{}, AdhocIdentity, false},
+	}
+
+	for _, test := range tests {
+		if signedBy := signedByIdentity(signature, newIdentityCertificates(test.signer), SignOptions{Identity: test.identity}); signedBy != test.expected {
+			t.Errorf("%s: signed by the identity %v, expected %v", test.name, signedBy, test.expected)
+		}
+	}
+
+	if !signedByIdentity(testSignature(t, nil, 0), newIdentityCertificates(CodesignSigner{}), SignOptions{Identity: AdhocIdentity}) {
+		t.Error("ad-hoc signature not signed by the ad-hoc identity")
+	}
+
+	// The PKCS#12 file is only read once per run
+	certificates := newIdentityCertificates(LdidSigner{P12File: p12File, P12Password: "secret"})
+	if !signedByIdentity(signature, certificates, SignOptions{Identity: "Apple Development"}) {
+		t.Fatal("not signed by the identity of the PKCS#12 file")
+	}
+	if err := os.Remove(p12File); err != nil {
+		t.Fatal(err)
+	}
+	if !signedByIdentity(signature, certificates, SignOptions{Identity: "Apple Development"}) {
+		t.Error("the PKCS#12 file is read again")
+	}
+}
+
+func TestSignedWithRequirements(t *testing.T) {
+	identity := testIdentity(t, "Apple Development: Jane Doe (ABCDE12345)")
+	custom := `designated => identifier "Test" and anchor apple generic`
+
+	withRequirements := func(requirements string) *macho.Signature {
+		path := filepath.Join(t.TempDir(), "Test")
+		writeSignableTestMachO(t, path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params := macho.SignatureParams{Identifier: "Test", Identity: identity}
+		if requirements != "" {
+			params.Requirements, err = macho.CompileRequirements(requirements)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		signed, err := macho.Sign(data, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signatures, err := macho.ReadSignatures(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signatures[0]
+	}
+	defaultSigned := withRequirements("")
+	customSigned := withRequirements(custom)
+
+	tests := []struct {
+		name      string
+		signature *macho.Signature
+		options   SignOptions
+		expected  bool
+	}{
+		{"default requirement", defaultSigned, SignOptions{}, true},
+		{"custom requirement", customSigned, SignOptions{Requirements: custom}, true},
+		{"custom requirement added", defaultSigned, SignOptions{Requirements: custom}, false},
+		{"custom requirement removed", customSigned, SignOptions{}, false},
+		{"custom requirement changed", customSigned, SignOptions{Requirements: `designated => identifier "Other"`}, false},
+		{"requirements preserved", customSigned, SignOptions{PreserveMetadata: []string{"requirements"}}, true},
+		{"implicit requirement of an ad-hoc signature", testSignature(t, nil, 0), SignOptions{Identity: AdhocIdentity}, true},
+	}
+
+	for _, test := range tests {
+		if signedWith := signedWithRequirements(test.signature, test.options); signedWith != test.expected {
+			t.Errorf("%s: signed with the requirements %v, expected %v", test.name, signedWith, test.expected)
+		}
+	}
+}
+
+func TestSignedWithOptions(t *testing.T) {
+	identity := testIdentity(t, "Apple Development: Jane Doe (ABCDE12345)")
+	plain := testSignature(t, identity, 0)
+	runtime := testSignature(t, identity, macho.FlagRuntime)
+	adhoc := testSignature(t, nil, macho.FlagRuntime)
+
+	tests := []struct {
+		name      string
+		signature *macho.Signature
+		options   SignOptions
+		expected  bool
+	}{
+		{"no flags", plain, SignOptions{}, true},
+		{"missing runtime", plain, SignOptions{Flags: []string{"runtime"}}, false},
+		{"runtime", runtime, SignOptions{Flags: []string{"runtime"}}, true},
+		{"extra runtime", runtime, SignOptions{}, false},
+		{"extra runtime preserved", runtime, SignOptions{PreserveMetadata: []string{"flags"}}, true},
+		{"missing flag with preserved flags", runtime, SignOptions{Flags: []string{"library"}, PreserveMetadata: []string{"flags"}}, false},
+		{"no timestamp", plain, SignOptions{Timestamp: TimestampNone}, true},
+		{"missing timestamp", plain, SignOptions{Timestamp: TimestampDefault}, false},
+		{"missing timestamp from a server", plain, SignOptions{Timestamp: "http://timestamp.example.com"}, false},
+		{"ad-hoc timestamp", adhoc, SignOptions{Flags: []string{"runtime"}, Timestamp: TimestampDefault}, true},
+	}
+
+	for _, test := range tests {
+		if signedWith := signedWithOptions(test.signature, test.options); signedWith != test.expected {
+			t.Errorf("%s: signed with the options %v, expected %v", test.name, signedWith, test.expected)
+		}
+	}
+}
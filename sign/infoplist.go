@@ -0,0 +1,344 @@
+package sign
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// PlistEdit is a modification of an Info.plist key applied before signing
+type PlistEdit struct {
+	KeyPath string
+	Value   string
+	// Type of the value (see plistValueTypes), the type of the replaced value when not set
+	Type   string
+	Delete bool
+}
+
+// Types of the values given as key:type=value
+var plistValueTypes = []string{"string", "bool", "int", "real"}
+
+// Parse a "key=value" or "key:type=value" argument of the --set-plist flag
+func ParseSetPlistEdit(arg string) (PlistEdit, error) {
+	index := strings.Index(arg, "=")
+	if index <= 0 {
+		return PlistEdit{}, fmt.Errorf("invalid plist edit %q, expected key=value or key:type=value", arg)
+	}
+
+	edit := PlistEdit{KeyPath: arg[:index], Value: arg[index+1:]}
+	if typeIndex := strings.LastIndex(edit.KeyPath, ":"); typeIndex > 0 && utils.StringInSlice(edit.KeyPath[typeIndex+1:], plistValueTypes) {
+		edit.Type = edit.KeyPath[typeIndex+1:]
+		edit.KeyPath = edit.KeyPath[:typeIndex]
+	}
+	return edit, nil
+}
+
+// Split a key path like "CFBundleURLTypes.0.CFBundleURLSchemes" into its components
+// A dot can be part of a key name when escaped with a backslash
+func splitKeyPath(keyPath string) []string {
+	var components []string
+	var current strings.Builder
+	for i := 0; i < len(keyPath); i++ {
+		switch {
+		case keyPath[i] == '\\' && i+1 < len(keyPath) && keyPath[i+1] == '.':
+			current.WriteByte('.')
+			i++
+		case keyPath[i] == '.':
+			components = append(components, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(keyPath[i])
+		}
+	}
+	return append(components, current.String())
+}
+
+// Convert the string value of an edit to its type, or to the type of the value it replaces
+// The arrays and dictionaries are not replaced, their items are set one by one
+func convertPlistValue(edit PlistEdit, existing interface{}) (interface{}, error) {
+	switch existing.(type) {
+	case []interface{}:
+		return nil, fmt.Errorf("cannot replace an array with a value, set its items like %s.0", edit.KeyPath)
+	case map[string]interface{}:
+		return nil, fmt.Errorf("cannot replace a dictionary with a value, set its keys like %s.key", edit.KeyPath)
+	}
+
+	valueType := edit.Type
+	if valueType == "" {
+		switch existing.(type) {
+		case bool:
+			valueType = "bool"
+		case uint64, int64:
+			valueType = "int"
+		case float64:
+			valueType = "real"
+		default:
+			valueType = "string"
+		}
+	}
+
+	switch valueType {
+	case "bool":
+		return strconv.ParseBool(edit.Value)
+	case "int":
+		// The positive integers are read as uint64, like the plist decoder does
+		if value, err := strconv.ParseUint(edit.Value, 10, 64); err == nil {
+			return value, nil
+		}
+		return strconv.ParseInt(edit.Value, 10, 64)
+	case "real":
+		return strconv.ParseFloat(edit.Value, 64)
+	case "string":
+		return edit.Value, nil
+	default:
+		return nil, fmt.Errorf("unknown value type %q, expected one of: %s", valueType, strings.Join(plistValueTypes, ", "))
+	}
+}
+
+// Apply the edit to the node and return the updated node
+func applyPlistEditToNode(node interface{}, components []string, edit PlistEdit) (interface{}, error) {
+	key := components[0]
+	last := len(components) == 1
+
+	switch container := node.(type) {
+	case map[string]interface{}:
+		if last {
+			if edit.Delete {
+				delete(container, key)
+				return container, nil
+			}
+
+			value, err := convertPlistValue(edit, container[key])
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for %s: %s", edit.KeyPath, err)
+			}
+			container[key] = value
+			return container, nil
+		}
+
+		child, ok := container[key]
+		if !ok {
+			if edit.Delete {
+				return container, nil
+			}
+
+			// Create the missing intermediate container
+			if _, err := strconv.Atoi(components[1]); err == nil {
+				child = []interface{}{}
+			} else {
+				child = map[string]interface{}{}
+			}
+		}
+
+		updated, err := applyPlistEditToNode(child, components[1:], edit)
+		if err != nil {
+			return nil, err
+		}
+		container[key] = updated
+		return container, nil
+
+	case []interface{}:
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index > len(container) {
+			return nil, fmt.Errorf("invalid array index %q in %s", key, edit.KeyPath)
+		}
+
+		if last {
+			if edit.Delete {
+				if index == len(container) {
+					return container, nil
+				}
+				return append(container[:index], container[index+1:]...), nil
+			}
+
+			// Using the array length as index appends a new value
+			var existing interface{}
+			if index < len(container) {
+				existing = container[index]
+			}
+			value, err := convertPlistValue(edit, existing)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for %s: %s", edit.KeyPath, err)
+			}
+			if index == len(container) {
+				return append(container, value), nil
+			}
+			container[index] = value
+			return container, nil
+		}
+
+		if index == len(container) {
+			if edit.Delete {
+				return container, nil
+			}
+			container = append(container, map[string]interface{}{})
+		}
+
+		updated, err := applyPlistEditToNode(container[index], components[1:], edit)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = updated
+		return container, nil
+
+	default:
+		return nil, fmt.Errorf("cannot resolve %s: %q is not a dictionary or an array", edit.KeyPath, key)
+	}
+}
+
+// Apply the edits to the plist data
+func applyPlistEdits(data map[string]interface{}, edits []PlistEdit) error {
+	for _, edit := range edits {
+		if _, err := applyPlistEditToNode(data, splitKeyPath(edit.KeyPath), edit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply the edits to an Info.plist file, keeping its original format
+func editInfoPlist(infoPlistPath string, edits []PlistEdit) error {
+	data, format, err := utils.ReadPlist(infoPlistPath)
+	if err != nil {
+		return err
+	}
+
+	if err := applyPlistEdits(data, edits); err != nil {
+		return fmt.Errorf("failed to edit %s: %s", infoPlistPath, err)
+	}
+
+	return utils.WritePlist(infoPlistPath, data, format)
+}
+
+// List the app extensions (.appex) nested in the bundle
+func findAppExtensions(bundlePath string) ([]string, error) {
+	var extensions []string
+	err := filepath.WalkDir(bundlePath, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() && filepath.Ext(path) == ".appex" {
+			extensions = append(extensions, path)
+		}
+		return nil
+	})
+
+	return extensions, err
+}
+
+// Apply the Info.plist edits and localized display names to the app
+// and, if requested, to its extensions
+func updateInfoPlists(appFolder string, params SignerParams) error {
+	if len(params.PlistEdits) == 0 && len(params.LocalizedDisplayNames) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(params.output(), "Updating Info.plist...")
+	bundles := []string{appFolder}
+	if params.PlistEditExtensions {
+		extensions, err := findAppExtensions(appFolder)
+		if err != nil {
+			return err
+		}
+		bundles = append(bundles, extensions...)
+	}
+
+	for _, bundlePath := range bundles {
+		// The Info.plist and the localizations are in Contents for macOS bundles
+		b, err := readBundle(bundlePath)
+		if err != nil {
+			return err
+		}
+		if b == nil || b.infoPlist == "" {
+			return fmt.Errorf("missing Info.plist in %s", bundlePath)
+		}
+
+		if len(params.PlistEdits) > 0 {
+			if err := editInfoPlist(b.infoPlist, params.PlistEdits); err != nil {
+				return err
+			}
+		}
+
+		// Extensions are not required to be localized like the app
+		if err := updateLocalizedDisplayNames(params.output(), b.resources, params.LocalizedDisplayNames, bundlePath == appFolder); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Change the bundle identifier of the app, the nested bundles whose identifier starts with the old one
+// are renamed the same way, with the watch identifiers naming the app and the watch apps
+func changeBundleIdentifier(out io.Writer, appFolder string, identifier string) error {
+	infoPlist, _, err := utils.ReadPlist(filepath.Join(appFolder, "Info.plist"))
+	if err != nil {
+		return err
+	}
+	previous, _ := infoPlist["CFBundleIdentifier"].(string)
+	if previous == "" {
+		return fmt.Errorf("the app has no bundle identifier to change")
+	}
+	if previous == identifier {
+		return nil
+	}
+
+	rename := func(value interface{}) (string, bool) {
+		text, _ := value.(string)
+		switch {
+		case text == previous:
+			return identifier, true
+		case strings.HasPrefix(text, previous+"."):
+			return identifier + strings.TrimPrefix(text, previous), true
+		}
+		return "", false
+	}
+
+	targets, _, err := collectSignTargets(appFolder)
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		if !target.isBundle() {
+			continue
+		}
+		b, err := readBundle(target.path)
+		if err != nil || b == nil || b.infoPlist == "" {
+			continue
+		}
+		infoPlist, format, err := utils.ReadPlist(b.infoPlist)
+		if err != nil {
+			return err
+		}
+
+		changed := false
+		for _, key := range []string{"CFBundleIdentifier", companionAppIdentifierKey} {
+			if renamed, ok := rename(infoPlist[key]); ok {
+				infoPlist[key] = renamed
+				changed = true
+			}
+		}
+		extension, _ := infoPlist["NSExtension"].(map[string]interface{})
+		attributes, _ := extension["NSExtensionAttributes"].(map[string]interface{})
+		if renamed, ok := rename(attributes[watchAppIdentifierKey]); ok {
+			attributes[watchAppIdentifierKey] = renamed
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+
+		if err := utils.WritePlist(b.infoPlist, infoPlist, format); err != nil {
+			return err
+		}
+		relativePath, _ := filepath.Rel(appFolder, target.path)
+		fmt.Fprintf(out, "Changed the bundle identifier of %s to %s\n", filepath.ToSlash(relativePath), infoPlist["CFBundleIdentifier"])
+	}
+	return nil
+}
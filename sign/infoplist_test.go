@@ -0,0 +1,209 @@
+package sign
+
+import (
+	"io"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+func TestParseSetPlistEdit(t *testing.T) {
+	tests := []struct {
+		arg      string
+		expected PlistEdit
+		err      bool
+	}{
+		{"CFBundleDisplayName=My App", PlistEdit{KeyPath: "CFBundleDisplayName", Value: "My App"}, false},
+		{"UIFileSharingEnabled:bool=true", PlistEdit{KeyPath: "UIFileSharingEnabled", Value: "true", Type: "bool"}, false},
+		{"Build.Number:int=42", PlistEdit{KeyPath: "Build.Number", Value: "42", Type: "int"}, false},
+		{"Scale:real=1.5", PlistEdit{KeyPath: "Scale", Value: "1.5", Type: "real"}, false},
+		{"Version:string=1", PlistEdit{KeyPath: "Version", Value: "1", Type: "string"}, false},
+		{"URL=a=b", PlistEdit{KeyPath: "URL", Value: "a=b"}, false},
+		// Only the known types are read from the key
+		{"com.example:scheme=value", PlistEdit{KeyPath: "com.example:scheme", Value: "value"}, false},
+		{"=value", PlistEdit{}, true},
+		{"key", PlistEdit{}, true},
+	}
+
+	for _, test := range tests {
+		edit, err := ParseSetPlistEdit(test.arg)
+		if (err != nil) != test.err {
+			t.Errorf("%q: error %v", test.arg, err)
+			continue
+		}
+		if edit != test.expected {
+			t.Errorf("%q: edit %+v, expected %+v", test.arg, edit, test.expected)
+		}
+	}
+}
+
+func TestApplyPlistEdits(t *testing.T) {
+	// Return the Info.plist edited by the tests
+	infoPlist := func() map[string]interface{} {
+		return map[string]interface{}{
+			"CFBundleVersion":      "1",
+			"UIFileSharingEnabled": false,
+			"Build":                uint64(7),
+			"Offset":               int64(-3),
+			"Scale":                1.0,
+			"CFBundleURLTypes": []interface{}{
+				map[string]interface{}{"CFBundleURLName": "main", "CFBundleURLSchemes": []interface{}{"old"}},
+			},
+			"com.example.key": "dotted",
+		}
+	}
+
+	tests := []struct {
+		name  string
+		edits []PlistEdit
+		// Key path and expected value, nil for a deleted key
+		keyPath  []string
+		expected interface{}
+		err      string
+	}{
+		{"string", []PlistEdit{{KeyPath: "CFBundleVersion", Value: "42"}}, []string{"CFBundleVersion"}, "42", ""},
+		{"existing bool", []PlistEdit{{KeyPath: "UIFileSharingEnabled", Value: "true"}}, []string{"UIFileSharingEnabled"}, true, ""},
+		{"existing integer", []PlistEdit{{KeyPath: "Build", Value: "8"}}, []string{"Build"}, uint64(8), ""},
+		{"existing negative integer", []PlistEdit{{KeyPath: "Offset", Value: "-4"}}, []string{"Offset"}, int64(-4), ""},
+		{"existing real", []PlistEdit{{KeyPath: "Scale", Value: "2.5"}}, []string{"Scale"}, 2.5, ""},
+		{"invalid existing bool", []PlistEdit{{KeyPath: "UIFileSharingEnabled", Value: "maybe"}}, nil, nil, "invalid value for UIFileSharingEnabled"},
+		{"new bool", []PlistEdit{{KeyPath: "ITSAppUsesNonExemptEncryption", Value: "false", Type: "bool"}}, []string{"ITSAppUsesNonExemptEncryption"}, false, ""},
+		{"new integer", []PlistEdit{{KeyPath: "Count", Value: "1", Type: "int"}}, []string{"Count"}, uint64(1), ""},
+		{"new negative integer", []PlistEdit{{KeyPath: "Count", Value: "-1", Type: "int"}}, []string{"Count"}, int64(-1), ""},
+		{"new real", []PlistEdit{{KeyPath: "Ratio", Value: "0.5", Type: "real"}}, []string{"Ratio"}, 0.5, ""},
+		{"new string", []PlistEdit{{KeyPath: "Name", Value: "true"}}, []string{"Name"}, "true", ""},
+		{"type replaced", []PlistEdit{{KeyPath: "CFBundleVersion", Value: "2", Type: "int"}}, []string{"CFBundleVersion"}, uint64(2), ""},
+		{"invalid type value", []PlistEdit{{KeyPath: "Count", Value: "one", Type: "int"}}, nil, nil, "invalid value for Count"},
+		{"nested key", []PlistEdit{{KeyPath: "CFBundleURLTypes.0.CFBundleURLName", Value: "other"}}, []string{"CFBundleURLTypes", "0", "CFBundleURLName"}, "other", ""},
+		{"array item", []PlistEdit{{KeyPath: "CFBundleURLTypes.0.CFBundleURLSchemes.0", Value: "myapp"}}, []string{"CFBundleURLTypes", "0", "CFBundleURLSchemes"}, []interface{}{"myapp"}, ""},
+		{"appended array item", []PlistEdit{{KeyPath: "CFBundleURLTypes.0.CFBundleURLSchemes.1", Value: "myapp"}}, []string{"CFBundleURLTypes", "0", "CFBundleURLSchemes"}, []interface{}{"old", "myapp"}, ""},
+		{"appended typed item", []PlistEdit{{KeyPath: "Flags.0", Value: "true", Type: "bool"}}, []string{"Flags"}, []interface{}{true}, ""},
+		{"new nested keys", []PlistEdit{{KeyPath: "NSAppTransportSecurity.NSAllowsArbitraryLoads", Value: "true", Type: "bool"}}, []string{"NSAppTransportSecurity"}, map[string]interface{}{"NSAllowsArbitraryLoads": true}, ""},
+		{"new dictionary in an array", []PlistEdit{{KeyPath: "CFBundleURLTypes.1.CFBundleURLName", Value: "second"}}, []string{"CFBundleURLTypes", "1"}, map[string]interface{}{"CFBundleURLName": "second"}, ""},
+		{"escaped dot", []PlistEdit{{KeyPath: "com\\.example\\.key", Value: "edited"}}, []string{"com.example.key"}, "edited", ""},
+		{"array replaced", []PlistEdit{{KeyPath: "CFBundleURLTypes.0.CFBundleURLSchemes", Value: "a,b"}}, nil, nil, "cannot replace an array"},
+		{"dictionary replaced", []PlistEdit{{KeyPath: "CFBundleURLTypes.0", Value: "main"}}, nil, nil, "cannot replace a dictionary"},
+		{"typed array replaced", []PlistEdit{{KeyPath: "CFBundleURLTypes", Value: "1", Type: "int"}}, nil, nil, "cannot replace an array"},
+		{"invalid index", []PlistEdit{{KeyPath: "CFBundleURLTypes.3.CFBundleURLName", Value: "third"}}, nil, nil, "invalid array index"},
+		{"key of a value", []PlistEdit{{KeyPath: "CFBundleVersion.Major", Value: "1"}}, nil, nil, "is not a dictionary or an array"},
+		{"deleted key", []PlistEdit{{KeyPath: "UIFileSharingEnabled", Delete: true}}, []string{"UIFileSharingEnabled"}, nil, ""},
+		{"deleted array item", []PlistEdit{{KeyPath: "CFBundleURLTypes.0", Delete: true}}, []string{"CFBundleURLTypes"}, []interface{}{}, ""},
+		{"deleted missing key", []PlistEdit{{KeyPath: "Missing.Key", Delete: true}}, []string{"Missing"}, nil, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := infoPlist()
+			err := applyPlistEdits(data, test.edits)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var value interface{} = data
+			for _, key := range test.keyPath {
+				switch node := value.(type) {
+				case map[string]interface{}:
+					value = node[key]
+				case []interface{}:
+					index, _ := strconv.Atoi(key)
+					value = node[index]
+				}
+			}
+			if !reflect.DeepEqual(value, test.expected) {
+				t.Errorf("value %#v, expected %#v", value, test.expected)
+			}
+		})
+	}
+}
+
+func TestChangeBundleIdentifier(t *testing.T) {
+	app := writeTestApp(t)
+	watchApp := filepath.Join(app, "Watch", "Watch.app")
+	extension := filepath.Join(watchApp, "PlugIns", "Complication.appex")
+	for path, values := range map[string]map[string]interface{}{
+		watchApp: {companionAppIdentifierKey: "com.example.test"},
+		extension: {"NSExtension": map[string]interface{}{
+			"NSExtensionPointIdentifier": "com.apple.watchkit",
+			"NSExtensionAttributes":      map[string]interface{}{watchAppIdentifierKey: "com.example.test.watchkitapp"},
+		}},
+	} {
+		infoPlist, format, err := utils.ReadPlist(filepath.Join(path, "Info.plist"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, value := range values {
+			infoPlist[key] = value
+		}
+		if err := utils.WritePlist(filepath.Join(path, "Info.plist"), infoPlist, format); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := changeBundleIdentifier(io.Discard, app, "com.other.app"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The bundles of other identifiers keep them
+	tests := []struct {
+		path       string
+		identifier string
+	}{
+		{".", "com.other.app"},
+		{"Frameworks/A.framework", "com.example.a"},
+		{"PlugIns/Share.appex", "com.other.app.share"},
+		{"PlugIns/Share.appex/Frameworks/D.framework", "com.example.d"},
+		{"Watch/Watch.app", "com.other.app.watchkitapp"},
+		{"Watch/Watch.app/PlugIns/Complication.appex", "com.other.app.watchkitapp.complication"},
+	}
+	for _, test := range tests {
+		infoPlist, _, err := utils.ReadPlist(filepath.Join(app, test.path, "Info.plist"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if infoPlist["CFBundleIdentifier"] != test.identifier {
+			t.Errorf("%s identifier %v, expected %s", test.path, infoPlist["CFBundleIdentifier"], test.identifier)
+		}
+	}
+
+	infoPlist, _, err := utils.ReadPlist(filepath.Join(watchApp, "Info.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if infoPlist[companionAppIdentifierKey] != "com.other.app" {
+		t.Errorf("companion app %v", infoPlist[companionAppIdentifierKey])
+	}
+	infoPlist, _, err = utils.ReadPlist(filepath.Join(extension, "Info.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	attributes := infoPlist["NSExtension"].(map[string]interface{})["NSExtensionAttributes"].(map[string]interface{})
+	if attributes[watchAppIdentifierKey] != "com.other.app.watchkitapp" {
+		t.Errorf("watch app of the extension %v", attributes[watchAppIdentifierKey])
+	}
+
+	// The child profiles are matched with the new identifiers
+	params := SignerParams{
+		Output:               io.Discard,
+		ProvisioninngProfile: testProfile("app", "com.other.app"),
+		ChildProfiles: []ChildProfile{
+			{Pattern: "com.other.app.watchkitapp", Profile: testProfile("watch", "com.other.app.watchkitapp")},
+		},
+	}
+	children, err := prepareChildApps(app, t.TempDir(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if child := findChildApp(children, filepath.Join(watchApp, "Watch")); child == nil || child.profile.Name != "watch" {
+		t.Errorf("watch app signed with %v", child)
+	}
+}
@@ -0,0 +1,188 @@
+package sign
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// LdidSigner signs with ldid, available on jailbroken devices where codesign is missing
+type LdidSigner struct {
+	// PKCS#12 file of the identity, only ad-hoc and pseudo signatures are made when empty
+	P12File string
+	// ldid only takes the password on its command line (-U), it is visible to the other users in the process list
+	P12Password string
+}
+
+func (signer LdidSigner) Sign(path string, options SignOptions) error {
+	isMachO, err := macho.IsMachOFile(path)
+	if err != nil {
+		return err
+	}
+	if !isMachO {
+		return fmt.Errorf("ldid cannot sign %s: not a Mach-O file", path)
+	}
+
+	// ldid only embeds the entitlements, the identifier and the certificate
+	if len(options.Flags) > 0 {
+		return fmt.Errorf("ldid does not support the code signing options (%s) for %s", strings.Join(options.Flags, ","), path)
+	}
+	if len(options.PreserveMetadata) > 0 {
+		return fmt.Errorf("ldid cannot preserve the metadata of %s", path)
+	}
+	if options.Requirements != "" {
+		return fmt.Errorf("ldid cannot embed custom requirements in %s", path)
+	}
+	if options.Timestamp != "" && options.Timestamp != TimestampNone {
+		return fmt.Errorf("ldid cannot timestamp the signature of %s", path)
+	}
+
+	args := []string{"ldid", "-S" + options.EntitlementsFile}
+	if options.Identity != AdhocIdentity && !options.Pseudo {
+		if signer.P12File == "" {
+			return fmt.Errorf("the ldid backend requires a PKCS#12 file (--p12) to sign %s with a certificate", path)
+		}
+		args = append(args, "-K"+signer.P12File)
+		if signer.P12Password != "" {
+			args = append(args, "-U"+signer.P12Password)
+		}
+	}
+
+	// Only the file is given to ldid: with a bundle folder it would sign the nested code again
+	// The main executable of a bundle is identified by the bundle identifier
+	bundle := findExecutableBundle(path)
+	if bundle != nil && bundle.infoPlist != "" {
+		infoPlist, _, err := utils.ReadPlist(bundle.infoPlist)
+		if err != nil {
+			return err
+		}
+		if identifier, _ := infoPlist["CFBundleIdentifier"].(string); identifier != "" {
+			args = append(args, "-I"+identifier)
+		}
+	}
+	args = append(args, path)
+
+	if _, err := runLdid(options.context(), path, args...); err != nil {
+		return err
+	}
+
+	// ldid cannot bind the resources of a file to its signature, they are sealed in CodeResources
+	// like the native backend does, pseudo signatures do not seal them
+	if bundle != nil && !options.Pseudo {
+		codeResources, err := makeCodeResources(bundle)
+		if err != nil {
+			return fmt.Errorf("failed to seal the resources of %s: %s", bundle.path, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(bundle.codeResourcesPath()), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(bundle.codeResourcesPath(), codeResources, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ldid cannot check a signature, it only prints its hashes: the CDHashes printed by ldid
+// must be the ones of the signature and the signature is checked by the native verifier
+func (LdidSigner) Verify(path string) error {
+	output, err := runLdid(context.Background(), path, "ldid", "-h", path)
+	if err != nil {
+		return err
+	}
+
+	var cdHashes []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if key, value, found := strings.Cut(strings.TrimSpace(line), "="); found && key == "CDHash" {
+			cdHashes = append(cdHashes, strings.ToLower(value))
+		}
+	}
+	if len(cdHashes) == 0 {
+		return fmt.Errorf("%s is not signed", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	signatures, err := macho.ReadSignatures(data)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	known := map[string]bool{}
+	for _, signature := range signatures {
+		for _, cd := range signature.CodeDirectories {
+			known[hex.EncodeToString(cd.CDHash())] = true
+		}
+	}
+	for _, cdHash := range cdHashes {
+		if !known[cdHash] {
+			return fmt.Errorf("ldid reports the CDHash %s, not found in the signature of %s", cdHash, path)
+		}
+	}
+
+	// The Info.plist and the seal are only checked when the signature binds them
+	var infoPlist, codeResources []byte
+	bundle := findExecutableBundle(path)
+	if bundle != nil {
+		codeResources, err = os.ReadFile(bundle.codeResourcesPath())
+		if err != nil {
+			return fmt.Errorf("the resources of %s are not sealed", bundle.path)
+		}
+		if err := verifyCodeResources(bundle, codeResources); err != nil {
+			return fmt.Errorf("%s: %s", bundle.path, err)
+		}
+
+		cd := signatures[0].BestCodeDirectory()
+		if cd.SpecialSlot(macho.SlotResourceDirectory) == nil {
+			codeResources = nil
+		}
+		if bundle.infoPlist != "" && cd.SpecialSlot(macho.SlotInfoPlist) != nil {
+			infoPlist, err = os.ReadFile(bundle.infoPlist)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := macho.Verify(data, infoPlist, codeResources); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	return nil
+}
+
+// Run ldid and return its output, its error output is returned in the error
+// ldid is killed when the context is done
+func runLdid(ctx context.Context, path string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	process := exec.CommandContext(ctx, args[0], args[1:]...)
+	process.Stdout = &stdout
+	process.Stderr = &stderr
+
+	if err := process.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return nil, fmt.Errorf("ldid failed on %s: %s", path, message)
+	}
+	return stdout.Bytes(), nil
+}
+
+// Return the backend used when none is given: codesign, or ldid when only ldid is installed
+func DefaultSignerBackend() string {
+	if _, err := exec.LookPath("codesign"); err != nil {
+		if _, err := exec.LookPath("ldid"); err == nil {
+			return "ldid"
+		}
+	}
+	return "codesign"
+}
@@ -0,0 +1,217 @@
+package sign
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+)
+
+// Put a fake ldid first in the PATH, it records its arguments and prints the given output
+// Return the file of the recorded arguments, one per line, and the file of the output
+func fakeLdid(t *testing.T) (string, string) {
+	t.Helper()
+
+	folder := t.TempDir()
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > \"$LDID_ARGS\"\ncat \"$LDID_OUTPUT\" 2>/dev/null || true\n"
+	if err := os.WriteFile(filepath.Join(folder, "ldid"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	argsFile := filepath.Join(folder, "args")
+	outputFile := filepath.Join(folder, "output")
+	t.Setenv("PATH", folder+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("LDID_ARGS", argsFile)
+	t.Setenv("LDID_OUTPUT", outputFile)
+	return argsFile, outputFile
+}
+
+func readLdidArgs(t *testing.T, argsFile string) []string {
+	t.Helper()
+
+	content, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+func TestLdidSignArguments(t *testing.T) {
+	argsFile, _ := fakeLdid(t)
+	app := writeTestApp(t)
+	entitlements := filepath.Join(t.TempDir(), "entitlements.plist")
+
+	tests := []struct {
+		name     string
+		signer   LdidSigner
+		path     string
+		options  SignOptions
+		expected []string
+		sealed   string
+	}{
+		{
+			name:     "main executable of the app",
+			signer:   LdidSigner{P12File: "/certs/identity.p12", P12Password: "secret"},
+			path:     filepath.Join(app, "Test"),
+			options:  SignOptions{Identity: "Apple Development", EntitlementsFile: entitlements},
+			expected: []string{"-S" + entitlements, "-K/certs/identity.p12", "-Usecret", "-Icom.example.test", filepath.Join(app, "Test")},
+			sealed:   app,
+		},
+		{
+			name:     "nested bundle",
+			signer:   LdidSigner{P12File: "/certs/identity.p12"},
+			path:     filepath.Join(app, "Frameworks", "A.framework", "A"),
+			options:  SignOptions{Identity: "Apple Development"},
+			expected: []string{"-S", "-K/certs/identity.p12", "-Icom.example.a", filepath.Join(app, "Frameworks", "A.framework", "A")},
+			sealed:   filepath.Join(app, "Frameworks", "A.framework"),
+		},
+		{
+			name:     "ad-hoc library",
+			signer:   LdidSigner{P12File: "/certs/identity.p12"},
+			path:     filepath.Join(app, "Frameworks", "libC.dylib"),
+			options:  SignOptions{Identity: AdhocIdentity},
+			expected: []string{"-S", filepath.Join(app, "Frameworks", "libC.dylib")},
+		},
+		{
+			name:     "pseudo-signed bundle",
+			path:     filepath.Join(app, "PlugIns", "Share.appex", "Share"),
+			options:  SignOptions{Identity: "Apple Development", EntitlementsFile: entitlements, Pseudo: true},
+			expected: []string{"-S" + entitlements, "-Icom.example.test.share", filepath.Join(app, "PlugIns", "Share.appex", "Share")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Remove(argsFile)
+			if err := test.signer.Sign(test.path, test.options); err != nil {
+				t.Fatal(err)
+			}
+			if args := readLdidArgs(t, argsFile); !reflect.DeepEqual(args, test.expected) {
+				t.Errorf("ldid %q, expected %q", args, test.expected)
+			}
+			if test.sealed != "" {
+				if _, err := os.Stat(filepath.Join(test.sealed, "_CodeSignature", "CodeResources")); err != nil {
+					t.Errorf("resources of %s not sealed: %s", test.sealed, err)
+				}
+			}
+		})
+	}
+
+	// Pseudo signatures do not seal the resources
+	if _, err := os.Stat(filepath.Join(app, "PlugIns", "Share.appex", "_CodeSignature")); !os.IsNotExist(err) {
+		t.Errorf("pseudo-signed bundle sealed: %v", err)
+	}
+}
+
+func TestLdidVerifyBundle(t *testing.T) {
+	_, outputFile := fakeLdid(t)
+	folder := filepath.Join(t.TempDir(), "Test.app")
+	executable := writeTestBundle(t, folder, "com.example.test")
+	writeSignableTestMachO(t, executable)
+	if err := os.WriteFile(filepath.Join(folder, "resource.txt"), []byte("resource"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// ldid signs the executable alone, the seal is written next to it
+	data, _ := os.ReadFile(executable)
+	signed, err := macho.Sign(data, macho.SignatureParams{Identifier: "com.example.test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(executable, signed, 0755); err != nil {
+		t.Fatal(err)
+	}
+	signatures, _ := macho.ReadSignatures(signed)
+	if err := os.WriteFile(outputFile, []byte("CDHash="+hex.EncodeToString(signatures[0].BestCodeDirectory().CDHash())+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (LdidSigner{}).Verify(executable); err == nil || !strings.Contains(err.Error(), "not sealed") {
+		t.Errorf("bundle without seal: %v", err)
+	}
+
+	b := findExecutableBundle(executable)
+	codeResources, err := makeCodeResources(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(b.codeResourcesPath()), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b.codeResourcesPath(), codeResources, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (LdidSigner{}).Verify(executable); err != nil {
+		t.Errorf("sealed bundle: %s", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(folder, "resource.txt"), []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (LdidSigner{}).Verify(executable); err == nil {
+		t.Error("no error for a modified resource")
+	}
+}
+
+func TestLdidVerify(t *testing.T) {
+	argsFile, outputFile := fakeLdid(t)
+	path := filepath.Join(t.TempDir(), "Test")
+	writeSignableTestMachO(t, path)
+
+	// Unsigned: ldid prints no CDHash
+	if err := os.WriteFile(outputFile, []byte("Hash Type=SHA256\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (LdidSigner{}).Verify(path); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Errorf("unsigned file: %v", err)
+	}
+	if args := readLdidArgs(t, argsFile); !reflect.DeepEqual(args, []string{"-h", path}) {
+		t.Errorf("ldid %q", args)
+	}
+
+	data, _ := os.ReadFile(path)
+	signed, err := macho.Sign(data, macho.SignatureParams{Identifier: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, signed, 0755); err != nil {
+		t.Fatal(err)
+	}
+	signatures, err := macho.ReadSignatures(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cdHash := hex.EncodeToString(signatures[0].BestCodeDirectory().CDHash())
+
+	// CDHash of the signature
+	if err := os.WriteFile(outputFile, []byte("Identifier=Test\nCDHash="+cdHash+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (LdidSigner{}).Verify(path); err != nil {
+		t.Errorf("signed file: %s", err)
+	}
+
+	// Another CDHash
+	if err := os.WriteFile(outputFile, []byte("CDHash="+strings.Repeat("0", 40)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (LdidSigner{}).Verify(path); err == nil {
+		t.Error("no error for an unknown CDHash")
+	}
+
+	// Modified code
+	if err := os.WriteFile(outputFile, []byte("CDHash="+cdHash+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	signed[0x1800] ^= 0xff
+	if err := os.WriteFile(path, signed, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := (LdidSigner{}).Verify(path); err == nil {
+		t.Error("no error for a modified page")
+	}
+}
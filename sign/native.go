@@ -0,0 +1,200 @@
+package sign
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/e-n-0/sign-app-cli/codesigning"
+	"github.com/e-n-0/sign-app-cli/macho"
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// NativeSigner writes the code signatures in pure Go, without Apple's tools
+type NativeSigner struct {
+	// Identity of the signatures, only ad-hoc signatures are made when nil
+	Identity *macho.Identity
+}
+
+// Identifier of a file signed outside of a bundle
+// The identifier of the current signature is kept, otherwise the file name is used
+func standaloneIdentifier(path string, data []byte) string {
+	if signatures, err := macho.ReadSignatures(data); err == nil && len(signatures) > 0 {
+		if identifier := signatures[0].CodeDirectories[0].Identifier; identifier != "" {
+			return identifier
+		}
+	}
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// Keep the parts of the existing signature listed in the options
+// Nothing is kept from unsigned files
+func preserveMetadata(params *macho.SignatureParams, data []byte, options SignOptions) {
+	signatures, err := macho.ReadSignatures(data)
+	if err != nil || len(signatures) == 0 {
+		return
+	}
+	existing := signatures[0]
+	cd := existing.BestCodeDirectory()
+
+	if options.preserves("identifier") {
+		params.Identifier = cd.Identifier
+	}
+	if options.preserves("entitlements") {
+		params.Entitlements = existing.EntitlementsPlist()
+	}
+	if options.preserves("requirements") && existing.Requirements != nil {
+		params.Requirements = existing.Requirements
+	}
+	if options.preserves("flags") {
+		params.Flags |= cd.Flags &^ (macho.FlagAdhoc | macho.FlagLinkerSigned)
+	}
+}
+
+func (signer NativeSigner) Sign(path string, options SignOptions) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if !macho.IsMachO(data) && !macho.IsFat(data) {
+		fmt.Fprintln(options.output(), "Skipping", path, "(not a Mach-O file)")
+		return nil
+	}
+
+	params := macho.SignatureParams{
+		Identifier: standaloneIdentifier(path, data),
+	}
+
+	// Ad-hoc and pseudo signatures have no identity
+	if options.Identity != AdhocIdentity && !options.Pseudo {
+		if signer.Identity == nil {
+			return fmt.Errorf("the native backend requires a certificate and its private key to sign %s", path)
+		}
+		params.TeamID = codesigning.IdentityTeamID(*signer.Identity)
+		params.Identity = signer.Identity
+	}
+
+	if options.EntitlementsFile != "" {
+		params.Entitlements, err = os.ReadFile(options.EntitlementsFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The main executable of a bundle seals its Info.plist and resources,
+	// pseudo signatures only take the bundle identifier
+	var codeResourcesPath string
+	if bundle := findExecutableBundle(path); bundle != nil {
+		if bundle.infoPlist != "" {
+			infoPlist, _, err := utils.ReadPlist(bundle.infoPlist)
+			if err != nil {
+				return err
+			}
+			if identifier, _ := infoPlist["CFBundleIdentifier"].(string); identifier != "" {
+				params.Identifier = identifier
+			}
+
+			if !options.Pseudo {
+				params.InfoPlist, err = os.ReadFile(bundle.infoPlist)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if !options.Pseudo {
+			params.CodeResources, err = makeCodeResources(bundle)
+			if err != nil {
+				return fmt.Errorf("failed to seal the resources of %s: %s", bundle.path, err)
+			}
+			codeResourcesPath = bundle.codeResourcesPath()
+		}
+	}
+
+	// Signing options
+	for _, flag := range options.Flags {
+		params.Flags |= signatureFlags[flag]
+	}
+
+	switch {
+	case params.Identity == nil, options.Timestamp == "", options.Timestamp == TimestampNone:
+		// Only the CMS signature of an identity is timestamped
+	case options.Timestamp == TimestampDefault:
+		params.TimestampServer = macho.DefaultTimestampServer
+	default:
+		params.TimestampServer = options.Timestamp
+	}
+
+	if options.Requirements != "" {
+		params.Requirements, err = macho.CompileRequirements(options.Requirements)
+		if err != nil {
+			return fmt.Errorf("invalid requirements for %s: %s", path, err)
+		}
+	}
+
+	if len(options.PreserveMetadata) > 0 {
+		preserveMetadata(&params, data, options)
+	}
+
+	signed, err := macho.Sign(data, params)
+	if err != nil {
+		return fmt.Errorf("failed to sign %s: %s", path, err)
+	}
+
+	// A stopped signing leaves the file and the seal unchanged
+	if err := options.context().Err(); err != nil {
+		return err
+	}
+
+	if codeResourcesPath != "" {
+		if err := os.MkdirAll(filepath.Dir(codeResourcesPath), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(codeResourcesPath, params.CodeResources, 0644); err != nil {
+			return err
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, signed, info.Mode().Perm())
+}
+
+func (signer NativeSigner) Verify(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var infoPlist, codeResources []byte
+	bundle := findExecutableBundle(path)
+	if bundle != nil {
+		if bundle.infoPlist != "" {
+			infoPlist, err = os.ReadFile(bundle.infoPlist)
+			if err != nil {
+				return err
+			}
+		}
+
+		codeResources, err = os.ReadFile(bundle.codeResourcesPath())
+		if err != nil {
+			return fmt.Errorf("the resources of %s are not sealed", bundle.path)
+		}
+	}
+
+	if _, err := macho.Verify(data, infoPlist, codeResources); err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	if bundle != nil {
+		if err := verifyCodeResources(bundle, codeResources); err != nil {
+			return fmt.Errorf("%s: %s", bundle.path, err)
+		}
+	}
+
+	return nil
+}
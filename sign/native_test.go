@@ -0,0 +1,163 @@
+package sign
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/e-n-0/sign-app-cli/codesigning"
+	"github.com/e-n-0/sign-app-cli/macho"
+)
+
+func TestStandaloneIdentifierMalformed(t *testing.T) {
+	// A universal binary without architectures
+	empty := make([]byte, 8)
+	binary.BigEndian.PutUint32(empty, 0xcafebabe)
+	if identifier := standaloneIdentifier("/tmp/libTest.dylib", empty); identifier != "libTest" {
+		t.Errorf("identifier %q", identifier)
+	}
+
+	params := macho.SignatureParams{Identifier: "com.example.test"}
+	preserveMetadata(&params, empty, SignOptions{PreserveMetadata: []string{"identifier"}})
+	if params.Identifier != "com.example.test" {
+		t.Errorf("identifier %q", params.Identifier)
+	}
+}
+
+func TestNativeSignSkipOutput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	if err := (NativeSigner{}).Sign(path, SignOptions{Identity: AdhocIdentity, Output: &output}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.String(), "Skipping "+path) {
+		t.Errorf("output %q", output.String())
+	}
+}
+
+func TestNativeSignStopped(t *testing.T) {
+	folder := filepath.Join(t.TempDir(), "Test.app")
+	executable := writeTestBundle(t, folder, "com.example.test")
+	writeSignableTestMachO(t, executable)
+	data, _ := os.ReadFile(executable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := (NativeSigner{}).Sign(executable, SignOptions{Identity: AdhocIdentity, Context: ctx})
+	if err != context.Canceled {
+		t.Fatalf("error %v", err)
+	}
+
+	// Neither the executable nor the seal are written
+	if signed, _ := os.ReadFile(executable); !bytes.Equal(signed, data) {
+		t.Error("executable modified")
+	}
+	if _, err := os.Stat(filepath.Join(folder, "_CodeSignature")); !os.IsNotExist(err) {
+		t.Errorf("seal written: %v", err)
+	}
+
+	if err := (NativeSigner{}).Sign(executable, SignOptions{Identity: AdhocIdentity}); err != nil {
+		t.Fatal(err)
+	}
+	if err := (NativeSigner{}).Verify(executable); err != nil {
+		t.Error(err)
+	}
+}
+
+// Key command run by the tests: this test binary signing the digest of its standard input
+// with the PEM private key of SIGN_TEST_KEY
+func TestHelperKeyCommand(t *testing.T) {
+	if os.Getenv("SIGN_TEST_HELPER") != "1" {
+		return
+	}
+
+	digest, _ := io.ReadAll(os.Stdin)
+	data, _ := os.ReadFile(os.Getenv("SIGN_TEST_KEY"))
+	block, _ := pem.Decode(data)
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	signature, err := key.(crypto.Signer).Sign(rand.Reader, digest, crypto.SHA256)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(signature)
+	os.Exit(0)
+}
+
+func TestNativeSignKeyCommand(t *testing.T) {
+	folder := t.TempDir()
+	identity := testIdentity(t, "Apple Distribution: Jane Doe (TEAM123456)")
+	certificatePath := filepath.Join(folder, "cert.pem")
+	keyPath := filepath.Join(folder, "key.pem")
+	keyData, err := x509.MarshalPKCS8PrivateKey(identity.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certificatePath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: identity.Certificate.Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyData}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// The private key is only known by the command
+	command := fmt.Sprintf("SIGN_TEST_HELPER=1 SIGN_TEST_KEY='%s' '%s' -test.run=TestHelperKeyCommand", keyPath, os.Args[0])
+	commandIdentity, err := codesigning.LoadIdentityWithCommand(certificatePath, command)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := filepath.Join(folder, "Test.app")
+	executable := writeTestBundle(t, app, "com.example.test")
+	writeSignableTestMachO(t, executable)
+	signer := NativeSigner{Identity: &commandIdentity}
+	if err := signer.Sign(executable, SignOptions{Identity: codesigning.IdentityName(commandIdentity), Output: io.Discard}); err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.Verify(executable); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(executable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatures, err := macho.ReadSignatures(data)
+	if err != nil || len(signatures) != 1 || signatures[0].CMS == nil {
+		t.Fatalf("signatures %v, %v", signatures, err)
+	}
+	if certificate := signatures[0].CMS.SignerCertificate(); certificate == nil || !certificate.Equal(identity.Certificate) {
+		t.Errorf("signed by %v", certificate)
+	}
+	if cd := signatures[0].BestCodeDirectory(); cd.TeamID != "TEAM123456" || cd.Flags&macho.FlagAdhoc != 0 {
+		t.Errorf("team %s, flags %#x", cd.TeamID, cd.Flags)
+	}
+
+	// A failing command stops the signing
+	failing, err := codesigning.LoadIdentityWithCommand(certificatePath, "echo 'token locked' >&2; exit 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = (NativeSigner{Identity: &failing}).Sign(executable, SignOptions{Identity: codesigning.IdentityName(failing), Output: io.Discard})
+	if err == nil || !strings.Contains(err.Error(), "token locked") {
+		t.Errorf("error %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package sign
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// A file to copy into the app bundle, Dest is relative to the app folder
+type Injection struct {
+	Source string
+	Dest   string
+}
+
+// Parse a "src:dest" argument of the --inject flag
+func ParseInjection(arg string) (Injection, error) {
+	index := strings.LastIndex(arg, ":")
+	if index <= 0 || index == len(arg)-1 {
+		return Injection{}, fmt.Errorf("invalid injection %q, expected src:dest", arg)
+	}
+
+	return Injection{Source: arg[:index], Dest: arg[index+1:]}, nil
+}
+
+// Changes made to the files of the bundle, used for the summary
+type bundleChanges struct {
+	added    []string
+	replaced []string
+	removed  []string
+}
+
+func (changes *bundleChanges) print(out io.Writer) {
+	if len(changes.added)+len(changes.replaced)+len(changes.removed) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out, "Changed files:")
+	for _, list := range []struct {
+		prefix string
+		paths  []string
+	}{{"+", changes.added}, {"~", changes.replaced}, {"-", changes.removed}} {
+		sort.Strings(list.paths)
+		for _, path := range list.paths {
+			fmt.Fprintln(out, "  ", list.prefix, path)
+		}
+	}
+}
+
+// Resolve a path relative to the app folder, making sure it does not escape it
+func resolveBundlePath(appFolder string, relativePath string) (string, error) {
+	path := filepath.Join(appFolder, relativePath)
+	if path != appFolder && !strings.HasPrefix(path, appFolder+string(os.PathSeparator)) {
+		return "", fmt.Errorf("illegal path outside the app: %s", relativePath)
+	}
+	return path, nil
+}
+
+// Copy a file keeping its permissions and record the change
+func copyBundleFile(src string, dst string, appFolder string, changes *bundleChanges) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	relativePath, _ := filepath.Rel(appFolder, dst)
+	if utils.FileExists(dst) {
+		if utils.IsFolder(dst) {
+			return fmt.Errorf("cannot replace the folder %s with a file", relativePath)
+		}
+		changes.replaced = append(changes.replaced, relativePath)
+	} else {
+		changes.added = append(changes.added, relativePath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	input, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	output, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(output, input); err != nil {
+		output.Close()
+		return err
+	}
+
+	return output.Close()
+}
+
+// Copy a file or a folder tree into the app bundle
+func copyIntoBundle(src string, dst string, appFolder string, changes *bundleChanges) error {
+	return filepath.WalkDir(src, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+
+		return copyBundleFile(path, filepath.Join(dst, relativePath), appFolder, changes)
+	})
+}
+
+// Remove the files and folders of the bundle matching the glob pattern
+func removeFromBundle(appFolder string, pattern string, changes *bundleChanges) error {
+	var matches []string
+	err := filepath.WalkDir(appFolder, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, _ := filepath.Rel(appFolder, path)
+		if relativePath != "." && utils.MatchGlob(pattern, filepath.ToSlash(relativePath)) {
+			matches = append(matches, path)
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range matches {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+
+		relativePath, _ := filepath.Rel(appFolder, path)
+		changes.removed = append(changes.removed, relativePath)
+	}
+
+	return nil
+}
+
+// Apply the resource changes (removals, overlay and injected files) to the app bundle
+func applyResourceChanges(appFolder string, params SignerParams) error {
+	if len(params.RemovePaths) == 0 && params.OverlayFolder == "" && len(params.Injections) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(params.output(), "Updating the app resources...")
+	changes := &bundleChanges{}
+
+	for _, pattern := range params.RemovePaths {
+		if err := removeFromBundle(appFolder, pattern, changes); err != nil {
+			return fmt.Errorf("failed to remove %s: %s", pattern, err)
+		}
+	}
+
+	if params.OverlayFolder != "" {
+		if err := copyIntoBundle(params.OverlayFolder, appFolder, appFolder, changes); err != nil {
+			return fmt.Errorf("failed to apply the overlay: %s", err)
+		}
+	}
+
+	for _, injection := range params.Injections {
+		dst, err := resolveBundlePath(appFolder, injection.Dest)
+		if err != nil {
+			return err
+		}
+
+		// A destination ending with a slash or an existing folder receives the source inside it
+		if strings.HasSuffix(injection.Dest, "/") || utils.IsFolder(dst) {
+			dst = filepath.Join(dst, filepath.Base(injection.Source))
+		}
+
+		if err := copyIntoBundle(injection.Source, dst, appFolder, changes); err != nil {
+			return fmt.Errorf("failed to inject %s: %s", injection.Source, err)
+		}
+	}
+
+	changes.print(params.output())
+	return nil
+}
@@ -0,0 +1,175 @@
+package sign
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Write the files of a folder, the map values are their contents
+func writeTestFiles(t *testing.T, folder string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(folder, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Read the files of a folder, by their slash separated path
+func readTestFiles(t *testing.T, folder string) map[string]string {
+	t.Helper()
+
+	files := map[string]string{}
+	err := filepath.WalkDir(folder, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		relativePath, _ := filepath.Rel(folder, path)
+		files[filepath.ToSlash(relativePath)] = string(content)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestParseInjection(t *testing.T) {
+	tests := []struct {
+		arg      string
+		expected Injection
+		err      bool
+	}{
+		{"./config.json:config.json", Injection{Source: "./config.json", Dest: "config.json"}, false},
+		{"C:/files/a.txt:Resources/", Injection{Source: "C:/files/a.txt", Dest: "Resources/"}, false},
+		{"config.json", Injection{}, true},
+		{":config.json", Injection{}, true},
+		{"config.json:", Injection{}, true},
+	}
+	for _, test := range tests {
+		injection, err := ParseInjection(test.arg)
+		if (err != nil) != test.err || injection != test.expected {
+			t.Errorf("%q: injection %+v, error %v", test.arg, injection, err)
+		}
+	}
+}
+
+func TestApplyResourceChanges(t *testing.T) {
+	app := map[string]string{
+		"Info.plist":                       "plist",
+		"config.json":                      "old config",
+		"Base.lproj/Main.storyboard":       "storyboard",
+		"en.lproj/Localizable.strings":     "en",
+		"fr.lproj/Localizable.strings":     "fr",
+		"Frameworks/Debug.framework/Debug": "debug",
+	}
+
+	tests := []struct {
+		name       string
+		overlay    map[string]string
+		injections func(files string) []Injection
+		remove     []string
+		expected   map[string]string
+		summary    []string
+		err        string
+	}{
+		{name: "overlay", overlay: map[string]string{
+			"config.json":          "new config",
+			"Resources/banner.png": "banner",
+		}, expected: map[string]string{
+			"config.json":          "new config",
+			"Resources/banner.png": "banner",
+		}, summary: []string{"+ Resources/banner.png", "~ config.json"}},
+		{name: "injections", injections: func(files string) []Injection {
+			return []Injection{
+				{Source: filepath.Join(files, "settings.plist"), Dest: "Settings.bundle/Root.plist"},
+				{Source: filepath.Join(files, "fonts"), Dest: "Fonts/"},
+				{Source: filepath.Join(files, "settings.plist"), Dest: "Base.lproj"},
+			}
+		}, expected: map[string]string{
+			"Settings.bundle/Root.plist": "settings",
+			"Fonts/fonts/Regular.ttf":    "font",
+			"Base.lproj/settings.plist":  "settings",
+		}, summary: []string{"+ Base.lproj/settings.plist", "+ Fonts/fonts/Regular.ttf", "+ Settings.bundle/Root.plist"}},
+		{name: "removals", remove: []string{"*.lproj/Localizable.strings", "Frameworks/Debug.framework"}, expected: map[string]string{
+			"en.lproj/Localizable.strings":     "",
+			"fr.lproj/Localizable.strings":     "",
+			"Frameworks/Debug.framework/Debug": "",
+		}, summary: []string{"- Frameworks/Debug.framework", "- en.lproj/Localizable.strings", "- fr.lproj/Localizable.strings"}},
+		{name: "injection outside the app", injections: func(files string) []Injection {
+			return []Injection{{Source: filepath.Join(files, "settings.plist"), Dest: "../settings.plist"}}
+		}, err: "illegal path outside the app"},
+		{name: "folder replaced by a file", overlay: map[string]string{"Base.lproj": "file"}, err: "cannot replace the folder Base.lproj"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			folder := t.TempDir()
+			appFolder := filepath.Join(folder, "Test.app")
+			writeTestFiles(t, appFolder, app)
+			files := filepath.Join(folder, "files")
+			writeTestFiles(t, files, map[string]string{"settings.plist": "settings", "fonts/Regular.ttf": "font"})
+
+			var output strings.Builder
+			params := SignerParams{Output: &output, RemovePaths: test.remove}
+			if test.overlay != nil {
+				params.OverlayFolder = filepath.Join(folder, "overlay")
+				writeTestFiles(t, params.OverlayFolder, test.overlay)
+			}
+			if test.injections != nil {
+				params.Injections = test.injections(files)
+			}
+
+			err := applyResourceChanges(appFolder, params)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The files not in expected are unchanged, the empty expected ones are removed
+			expected := map[string]string{}
+			for name, content := range app {
+				expected[name] = content
+			}
+			for name, content := range test.expected {
+				if content == "" {
+					delete(expected, name)
+				} else {
+					expected[name] = content
+				}
+			}
+			if files := readTestFiles(t, appFolder); !reflect.DeepEqual(files, expected) {
+				t.Errorf("files %v, expected %v", files, expected)
+			}
+
+			var summary []string
+			for _, line := range strings.Split(output.String(), "\n") {
+				if strings.HasPrefix(line, "   ") {
+					summary = append(summary, strings.TrimSpace(line))
+				}
+			}
+			sort.Strings(summary)
+			if !reflect.DeepEqual(summary, test.summary) {
+				t.Errorf("summary %q, expected %q", summary, test.summary)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package sign
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Run the items of a signing order, at most jobs at the same time
+// An item starts once the items nested in it are done, so a bundle is signed after its content
+// With one job the items run in the signing order
+// The first error stops starting new items and cancels the context given to the running ones,
+// they are waited for before returning it
+func runSigningOrder(items []plannedItem, jobs int, run func(ctx context.Context, i int) error) error {
+	if jobs < 1 {
+		jobs = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The nested items come first in the signing order
+	pending := make([]int, len(items))
+	dependents := make([][]int, len(items))
+	for i, item := range items {
+		if !item.target.isBundle() {
+			continue
+		}
+		for j := 0; j < i; j++ {
+			if strings.HasPrefix(items[j].target.path, item.target.path+string(filepath.Separator)) {
+				pending[i]++
+				dependents[j] = append(dependents[j], i)
+			}
+		}
+	}
+
+	var ready []int
+	for i := range items {
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	type result struct {
+		index int
+		err   error
+	}
+	done := make(chan result)
+
+	var firstErr error
+	running := 0
+	for {
+		// The ready items start in signing order
+		for firstErr == nil && running < jobs && len(ready) > 0 {
+			index := ready[0]
+			ready = ready[1:]
+			running++
+			go func(index int) {
+				var err error
+				// A panic of an item fails the run instead of the whole program
+				defer func() {
+					if recovered := recover(); recovered != nil {
+						err = fmt.Errorf("%v", recovered)
+					}
+					done <- result{index, err}
+				}()
+				err = run(ctx, index)
+			}(index)
+		}
+		if running == 0 {
+			return firstErr
+		}
+
+		finished := <-done
+		running--
+		if finished.err != nil {
+			if firstErr == nil {
+				firstErr = finished.err
+				cancel()
+			}
+			continue
+		}
+		for _, dependent := range dependents[finished.index] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+		sort.Ints(ready)
+	}
+}
@@ -0,0 +1,152 @@
+package sign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Plan the signing of the test app
+func testSigningOrder(t *testing.T) []plannedItem {
+	t.Helper()
+
+	app := writeTestApp(t)
+	items, _, err := planSigning(app, SignerParams{Output: io.Discard, Adhoc: true}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+// Check if the item is nested in the bundle
+func nestedIn(item plannedItem, bundle plannedItem) bool {
+	return bundle.target.isBundle() && strings.HasPrefix(item.target.path, bundle.target.path+string(filepath.Separator))
+}
+
+func TestRunSigningOrderDependencies(t *testing.T) {
+	items := testSigningOrder(t)
+
+	for _, jobs := range []int{1, 2, 4, 16} {
+		t.Run(fmt.Sprintf("%d jobs", jobs), func(t *testing.T) {
+			var lock sync.Mutex
+			var events []string
+			running, maxRunning := 0, 0
+			started := make([]int, len(items))
+			finished := make([]int, len(items))
+
+			err := runSigningOrder(items, jobs, func(_ context.Context, i int) error {
+				lock.Lock()
+				events = append(events, "start")
+				started[i] = len(events)
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				lock.Unlock()
+
+				time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+
+				lock.Lock()
+				events = append(events, "finish")
+				finished[i] = len(events)
+				running--
+				lock.Unlock()
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if maxRunning > jobs {
+				t.Errorf("%d items signed at the same time", maxRunning)
+			}
+			for i, item := range items {
+				if started[i] == 0 {
+					t.Errorf("%s not signed", item.relativePath)
+				}
+				for j, nested := range items {
+					if nestedIn(nested, item) && finished[j] > started[i] {
+						t.Errorf("%s started before %s, nested in it, is done", item.relativePath, nested.relativePath)
+					}
+				}
+				// One job signs in the signing order
+				if jobs == 1 && started[i] != 2*i+1 {
+					t.Errorf("%s signed at position %d", item.relativePath, started[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRunSigningOrderPanic(t *testing.T) {
+	items := testSigningOrder(t)
+	err := runSigningOrder(items, 2, func(_ context.Context, i int) error {
+		if i == 1 {
+			panic("broken item")
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "broken item" {
+		t.Errorf("error %v", err)
+	}
+}
+
+// Signer failing the jobs-th item it signs, the items signed before block until they are cancelled
+type blockingSigner struct {
+	jobs int
+
+	lock      sync.Mutex
+	calls     []string
+	cancelled int
+}
+
+func (signer *blockingSigner) Sign(path string, options SignOptions) error {
+	signer.lock.Lock()
+	signer.calls = append(signer.calls, path)
+	call := len(signer.calls)
+	signer.lock.Unlock()
+
+	if call == signer.jobs {
+		return errors.New("signing failed")
+	}
+
+	select {
+	case <-options.context().Done():
+		signer.lock.Lock()
+		signer.cancelled++
+		signer.lock.Unlock()
+		return options.context().Err()
+	case <-time.After(5 * time.Second):
+		return errors.New("not cancelled")
+	}
+}
+
+func (signer *blockingSigner) Verify(path string) error {
+	return nil
+}
+
+func TestSignPathFirstError(t *testing.T) {
+	app := writeTestApp(t)
+	signer := &blockingSigner{jobs: 3}
+	params := SignerParams{Signer: signer, Output: io.Discard, Adhoc: true, Jobs: signer.jobs}
+
+	_, err := signPath(app, params, nil, nil)
+	if err == nil || err.Error() != "signing failed" {
+		t.Fatalf("error %v, expected the first error", err)
+	}
+
+	// The running items are cancelled and no item starts after the error
+	if len(signer.calls) != signer.jobs {
+		t.Errorf("%d items signed: %v", len(signer.calls), signer.calls)
+	}
+	if signer.cancelled != signer.jobs-1 {
+		t.Errorf("%d running items cancelled, expected %d", signer.cancelled, signer.jobs-1)
+	}
+}
@@ -0,0 +1,409 @@
+package sign
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+	"github.com/e-n-0/sign-app-cli/provisioningprofiles"
+	"github.com/e-n-0/sign-app-cli/utils"
+
+	"howett.net/plist"
+)
+
+// What a signing run would do, the items are in signing order
+type SigningPlan struct {
+	Input string     `json:"input"`
+	App   string     `json:"app"`
+	Items []PlanItem `json:"items"`
+
+	// Items removed by --strip, relative to the extracted input
+	Stripped []string `json:"stripped,omitempty"`
+	// Items that look like code but are not signed
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// An item of the signing plan
+type PlanItem struct {
+	// Path relative to the app, "." for the app itself
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	// Rules changing how the item is signed, as given on the command line
+	Rules []string `json:"rules,omitempty"`
+
+	Identity         string                 `json:"identity,omitempty"`
+	Profile          string                 `json:"profile,omitempty"`
+	ProfilePath      string                 `json:"profilePath,omitempty"`
+	Entitlements     map[string]interface{} `json:"entitlements,omitempty"`
+	Options          []string               `json:"options,omitempty"`
+	Timestamp        string                 `json:"timestamp,omitempty"`
+	PreserveMetadata []string               `json:"preserveMetadata,omitempty"`
+	Requirements     string                 `json:"requirements,omitempty"`
+	Pseudo           bool                   `json:"pseudo,omitempty"`
+
+	// Files of the item changed by the run, relative to the app
+	Added    []string `json:"added,omitempty"`
+	Modified []string `json:"modified,omitempty"`
+	Removed  []string `json:"removed,omitempty"`
+}
+
+// Kinds of file changes, with the prefixes used by bundleChanges
+const (
+	fileAdded    = "+"
+	fileModified = "~"
+	fileRemoved  = "-"
+)
+
+// Build the signing plan of the input file without signing anything
+// The input is always extracted or copied, the changes made before signing are applied to the copy
+func PlanSigning(params SignerParams) (*SigningPlan, error) {
+	fmt.Fprintln(params.output(), "Planning the signing of file:", params.InputFile)
+
+	inputFile := filepath.Clean(params.InputFile)
+	if _, err := inputType(inputFile); err != nil {
+		return nil, err
+	}
+
+	tmpFolder, err := os.MkdirTemp("", "sign-app-cli-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary folder: %s", err)
+	}
+	defer os.RemoveAll(tmpFolder)
+
+	workFolder, appFolder, err := openInput(params.output(), inputFile, tmpFolder, false, params.IncludeSymbols)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setupEntitlements(&params, tmpFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	// The files changed before signing are found by comparing the app before and after
+	before, err := hashFiles(appFolder)
+	if err != nil {
+		return nil, err
+	}
+	strippedItems, children, err := prepareApp(workFolder, appFolder, params)
+	if err != nil {
+		return nil, err
+	}
+	after, err := hashFiles(appFolder)
+	if err != nil {
+		return nil, err
+	}
+
+	items, skippedItems, err := planSigning(appFolder, params, children)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := signingProfiles(params, children)
+
+	// The incremental mode skips the items already signed, like signPath does
+	if params.Incremental {
+		var resigned []string
+		certificates := newIdentityCertificates(params.Signer)
+		for i, item := range items {
+			if item.action != actionSign {
+				continue
+			}
+			if alreadySigned(item, certificates, appFolder, resigned) {
+				items[i].action = actionUpToDate
+				skippedItems = append(skippedItems, fmt.Sprintf("%s (%s)", item.relativePath, actionUpToDate))
+				continue
+			}
+			resigned = append(resigned, item.target.path)
+		}
+	}
+
+	plan := &SigningPlan{Input: inputFile, App: filepath.Base(appFolder), Stripped: strippedItems, Skipped: skippedItems}
+	changes := make([]map[string]string, len(items))
+	for i, item := range items {
+		changes[i] = map[string]string{}
+
+		planItem, err := planItem(item, profiles)
+		if err != nil {
+			return nil, err
+		}
+		plan.Items = append(plan.Items, planItem)
+	}
+
+	// The changes made before signing belong to the innermost bundle sealing them,
+	// the nested bundles come first in the signing order
+	addChange := func(relativePath string, kind string) {
+		for i, item := range items {
+			if item.target.executable == "" {
+				continue
+			}
+			if item.relativePath == "." || relativePath == item.relativePath || strings.HasPrefix(relativePath, item.relativePath+"/") {
+				changes[i][relativePath] = kind
+				return
+			}
+		}
+	}
+	for path, hash := range after {
+		if previous, ok := before[path]; !ok {
+			addChange(path, fileAdded)
+		} else if previous != hash {
+			addChange(path, fileModified)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			addChange(path, fileRemoved)
+		}
+	}
+
+	// Files written by the signing itself
+	for i, item := range items {
+		if item.action != actionSign {
+			continue
+		}
+		for path, kind := range signedFiles(appFolder, item, after) {
+			if _, ok := changes[i][path]; !ok {
+				changes[i][path] = kind
+			}
+		}
+	}
+
+	for i := range plan.Items {
+		planItem := &plan.Items[i]
+		for path, kind := range changes[i] {
+			switch kind {
+			case fileAdded:
+				planItem.Added = append(planItem.Added, path)
+			case fileModified:
+				planItem.Modified = append(planItem.Modified, path)
+			case fileRemoved:
+				planItem.Removed = append(planItem.Removed, path)
+			}
+		}
+		sort.Strings(planItem.Added)
+		sort.Strings(planItem.Modified)
+		sort.Strings(planItem.Removed)
+	}
+
+	return plan, nil
+}
+
+// Describe how an item is signed
+func planItem(item plannedItem, profiles map[string]provisioningprofiles.ProvisioningProfile) (PlanItem, error) {
+	planned := PlanItem{Path: item.relativePath, Action: item.action, Rules: item.rules}
+	if item.action != actionSign {
+		return planned, nil
+	}
+
+	options := item.options
+	planned.Identity = options.Identity
+	planned.Options = options.Flags
+	planned.Timestamp = options.Timestamp
+	planned.PreserveMetadata = options.PreserveMetadata
+	planned.Requirements = options.Requirements
+	planned.Pseudo = options.Pseudo
+
+	switch filepath.Ext(item.target.path) {
+	case ".app", ".appex":
+		if item.profilePath != "" {
+			planned.Profile = profiles[item.profilePath].Name
+			planned.ProfilePath = item.profilePath
+		}
+	}
+
+	entitlements, err := effectiveEntitlements(item)
+	if err != nil {
+		return PlanItem{}, err
+	}
+	planned.Entitlements = entitlements
+	return planned, nil
+}
+
+// Return the entitlements the item is signed with, the existing ones when they are preserved
+func effectiveEntitlements(item plannedItem) (map[string]interface{}, error) {
+	if item.options.preserves("entitlements") {
+		path := item.target.path
+		if item.target.executable != "" {
+			path = item.target.executable
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		signatures, err := macho.ReadSignatures(data)
+		if err != nil || signatures[0].EntitlementsPlist() == nil {
+			return nil, nil
+		}
+
+		var entitlements map[string]interface{}
+		if _, err := plist.Unmarshal(signatures[0].EntitlementsPlist(), &entitlements); err != nil {
+			return nil, fmt.Errorf("failed to read the entitlements of %s: %s", path, err)
+		}
+		return entitlements, nil
+	}
+
+	if item.options.EntitlementsFile == "" {
+		return nil, nil
+	}
+	entitlements, _, err := utils.ReadPlist(item.options.EntitlementsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the entitlements file %s: %s", item.options.EntitlementsFile, err)
+	}
+	return entitlements, nil
+}
+
+// Return the files written when signing an item, relative to the app
+// files lists the files of the app before signing
+func signedFiles(appFolder string, item plannedItem, files map[string]string) map[string]string {
+	changes := map[string]string{}
+	add := func(path string) {
+		relativePath, _ := filepath.Rel(appFolder, path)
+		relativePath = filepath.ToSlash(relativePath)
+		if _, ok := files[relativePath]; ok {
+			changes[relativePath] = fileModified
+		} else {
+			changes[relativePath] = fileAdded
+		}
+	}
+
+	if item.target.executable == "" {
+		add(item.target.path)
+		return changes
+	}
+
+	add(item.target.executable)
+	b, err := readBundle(item.target.path)
+	if err != nil || b == nil {
+		return changes
+	}
+
+	// The native backend does not seal the resources of pseudo-signed bundles
+	if !item.options.Pseudo {
+		add(b.codeResourcesPath())
+	}
+	switch filepath.Ext(item.target.path) {
+	case ".app", ".appex":
+		if item.profilePath != "" {
+			add(b.profilePath())
+		}
+	}
+	return changes
+}
+
+// Hash the files of a folder, by path relative to the folder
+// Symbolic links are hashed by target
+func hashFiles(folder string) (map[string]string, error) {
+	hashes := map[string]string{}
+	err := filepath.WalkDir(folder, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		var data []byte
+		if entry.Type()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			data = []byte(target)
+		} else {
+			data, err = os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+		}
+
+		relativePath, _ := filepath.Rel(folder, path)
+		hash := sha256.Sum256(data)
+		hashes[filepath.ToSlash(relativePath)] = hex.EncodeToString(hash[:])
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the files of %s: %s", folder, err)
+	}
+	return hashes, nil
+}
+
+// Print the plan in a readable form
+func (plan *SigningPlan) Print(out io.Writer) {
+	fmt.Fprintf(out, "Signing plan of %s (%d item%s, nothing is signed):\n", plan.App, len(plan.Items), utils.Plural(len(plan.Items)))
+	for i, item := range plan.Items {
+		path := item.Path
+		if path == "." {
+			path = plan.App
+		}
+		fmt.Fprintf(out, "%3d. %s (%s)\n", i+1, path, item.Action)
+		if len(item.Rules) > 0 {
+			fmt.Fprintln(out, "       rules:", strings.Join(item.Rules, ", "))
+		}
+		if item.Action == actionSign {
+			identity := item.Identity
+			if identity == AdhocIdentity {
+				identity = "ad-hoc"
+			}
+			if item.Pseudo {
+				identity = "pseudo-signature"
+			}
+			fmt.Fprintln(out, "       identity:", identity)
+			if item.Profile != "" {
+				fmt.Fprintf(out, "       profile: %s (%s)\n", item.Profile, item.ProfilePath)
+			}
+			if len(item.Entitlements) > 0 {
+				fmt.Fprintln(out, "       entitlements:")
+				keys := make([]string, 0, len(item.Entitlements))
+				for key := range item.Entitlements {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				for _, key := range keys {
+					fmt.Fprintf(out, "         %s = %v\n", key, item.Entitlements[key])
+				}
+			}
+			if len(item.Options) > 0 {
+				fmt.Fprintln(out, "       options:", strings.Join(item.Options, ","))
+			}
+			if item.Timestamp != "" {
+				fmt.Fprintln(out, "       timestamp:", item.Timestamp)
+			}
+			if len(item.PreserveMetadata) > 0 {
+				fmt.Fprintln(out, "       preserve-metadata:", strings.Join(item.PreserveMetadata, ","))
+			}
+			if item.Requirements != "" {
+				fmt.Fprintln(out, "       requirements:", strings.Join(strings.Fields(item.Requirements), " "))
+			}
+		}
+
+		if len(item.Added)+len(item.Modified)+len(item.Removed) > 0 {
+			fmt.Fprintln(out, "       files:")
+		}
+		for _, list := range []struct {
+			prefix string
+			paths  []string
+		}{{fileAdded, item.Added}, {fileModified, item.Modified}, {fileRemoved, item.Removed}} {
+			for _, path := range list.paths {
+				fmt.Fprintln(out, "        ", list.prefix, path)
+			}
+		}
+	}
+
+	if len(plan.Stripped) > 0 {
+		fmt.Fprintln(out, "Stripped items:")
+		for _, item := range plan.Stripped {
+			fmt.Fprintln(out, "  ", item)
+		}
+	}
+	if len(plan.Skipped) > 0 {
+		fmt.Fprintln(out, "Skipped items:")
+		for _, item := range plan.Skipped {
+			fmt.Fprintln(out, "  ", item)
+		}
+	}
+}
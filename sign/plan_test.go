@@ -0,0 +1,105 @@
+package sign
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanSigning(t *testing.T) {
+	app := writeTestApp(t)
+	rule, err := ParseOptionRule("Frameworks/A.framework:options=runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := SignerParams{
+		InputFile:   app,
+		Signer:      &RecordingSigner{},
+		Output:      io.Discard,
+		Adhoc:       true,
+		SkipPaths:   []string{"Frameworks/B.framework"},
+		OptionRules: []OptionRule{rule},
+	}
+
+	plan, err := PlanSigning(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.App != "Test.app" {
+		t.Errorf("app %q", plan.App)
+	}
+
+	items := map[string]PlanItem{}
+	for _, item := range plan.Items {
+		items[item.Path] = item
+	}
+	tests := []struct {
+		path     string
+		action   string
+		options  []string
+		rules    []string
+		modified []string
+		added    []string
+	}{
+		{path: ".", action: actionSign, modified: []string{"Test"}, added: []string{"_CodeSignature/CodeResources"}},
+		{path: "Frameworks/A.framework", action: actionSign, options: []string{"runtime"}, rules: []string{"--option-rule Frameworks/A.framework:options=runtime"},
+			modified: []string{"Frameworks/A.framework/A"}, added: []string{"Frameworks/A.framework/_CodeSignature/CodeResources"}},
+		{path: "Frameworks/B.framework", action: actionSkip, rules: []string{"--skip Frameworks/B.framework"}},
+		{path: "Frameworks/libC.dylib", action: actionSign, modified: []string{"Frameworks/libC.dylib"}},
+	}
+	for _, test := range tests {
+		item, ok := items[test.path]
+		if !ok {
+			t.Errorf("%s not planned", test.path)
+			continue
+		}
+		if item.Action != test.action || !reflect.DeepEqual(item.Options, test.options) || !reflect.DeepEqual(item.Rules, test.rules) {
+			t.Errorf("%s: action %q, options %v, rules %v", test.path, item.Action, item.Options, item.Rules)
+		}
+		if !reflect.DeepEqual(item.Modified, test.modified) || !reflect.DeepEqual(item.Added, test.added) {
+			t.Errorf("%s: modified %v, added %v", test.path, item.Modified, item.Added)
+		}
+		if item.Action == actionSign && item.Identity != AdhocIdentity {
+			t.Errorf("%s: identity %q", test.path, item.Identity)
+		}
+	}
+	if len(plan.Items) == 0 || plan.Items[len(plan.Items)-1].Path != "." {
+		t.Errorf("the app is not signed last: %v", plan.Items)
+	}
+}
+
+func TestSigningPlanPrint(t *testing.T) {
+	plan := &SigningPlan{
+		App: "Test.app",
+		Items: []PlanItem{
+			{Path: "Frameworks/libC.dylib", Action: actionSkip, Rules: []string{"--skip Frameworks/libC.dylib"}},
+			{Path: ".", Action: actionSign, Identity: AdhocIdentity, Options: []string{"runtime"},
+				Entitlements: map[string]interface{}{"get-task-allow": true}, Modified: []string{"Test"}, Added: []string{"_CodeSignature/CodeResources"}},
+		},
+		Skipped: []string{"Frameworks/libD.dylib (not signable)"},
+	}
+
+	var output bytes.Buffer
+	plan.Print(&output)
+	expected := strings.Join([]string{
+		"Signing plan of Test.app (2 items, nothing is signed):",
+		"  1. Frameworks/libC.dylib (skip)",
+		"       rules: --skip Frameworks/libC.dylib",
+		"  2. Test.app (sign)",
+		"       identity: ad-hoc",
+		"       entitlements:",
+		"         get-task-allow = true",
+		"       options: runtime",
+		"       files:",
+		"         + _CodeSignature/CodeResources",
+		"         ~ Test",
+		"Skipped items:",
+		"   Frameworks/libD.dylib (not signable)",
+		"",
+	}, "\n")
+	if output.String() != expected {
+		t.Errorf("plan:\n%s\nexpected:\n%s", output.String(), expected)
+	}
+}
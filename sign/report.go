@@ -0,0 +1,190 @@
+package sign
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+	"github.com/e-n-0/sign-app-cli/provisioningprofiles"
+	"github.com/e-n-0/sign-app-cli/utils"
+
+	"howett.net/plist"
+)
+
+// Summary of a signing run written as JSON with --report
+type SigningReport struct {
+	Input string `json:"input"`
+	// SHA-256 of the input and output files, empty for app folders
+	InputSHA256  string `json:"inputSHA256,omitempty"`
+	Output       string `json:"output"`
+	OutputSHA256 string `json:"outputSHA256,omitempty"`
+
+	Started time.Time `json:"started"`
+	// Duration of the whole run, in seconds
+	Duration float64 `json:"duration"`
+
+	// Signed and kept items, in signing order
+	Items []ReportItem `json:"items"`
+}
+
+// A signed bundle or Mach-O file of the report
+type ReportItem struct {
+	// Path relative to the app, "." for the app itself
+	Path   string `json:"path"`
+	Action string `json:"action"`
+
+	BundleID string `json:"bundleID,omitempty"`
+	Version  string `json:"version,omitempty"`
+	Build    string `json:"build,omitempty"`
+
+	// Identifier of the signature, one CDHash for each CodeDirectory of each slice
+	Identifier string         `json:"identifier"`
+	CDHashes   []ReportCDHash `json:"cdhashes"`
+
+	// Signing certificate, nil for ad-hoc signatures
+	Certificate *ReportCertificate `json:"certificate,omitempty"`
+	TeamID      string             `json:"teamID,omitempty"`
+	Profile     *ReportProfile     `json:"profile,omitempty"`
+
+	Entitlements map[string]interface{} `json:"entitlements,omitempty"`
+
+	// Time spent signing the item, in seconds
+	Duration float64 `json:"duration"`
+}
+
+type ReportCDHash struct {
+	Algorithm string `json:"algorithm"`
+	Hash      string `json:"hash"`
+}
+
+type ReportCertificate struct {
+	Subject string `json:"subject"`
+	SHA1    string `json:"sha1"`
+}
+
+type ReportProfile struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+// Names of the CodeDirectory hash types
+var hashTypeNames = map[uint8]string{
+	macho.HashTypeSHA1:   "sha1",
+	macho.HashTypeSHA256: "sha256",
+}
+
+// Describe an item once signed, from its signature
+func newReportItem(item plannedItem, profiles map[string]provisioningprofiles.ProvisioningProfile, duration time.Duration) (ReportItem, error) {
+	reported := ReportItem{Path: item.relativePath, Action: item.action, Duration: duration.Seconds()}
+
+	path := item.target.path
+	if item.target.executable != "" {
+		path = item.target.executable
+
+		b, err := readBundle(item.target.path)
+		if err != nil {
+			return ReportItem{}, err
+		}
+		if b.infoPlist != "" {
+			infoPlist, _, err := utils.ReadPlist(b.infoPlist)
+			if err != nil {
+				return ReportItem{}, err
+			}
+			reported.BundleID, _ = infoPlist["CFBundleIdentifier"].(string)
+			reported.Version, _ = infoPlist["CFBundleShortVersionString"].(string)
+			reported.Build, _ = infoPlist["CFBundleVersion"].(string)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ReportItem{}, err
+	}
+	signatures, err := macho.ReadSignatures(data)
+	if err != nil {
+		return ReportItem{}, fmt.Errorf("failed to read the signature of %s: %s", path, err)
+	}
+
+	for _, signature := range signatures {
+		for _, cd := range signature.CodeDirectories {
+			reported.CDHashes = append(reported.CDHashes, ReportCDHash{Algorithm: hashTypeNames[cd.HashType], Hash: hex.EncodeToString(cd.CDHash())})
+		}
+	}
+
+	signature := signatures[0]
+	cd := signature.BestCodeDirectory()
+	reported.Identifier = cd.Identifier
+	reported.TeamID = cd.TeamID
+
+	if signature.CMS != nil {
+		if certificate := signature.CMS.SignerCertificate(); certificate != nil {
+			hash := sha1.Sum(certificate.Raw)
+			reported.Certificate = &ReportCertificate{Subject: certificate.Subject.String(), SHA1: hex.EncodeToString(hash[:])}
+			if reported.TeamID == "" && len(certificate.Subject.OrganizationalUnit) > 0 {
+				reported.TeamID = certificate.Subject.OrganizationalUnit[0]
+			}
+		}
+	}
+
+	switch filepath.Ext(item.target.path) {
+	case ".app", ".appex":
+		if profile, ok := profiles[item.profilePath]; ok && item.profilePath != "" {
+			reported.Profile = &ReportProfile{UUID: profile.UUID, Name: profile.Name}
+		}
+	}
+
+	if data := signature.EntitlementsPlist(); data != nil {
+		if _, err := plist.Unmarshal(data, &reported.Entitlements); err != nil {
+			return ReportItem{}, fmt.Errorf("failed to read the entitlements of %s: %s", path, err)
+		}
+	}
+
+	return reported, nil
+}
+
+// Provisioning profiles of the app and of its child apps, by path
+func signingProfiles(params SignerParams, children []childApp) map[string]provisioningprofiles.ProvisioningProfile {
+	profiles := map[string]provisioningprofiles.ProvisioningProfile{params.ProvisioninngProfile.Path: params.ProvisioninngProfile}
+	for _, child := range children {
+		profiles[child.profile.Path] = child.profile
+	}
+	return profiles
+}
+
+// Return the SHA-256 of a file, empty for folders
+func fileSHA256(path string) (string, error) {
+	if utils.IsFolder(path) {
+		return "", nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Write the report as indented JSON
+func (report *SigningReport) write(path string) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the report: %s", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write the report: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package sign
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Return the sorted keys of a JSON object
+func jsonKeys(object interface{}) []string {
+	var keys []string
+	for key := range object.(map[string]interface{}) {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestSigningReport(t *testing.T) {
+	folder := t.TempDir()
+	identity := testIdentity(t, "Apple Distribution: Jane Doe (ABCDE12345)")
+	input := writeSignableTestApp(t, filepath.Join(folder, "input"))
+	profilePath := filepath.Join(folder, "Test.mobileprovision")
+	writeTestSignedProfile(t, profilePath, "com.example.test", map[string]interface{}{"get-task-allow": true}, identity)
+	profile := testProfile("Test Profile", "com.example.test")
+	profile.Path = profilePath
+	profile.UUID = "00000000-0000-0000-0000-000000000000"
+	profile.Entitlements["get-task-allow"] = true
+
+	output := filepath.Join(folder, "Test.ipa")
+	reportFile := filepath.Join(folder, "report.json")
+	err := Sign(SignerParams{
+		Signer:               NativeSigner{Identity: identity},
+		CodesignCertificate:  identity.Certificate.Subject.CommonName,
+		ProvisioninngProfile: profile,
+		InputFile:            input,
+		OutputFile:           output,
+		Output:               io.Discard,
+		PlistEdits:           []PlistEdit{{KeyPath: "CFBundleShortVersionString", Value: "1.2"}, {KeyPath: "CFBundleVersion", Value: "42"}},
+		ReportFile:           reportFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(reportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report map[string]interface{}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+
+	// The input app folder has no hash
+	if keys := jsonKeys(report); !reflect.DeepEqual(keys, []string{"duration", "input", "items", "output", "outputSHA256", "started"}) {
+		t.Errorf("report keys %v", keys)
+	}
+	outputSHA256, err := fileSHA256(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report["input"] != input || report["output"] != output || report["outputSHA256"] != outputSHA256 {
+		t.Errorf("files %v %v %v", report["input"], report["output"], report["outputSHA256"])
+	}
+
+	// The extension is signed before the app, with the profile of the app
+	items := report["items"].([]interface{})
+	if len(items) != 2 {
+		t.Fatalf("%d items", len(items))
+	}
+	certificateHash := sha1.Sum(identity.Certificate.Raw)
+	expectedItems := []struct {
+		path       string
+		identifier string
+		keys       []string
+	}{
+		{"PlugIns/Share.appex", "com.example.test.share", []string{"action", "bundleID", "cdhashes", "certificate", "duration", "entitlements", "identifier", "path", "profile", "teamID"}},
+		{".", "com.example.test", []string{"action", "build", "bundleID", "cdhashes", "certificate", "duration", "entitlements", "identifier", "path", "profile", "teamID", "version"}},
+	}
+	for i, expected := range expectedItems {
+		item := items[i].(map[string]interface{})
+		if keys := jsonKeys(item); !reflect.DeepEqual(keys, expected.keys) {
+			t.Errorf("%s keys %v", expected.path, keys)
+		}
+		if item["path"] != expected.path || item["action"] != actionSign || item["bundleID"] != expected.identifier || item["identifier"] != expected.identifier {
+			t.Errorf("item %v", item)
+		}
+		if item["teamID"] != "TEAM123456" {
+			t.Errorf("%s team %v", expected.path, item["teamID"])
+		}
+
+		cdhashes := item["cdhashes"].([]interface{})
+		if len(cdhashes) == 0 {
+			t.Errorf("%s has no CDHash", expected.path)
+		}
+		for _, cdhash := range cdhashes {
+			cdhash := cdhash.(map[string]interface{})
+			if hash, _ := cdhash["hash"].(string); (cdhash["algorithm"] != "sha1" && cdhash["algorithm"] != "sha256") || len(hash) != 40 {
+				t.Errorf("%s CDHash %v", expected.path, cdhash)
+			}
+		}
+
+		certificate := item["certificate"].(map[string]interface{})
+		if certificate["subject"] != identity.Certificate.Subject.String() || certificate["sha1"] != hex.EncodeToString(certificateHash[:]) {
+			t.Errorf("%s certificate %v", expected.path, certificate)
+		}
+		if profile := item["profile"].(map[string]interface{}); profile["name"] != "Test Profile" || profile["uuid"] != "00000000-0000-0000-0000-000000000000" {
+			t.Errorf("%s profile %v", expected.path, profile)
+		}
+		if entitlements := item["entitlements"].(map[string]interface{}); entitlements["get-task-allow"] != true {
+			t.Errorf("%s entitlements %v", expected.path, entitlements)
+		}
+	}
+	if app := items[1].(map[string]interface{}); app["version"] != "1.2" || app["build"] != "42" {
+		t.Errorf("app version %v (%v)", app["version"], app["build"])
+	}
+}
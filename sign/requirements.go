@@ -0,0 +1,37 @@
+package sign
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// Decompile the requirements of a signed Mach-O file or bundle to the requirement language
+func ReadRequirements(path string) (string, error) {
+	if utils.IsFolder(path) {
+		b, err := readBundle(path)
+		if err != nil {
+			return "", err
+		}
+		if b == nil || b.executable == "" {
+			return "", fmt.Errorf("%s is not a bundle with an executable", path)
+		}
+		path = b.executable
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	signatures, err := macho.ReadSignatures(data)
+	if err != nil {
+		return "", fmt.Errorf("%s is not signed: %s", path, err)
+	}
+	if signatures[0].Requirements == nil {
+		return "", fmt.Errorf("%s has no requirements", path)
+	}
+	return macho.FormatRequirements(signatures[0].Requirements)
+}
@@ -0,0 +1,149 @@
+package sign
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// A signing option applied to the items of the app matching a glob pattern
+type OptionRule struct {
+	// Glob pattern relative to the app folder, "." matches the app itself
+	Pattern string
+	Key     string
+	Value   string
+}
+
+// Keys accepted in the option rules
+var optionRuleKeys = []string{"options", "timestamp", "preserve-metadata", "identity", "entitlements", "requirements"}
+
+// Parse a --option-rule argument (pattern:key=value)
+func ParseOptionRule(arg string) (OptionRule, error) {
+	index := strings.Index(arg, ":")
+	if index <= 0 {
+		return OptionRule{}, fmt.Errorf("invalid option rule %q, expected pattern:key=value", arg)
+	}
+
+	setting := arg[index+1:]
+	equal := strings.Index(setting, "=")
+	if equal <= 0 {
+		return OptionRule{}, fmt.Errorf("invalid option rule %q, expected pattern:key=value", arg)
+	}
+
+	rule := OptionRule{Pattern: arg[:index], Key: setting[:equal], Value: setting[equal+1:]}
+	if !utils.StringInSlice(rule.Key, optionRuleKeys) {
+		return OptionRule{}, fmt.Errorf("unknown key %q in the option rule %q, expected one of: %s", rule.Key, arg, strings.Join(optionRuleKeys, ", "))
+	}
+
+	// Check the value
+	var options SignOptions
+	rule.apply(&options)
+	if err := options.Validate(); err != nil {
+		return OptionRule{}, fmt.Errorf("invalid option rule %q: %s", arg, err)
+	}
+	if rule.Key == "identity" && rule.Value == "" {
+		return OptionRule{}, fmt.Errorf("invalid option rule %q: empty identity", arg)
+	}
+	if rule.Key == "entitlements" && rule.Value != "" && !utils.FileExists(rule.Value) {
+		return OptionRule{}, fmt.Errorf("invalid option rule %q: the entitlements file does not exist", arg)
+	}
+
+	return rule, nil
+}
+
+func (rule OptionRule) String() string {
+	return rule.Pattern + ":" + rule.Key + "=" + rule.Value
+}
+
+// Split a comma separated list, an empty value is an empty list
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// Replace the option of the rule
+func (rule OptionRule) apply(options *SignOptions) {
+	switch rule.Key {
+	case "options":
+		options.Flags = splitList(rule.Value)
+	case "timestamp":
+		options.Timestamp = rule.Value
+	case "preserve-metadata":
+		options.PreserveMetadata = splitList(rule.Value)
+	case "identity":
+		options.Identity = rule.Value
+	case "entitlements":
+		options.EntitlementsFile = rule.Value
+	case "requirements":
+		options.Requirements = rule.Value
+	}
+}
+
+// Check if a pattern matches a path relative to the app
+func matchesPath(pattern string, relativePath string) bool {
+	relativePath = filepath.ToSlash(relativePath)
+	return pattern == relativePath || utils.MatchGlob(pattern, relativePath)
+}
+
+// Check if a pattern matches a path relative to the app or one of its parent folders
+func matchesPathOrParent(pattern string, relativePath string) bool {
+	for relativePath = filepath.ToSlash(relativePath); relativePath != "." && relativePath != "/"; relativePath = path.Dir(relativePath) {
+		if matchesPath(pattern, relativePath) {
+			return true
+		}
+	}
+	return matchesPath(pattern, ".")
+}
+
+// Return the signing options of an item of the app and the rules applied to it
+// The rules matching its path relative to the app are applied in order
+func targetOptions(options SignOptions, relativePath string, rules []OptionRule) (SignOptions, []OptionRule) {
+	var matched []OptionRule
+	for _, rule := range rules {
+		if matchesPath(rule.Pattern, relativePath) {
+			rule.apply(&options)
+			matched = append(matched, rule)
+		}
+	}
+	return options, matched
+}
+
+// What is done with an item of the app
+const (
+	actionSign = "sign"
+	actionKeep = "keep signature"
+	actionSkip = "skip"
+)
+
+// An item of the app with the way it is signed
+type plannedItem struct {
+	target       signTarget
+	relativePath string
+	action       string
+	options      SignOptions
+	profilePath  string
+
+	// Rules changing how the item is signed, as given on the command line
+	rules []string
+}
+
+// Return the action of an item from the --keep-signature and --skip rules,
+// a rule matching a bundle applies to its content too
+func targetAction(relativePath string, params SignerParams) (string, []string) {
+	for _, pattern := range params.SkipPaths {
+		if matchesPathOrParent(pattern, relativePath) {
+			return actionSkip, []string{"--skip " + pattern}
+		}
+	}
+	for _, pattern := range params.KeepSignatures {
+		if matchesPathOrParent(pattern, relativePath) {
+			return actionKeep, []string{"--keep-signature " + pattern}
+		}
+	}
+	return actionSign, nil
+}
@@ -0,0 +1,132 @@
+package sign
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOptionRule(t *testing.T) {
+	entitlements := filepath.Join(t.TempDir(), "entitlements.plist")
+	if err := os.WriteFile(entitlements, []byte("<plist><dict/></plist>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		arg      string
+		expected OptionRule
+		err      string
+	}{
+		{"Frameworks/*.framework:options=runtime,library", OptionRule{Pattern: "Frameworks/*.framework", Key: "options", Value: "runtime,library"}, ""},
+		{".:timestamp=none", OptionRule{Pattern: ".", Key: "timestamp", Value: "none"}, ""},
+		{"PlugIns/*:timestamp=https://timestamp.example.com", OptionRule{Pattern: "PlugIns/*", Key: "timestamp", Value: "https://timestamp.example.com"}, ""},
+		{"**/*.dylib:preserve-metadata=identifier,flags", OptionRule{Pattern: "**/*.dylib", Key: "preserve-metadata", Value: "identifier,flags"}, ""},
+		{"Frameworks/*:identity=-", OptionRule{Pattern: "Frameworks/*", Key: "identity", Value: "-"}, ""},
+		{"PlugIns/Share.appex:entitlements=" + entitlements, OptionRule{Pattern: "PlugIns/Share.appex", Key: "entitlements", Value: entitlements}, ""},
+		{"PlugIns/*:options=", OptionRule{Pattern: "PlugIns/*", Key: "options"}, ""},
+		{".:requirements=designated => anchor apple generic", OptionRule{Pattern: ".", Key: "requirements", Value: "designated => anchor apple generic"}, ""},
+		{"options=runtime", OptionRule{}, "expected pattern:key=value"},
+		{":options=runtime", OptionRule{}, "expected pattern:key=value"},
+		{"Frameworks/*:runtime", OptionRule{}, "expected pattern:key=value"},
+		{"Frameworks/*:flags=runtime", OptionRule{}, "unknown key \"flags\""},
+		{"Frameworks/*:options=fast", OptionRule{}, "unknown code signing option \"fast\""},
+		{"Frameworks/*:preserve-metadata=resources", OptionRule{}, "unknown metadata \"resources\""},
+		{".:timestamp=timestamp.example.com", OptionRule{}, "invalid timestamp server"},
+		{".:identity=", OptionRule{}, "empty identity"},
+		{".:entitlements=/missing.plist", OptionRule{}, "the entitlements file does not exist"},
+		{".:requirements=designated =>", OptionRule{}, "invalid requirements"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.arg, func(t *testing.T) {
+			rule, err := ParseOptionRule(test.arg)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rule != test.expected {
+				t.Errorf("rule %+v, expected %+v", rule, test.expected)
+			}
+			if rule.String() != test.arg {
+				t.Errorf("rule printed as %q", rule.String())
+			}
+		})
+	}
+}
+
+func TestTargetOptions(t *testing.T) {
+	defaults := SignOptions{Identity: "Apple Development", Flags: []string{"runtime"}, Timestamp: TimestampDefault}
+	rules := []OptionRule{
+		{Pattern: "Frameworks/*.framework", Key: "options", Value: ""},
+		{Pattern: "Frameworks/*.framework", Key: "timestamp", Value: TimestampNone},
+		{Pattern: "Frameworks/Vendor.framework", Key: "identity", Value: AdhocIdentity},
+		{Pattern: "**/*.dylib", Key: "preserve-metadata", Value: "identifier,flags"},
+		{Pattern: ".", Key: "entitlements", Value: "/app.plist"},
+		{Pattern: "PlugIns/*.appex", Key: "options", Value: "runtime,kill"},
+		{Pattern: "PlugIns/Share.appex", Key: "options", Value: "hard"},
+	}
+
+	tests := []struct {
+		path     string
+		expected SignOptions
+		matched  int
+	}{
+		{".", SignOptions{Identity: "Apple Development", Flags: []string{"runtime"}, Timestamp: TimestampDefault, EntitlementsFile: "/app.plist"}, 1},
+		{"Frameworks/A.framework", SignOptions{Identity: "Apple Development", Timestamp: TimestampNone}, 2},
+		{"Frameworks/Vendor.framework", SignOptions{Identity: AdhocIdentity, Timestamp: TimestampNone}, 3},
+		{"Frameworks/libC.dylib", SignOptions{Identity: "Apple Development", Flags: []string{"runtime"}, Timestamp: TimestampDefault, PreserveMetadata: []string{"identifier", "flags"}}, 1},
+		{"PlugIns/Widget.appex", SignOptions{Identity: "Apple Development", Flags: []string{"runtime", "kill"}, Timestamp: TimestampDefault}, 1},
+		// The last matching rule wins
+		{"PlugIns/Share.appex", SignOptions{Identity: "Apple Development", Flags: []string{"hard"}, Timestamp: TimestampDefault}, 2},
+		// The rules do not apply to the content of the matched bundles
+		{"PlugIns/Share.appex/Frameworks/D.framework", defaults, 0},
+	}
+
+	for _, test := range tests {
+		options, matched := targetOptions(defaults, test.path, rules)
+		if !reflect.DeepEqual(options, test.expected) {
+			t.Errorf("%s: options %+v, expected %+v", test.path, options, test.expected)
+		}
+		if len(matched) != test.matched {
+			t.Errorf("%s: matched %v", test.path, matched)
+		}
+	}
+}
+
+func TestTargetAction(t *testing.T) {
+	params := SignerParams{
+		SkipPaths:      []string{"PlugIns/Debug.appex", "**/*.sh"},
+		KeepSignatures: []string{"Frameworks/Vendor.framework", "PlugIns/*"},
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+		rules    []string
+	}{
+		{".", actionSign, nil},
+		{"Frameworks/A.framework", actionSign, nil},
+		{"Frameworks/Vendor.framework", actionKeep, []string{"--keep-signature Frameworks/Vendor.framework"}},
+		// The rules of a bundle apply to its content
+		{"Frameworks/Vendor.framework/Frameworks/libV.dylib", actionKeep, []string{"--keep-signature Frameworks/Vendor.framework"}},
+		{"PlugIns/Debug.appex/Debug", actionSkip, []string{"--skip PlugIns/Debug.appex"}},
+		// The skip rules come first
+		{"PlugIns/Share.appex", actionKeep, []string{"--keep-signature PlugIns/*"}},
+		{"PlugIns/Debug.appex", actionSkip, []string{"--skip PlugIns/Debug.appex"}},
+		{"scripts/build.sh", actionSkip, []string{"--skip **/*.sh"}},
+	}
+
+	for _, test := range tests {
+		action, rules := targetAction(test.path, params)
+		if action != test.expected || !reflect.DeepEqual(rules, test.rules) {
+			t.Errorf("%s: %s %v, expected %s %v", test.path, action, rules, test.expected, test.rules)
+		}
+	}
+}
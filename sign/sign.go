@@ -1,10 +1,14 @@
 package sign
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/e-n-0/sign-app-cli/provisioningprofiles"
 	"github.com/e-n-0/sign-app-cli/utils"
@@ -13,53 +17,409 @@ import (
 )
 
 type SignerParams struct {
+	// Backend performing the signing operations, codesign when not set
+	Signer Signer
+
+	// Writer of the progress messages, the standard output when not set
+	Output io.Writer
+
 	ProvisioninngProfile provisioningprofiles.ProvisioningProfile
 	CodesignCertificate  string
 	InputFile            string
 	OutputFile           string
 	EntitlementsFile     string
+
+	PlistEdits          []PlistEdit
+	PlistEditExtensions bool
+
+	// New bundle identifier of the app, the nested bundles whose identifier starts with
+	// the old one are renamed too (see changeBundleIdentifier)
+	BundleIdentifier string
+
+	// Edits of the entitlements of the app, applied to the profile entitlements
+	// or to the EntitlementsFile of ad-hoc signatures
+	EntitlementEdits []PlistEdit
+
+	// Display names written to the localized InfoPlist.strings files, by locale
+	// The "*" locale applies to every localization that is not listed
+	LocalizedDisplayNames map[string]string
+
+	// PNG file used to replace the app icon
+	IconFile string
+
+	// Resource changes applied to the app bundle before signing
+	OverlayFolder string
+	Injections    []Injection
+	RemovePaths   []string
+
+	// Components removed from the app before signing (see StrippableComponents)
+	StripComponents []string
+
+	// Sign ad-hoc (identity "-") with the EntitlementsFile, without provisioning profile
+	Adhoc bool
+	// Pseudo-sign like ldid -S, only the entitlements and the code hashes are embedded
+	PseudoSign bool
+
+	// Provisioning profiles of the watch apps and app clips, the app profile is used otherwise
+	ChildProfiles []ChildProfile
+
+	// Sign the input file in place instead of writing OutputFile
+	InPlace bool
+
+	// Add the symbols of the dSYMs to the ipa exported from an Xcode archive
+	IncludeSymbols bool
+
+	// Signing options (see SignOptions), overridden for some items by the OptionRules
+	SignatureFlags   []string
+	Timestamp        string
+	PreserveMetadata []string
+	Requirements     string
+	OptionRules      []OptionRule
+
+	// Glob patterns of the items whose signature is kept, and of the items not signed at all
+	// A pattern matching a bundle applies to its content
+	KeepSignatures []string
+	SkipPaths      []string
+
+	// Do not sign again the nested items already signed as requested
+	Incremental bool
+
+	// Maximum number of nested items signed at the same time, one when not set
+	// A bundle is signed once all the items nested in it are signed
+	Jobs int
+
+	// JSON file receiving the report of the signed items (see SigningReport)
+	ReportFile string
+
+	// The identity was already tested with CheckIdentity, Sign does not test it again
+	IdentityChecked bool
+}
+
+// Return the writer of the progress messages
+func (params SignerParams) output() io.Writer {
+	if params.Output == nil {
+		return os.Stdout
+	}
+	return params.Output
 }
 
-var validBinariesExtensions = []string{".app", ".framework", ".dylib", ".appex", ".so", "0", ".vis", ".pvr"}
+// Return the number of items signed at the same time
+func (params SignerParams) jobs() int {
+	if params.Jobs < 1 {
+		return 1
+	}
+	return params.Jobs
+}
 
-// Sign all the files in the folder recursively
-func signPath(folderOrFolderPath string, params SignerParams) error {
+// Check if the app is signed without identity nor provisioning profile
+func (params SignerParams) signsWithoutIdentity() bool {
+	return params.Adhoc || params.PseudoSign
+}
 
-	// 1 - Recursively sign the folder content
-	if utils.IsFolder(folderOrFolderPath) {
-		entries, err := os.ReadDir(folderOrFolderPath)
-		if err != nil {
-			return err
+// Check if the keychain identity must be tested before signing
+func (params SignerParams) needsIdentityCheck() bool {
+	_, ok := params.Signer.(CodesignSigner)
+	return ok && !params.signsWithoutIdentity() && !params.IdentityChecked
+}
+
+// List the Mach-O files and bundles of the folder in signing order, nested code first,
+// with the signing options given by the rules
+// Return the items that look like code but are not signed, relative to the folder
+// The items of the child apps are signed with the profile and entitlements of their child app
+func planSigning(folder string, params SignerParams, children []childApp) ([]plannedItem, []string, error) {
+	targets, skipped, err := collectSignTargets(folder)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options := SignOptions{
+		Identity:         params.CodesignCertificate,
+		EntitlementsFile: params.EntitlementsFile,
+		Flags:            params.SignatureFlags,
+		Timestamp:        params.Timestamp,
+		PreserveMetadata: params.PreserveMetadata,
+		Requirements:     params.Requirements,
+		Pseudo:           params.PseudoSign,
+	}
+	if params.signsWithoutIdentity() {
+		options.Identity = AdhocIdentity
+	}
+
+	var items []plannedItem
+	var skippedItems []string
+	for _, target := range targets {
+		relativePath, _ := filepath.Rel(folder, target.path)
+		item := plannedItem{target: target, relativePath: filepath.ToSlash(relativePath), options: options, profilePath: params.ProvisioninngProfile.Path}
+		item.action, item.rules = targetAction(relativePath, params)
+		if item.action == actionSkip {
+			skippedItems = append(skippedItems, fmt.Sprintf("%s (%s)", item.relativePath, item.rules[0]))
+			items = append(items, item)
+			continue
+		}
+
+		if child := findChildApp(children, target.path); child != nil {
+			item.options.EntitlementsFile = child.entitlementsFile
+			item.profilePath = child.profile.Path
 		}
 
-		for _, entry := range entries {
-			if entry.IsDir() {
-				err := signPath(filepath.Join(folderOrFolderPath, entry.Name()), params)
-				if err != nil {
-					return err
-				}
+		// The entitlements are only given to the apps and their extensions, unless a rule sets them
+		switch filepath.Ext(target.path) {
+		case ".app", ".appex":
+		default:
+			item.options.EntitlementsFile = ""
+		}
+
+		options, rules := targetOptions(item.options, relativePath, params.OptionRules)
+		item.options = options
+		for _, rule := range rules {
+			item.rules = append(item.rules, "--option-rule "+rule.String())
+			if rule.Key == "identity" && rule.Value != AdhocIdentity && rule.Value != params.CodesignCertificate && !signsWithAnyIdentity(params.Signer) {
+				return nil, nil, fmt.Errorf("the option rule %q cannot sign %s with another identity: the backend signs with one certificate, only the ad-hoc identity (-) can be set", rule.String(), item.relativePath)
 			}
 		}
+
+		items = append(items, item)
 	}
 
-	// 2 - Check the file extension
-	fileExtension := filepath.Ext(folderOrFolderPath)
-	if !utils.StringInSlice(fileExtension, validBinariesExtensions) {
+	for _, item := range skipped {
+		relativePath, _ := filepath.Rel(folder, item.path)
+		skippedItems = append(skippedItems, fmt.Sprintf("%s (%s)", filepath.ToSlash(relativePath), item.reason))
+	}
+	return items, skippedItems, nil
+}
+
+// Check if a signer can sign with the identity given in the options, the native and ldid
+// backends only sign with the certificate they were created with
+func signsWithAnyIdentity(signer Signer) bool {
+	switch signer.(type) {
+	case NativeSigner, LdidSigner:
+		return false
+	}
+	return true
+}
+
+// Sign the Mach-O files and bundles of the folder, nested code first
+// Return the items that look like code but were not signed, relative to the folder
+// The signed items are added to the report when not nil
+func signPath(folder string, params SignerParams, children []childApp, report *SigningReport) ([]string, error) {
+	items, skippedItems, err := planSigning(folder, params, children)
+	if err != nil {
+		return nil, err
+	}
+
+	// Show the items whose signing is changed by a rule
+	printedRules := false
+	for _, item := range items {
+		if len(item.rules) == 0 {
+			continue
+		}
+		if !printedRules {
+			fmt.Fprintln(params.output(), "Signing rules:")
+			printedRules = true
+		}
+		fmt.Fprintf(params.output(), "  %s: %s (%s)\n", item.relativePath, item.action, strings.Join(item.rules, ", "))
+	}
+
+	profiles := signingProfiles(params, children)
+
+	// A bundle executable must be signed after all its content is signed,
+	// the items that do not contain each other may be signed at the same time
+	var lock sync.Mutex
+	var resigned []string
+	certificates := newIdentityCertificates(params.Signer)
+	upToDate := make([]bool, len(items))
+	reportItems := make([]ReportItem, len(items))
+	err = runSigningOrder(items, params.jobs(), func(ctx context.Context, i int) error {
+		item := items[i]
+		if item.action == actionSkip {
+			return nil
+		}
+		item.options.Context = ctx
+		start := time.Now()
+		if item.action == actionSign && params.Incremental {
+			// The items nested in this one are all done
+			lock.Lock()
+			done := append([]string{}, resigned...)
+			lock.Unlock()
+			if alreadySigned(item, certificates, folder, done) {
+				item.action = actionUpToDate
+				upToDate[i] = true
+			}
+		}
+
+		switch item.action {
+		case actionKeep:
+			// The kept signature must be valid to be sealed by the enclosing bundle
+			if err := verifyKeptSignature(params.output(), params.Signer, item.target); err != nil {
+				return err
+			}
+		case actionSign:
+			err := codeSign(params.output(), params.Signer, item.target.path, item.options, item.profilePath)
+			if err != nil {
+				return err
+			}
+			lock.Lock()
+			resigned = append(resigned, item.target.path)
+			lock.Unlock()
+		}
+
+		if report != nil {
+			reportItem, err := newReportItem(item, profiles, time.Since(start))
+			if err != nil {
+				return err
+			}
+			reportItems[i] = reportItem
+		}
 		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// 3 - Sign the path (file or folder)
-	// The folder executable (if bundle) must be signed after all its content is signed
-	err := codeSign(folderOrFolderPath, params.CodesignCertificate, params.EntitlementsFile, params.ProvisioninngProfile.Path)
+	// The results are listed in signing order
+	for i, item := range items {
+		if item.action == actionSkip {
+			continue
+		}
+		if upToDate[i] {
+			skippedItems = append(skippedItems, fmt.Sprintf("%s (%s)", item.relativePath, actionUpToDate))
+		}
+		if report != nil {
+			report.Items = append(report.Items, reportItems[i])
+		}
+	}
+
+	return skippedItems, nil
+}
+
+// Check the signature of an item signed with --keep-signature
+func verifyKeptSignature(out io.Writer, signer Signer, target signTarget) error {
+	fmt.Fprintln(out, "Checking the signature of", target.path, "...")
+
+	path := target.path
+	if target.isBundle() {
+		path = target.executable
+	}
+	if err := signer.Verify(path); err != nil {
+		return fmt.Errorf("the kept signature of %s is not valid: %s", target.path, err)
+	}
+	return nil
+}
+
+// Prepare the app folder and sign it
+// workFolder is the folder containing the app contents (the extracted ipa)
+// Return the stripped items and the items that were not signed
+func signApp(workFolder string, appFolder string, params SignerParams, report *SigningReport) ([]string, []string, error) {
+	strippedItems, children, err := prepareApp(workFolder, appFolder, params)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	// Sign the app folder
+	fmt.Fprintln(params.output(), "Signing the app folder...")
+	skippedItems, err := signPath(appFolder, params, children, report)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign the app folder, error: %s", err)
+	}
+
+	return strippedItems, skippedItems, nil
+}
+
+// Apply the changes made to the app before signing
+// Return the stripped items and the child apps with their profile
+func prepareApp(workFolder string, appFolder string, params SignerParams) ([]string, []childApp, error) {
+	// Strip the unwanted components
+	strippedItems, err := stripComponents(workFolder, appFolder, params.StripComponents)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Update the app resources so they are covered by the signature
+	err = applyResourceChanges(appFolder, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Rename the bundles, the Info.plist edits may still set other identifiers
+	if params.BundleIdentifier != "" {
+		err = changeBundleIdentifier(params.output(), appFolder, params.BundleIdentifier)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Edit the Info.plist files before anything gets signed
+	err = updateInfoPlists(appFolder, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Replace the app icon
+	err = replaceAppIcon(params.output(), appFolder, params.IconFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Watch apps and app clips get their own profile and entitlements
+	var children []childApp
+	if !params.signsWithoutIdentity() {
+		children, err = prepareChildApps(appFolder, filepath.Dir(params.EntitlementsFile), params)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return strippedItems, children, nil
+}
+
+// Write the signed app to the output file: an .ipa archive or an .app folder
+func writeOutput(out io.Writer, appFolder string, payloadFolder string, outputFile string) error {
+	switch filepath.Ext(outputFile) {
+	case ".ipa":
+		// Zip the Payload folder with the support folders and save it to the output file
+		folders := []string{payloadFolder}
+		for _, name := range ipaSupportFolders {
+			if folder := filepath.Join(filepath.Dir(payloadFolder), name); utils.IsFolder(folder) {
+				folders = append(folders, folder)
+			}
+		}
+		fmt.Fprintln(out, "Zipping the Payload folder...")
+		err := utils.CreateZip(outputFile, folders...)
+		if err != nil {
+			return fmt.Errorf("failed to create the output ipa file, error: %s", err)
+		}
+	case ".app":
+		if utils.FileExists(outputFile) {
+			if !utils.IsFolder(outputFile) {
+				return fmt.Errorf("the output %s exists and is not an app folder", outputFile)
+			}
+			if err := os.RemoveAll(outputFile); err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintln(out, "Copying the app folder...")
+		err := utils.CopyFolder(appFolder, outputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create the output app folder, error: %s", err)
+		}
 	}
 
 	return nil
 }
 
 func Sign(params SignerParams) error {
-	fmt.Println("Starting the signing process for file:", params.InputFile)
+	fmt.Fprintln(params.output(), "Starting the signing process for file:", params.InputFile)
+	start := time.Now()
+
+	if params.Signer == nil {
+		params.Signer = CodesignSigner{}
+	}
+
+	inputFile, outputFile, err := signingFiles(params)
+	if err != nil {
+		return err
+	}
 
 	tmpFolder, err := os.MkdirTemp("", "sign-app-cli-*")
 	if err != nil {
@@ -68,156 +428,288 @@ func Sign(params SignerParams) error {
 	defer os.RemoveAll(tmpFolder)
 
 	// Try to sign an arbitrary file to test if the certificate is valid
-	err = trySignCodeFail(tmpFolder, params.CodesignCertificate)
+	// (only the keychain identities used by codesign need this check)
+	if params.needsIdentityCheck() {
+		err = trySignCodeFail(params.output(), tmpFolder, params.Signer, params.CodesignCertificate)
+		if err != nil {
+			return err
+		}
+	}
+
+	workingTmpFolder, appFolder, err := openInput(params.output(), inputFile, tmpFolder, params.InPlace, params.IncludeSymbols)
 	if err != nil {
 		return err
 	}
 
-	filenameExt := filepath.Ext(params.InputFile)
+	return signWorkFolder(params, inputFile, outputFile, tmpFolder, workingTmpFolder, appFolder, start)
+}
 
-	// Create a folder "work" inside the tmp folder
-	workingTmpFolder := filepath.Join(tmpFolder, "work")
-	err = os.Mkdir(workingTmpFolder, 0777)
+// Check the input file and the output file of the signing parameters
+// Return the cleaned input file and the output file, the input file when signed in place
+func signingFiles(params SignerParams) (string, string, error) {
+	inputFile := filepath.Clean(params.InputFile)
+	filenameExt, err := inputType(inputFile)
+	if err != nil {
+		return "", "", err
+	}
+
+	outputFile := params.OutputFile
+	if params.InPlace && filenameExt == ".xcarchive" {
+		return "", "", fmt.Errorf("an archive cannot be signed in place, export it to an .ipa file")
+	}
+	if params.InPlace {
+		outputFile = inputFile
+	}
+	if ext := filepath.Ext(outputFile); ext != ".ipa" && ext != ".app" {
+		return "", "", fmt.Errorf("unsupported output file type: %s (expected .ipa or .app)", ext)
+	}
+	if !params.InPlace && filepath.Clean(outputFile) == inputFile {
+		return "", "", fmt.Errorf("the output file is the input file, use --in-place to sign it in place")
+	}
+	return inputFile, outputFile, nil
+}
+
+// Sign the app extracted by openInput and write it to the output file
+// tmpFolder is the temporary folder containing the work folder, it receives the entitlements
+func signWorkFolder(params SignerParams, inputFile string, outputFile string, tmpFolder string, workFolder string, appFolder string, start time.Time) error {
+	// Get the Payload folder
+	payloadFolder := filepath.Join(workFolder, "Payload")
+
+	// Retreive entitlements from the provisioning profile and save it to a file
+	/*err = updateAppIdIfNeeded(appFolder, params.ProvisioninngProfile)
+	if err != nil {
+		return err
+	}*/
+
+	err := setupEntitlements(&params, tmpFolder)
 	if err != nil {
 		return err
 	}
+	////
 
-	switch filenameExt {
-	case ".ipa":
-		// Unzip the ipa file
-		fmt.Println("Extracting ipa file...")
-		err = utils.ExtractZip(params.InputFile, workingTmpFolder)
+	var report *SigningReport
+	if params.ReportFile != "" {
+		report = &SigningReport{Input: inputFile, Output: outputFile, Started: start}
+
+		// The input signed in place is hashed before it changes
+		report.InputSHA256, err = fileSHA256(inputFile)
 		if err != nil {
-			return fmt.Errorf("failed to extract ipa file, error: %s", err)
+			return err
 		}
+	}
 
-		// Get the Payload folder
-		payloadFolder := filepath.Join(workingTmpFolder, "Payload")
+	strippedItems, skippedItems, err := signApp(workFolder, appFolder, params, report)
+	if err != nil {
+		return err
+	}
 
-		// Get the app folder
-		appFolder, err := locateAppFolder(payloadFolder)
+	// The app signed in place is already at its destination
+	if appFolder != outputFile {
+		err = writeOutput(params.output(), appFolder, payloadFolder, outputFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if report != nil {
+		report.OutputSHA256, err = fileSHA256(outputFile)
 		if err != nil {
 			return err
 		}
+		report.Duration = time.Since(start).Seconds()
 
-		// Retreive entitlements from the provisioning profile and save it to a file
-		/*err = updateAppIdIfNeeded(appFolder, params.ProvisioninngProfile)
+		err = report.write(params.ReportFile)
 		if err != nil {
 			return err
-		}*/
+		}
+	}
+
+	// Print in green
+	fmt.Fprintln(params.output(), "\033[32m"+"Successfully signed the app"+"\033[0m")
+	fmt.Fprintln(params.output(), "The signed app is available at:", outputFile)
+	if report != nil {
+		fmt.Fprintln(params.output(), "The signing report is available at:", params.ReportFile)
+	}
+	if len(strippedItems) > 0 {
+		fmt.Fprintln(params.output(), "Stripped items:")
+		for _, item := range strippedItems {
+			fmt.Fprintln(params.output(), "  ", item)
+		}
+	}
+	if len(skippedItems) > 0 {
+		fmt.Fprintln(params.output(), "Skipped items:")
+		for _, item := range skippedItems {
+			fmt.Fprintln(params.output(), "  ", item)
+		}
+	}
+	return nil
+}
 
-		entitlements := params.ProvisioninngProfile.GetEntitlements()
+// Return the extension of a supported input file
+func inputType(inputFile string) (string, error) {
+	filenameExt := filepath.Ext(inputFile)
+	if filenameExt != ".ipa" && filenameExt != ".app" && filenameExt != ".xcarchive" {
+		// Not supported file type
+		return "", fmt.Errorf("unsupported file type: %s", filenameExt)
+	}
+	return filenameExt, nil
+}
 
-		params.EntitlementsFile = filepath.Join(workingTmpFolder, "entitlements.plist")
-		entitlementsFile, err := os.Create(params.EntitlementsFile)
+// Extract or copy the app of the input file to a "work" folder inside tmpFolder,
+// an .app input is used directly when inPlace is set
+// Return the work folder and the app folder
+func openInput(out io.Writer, inputFile string, tmpFolder string, inPlace bool, includeSymbols bool) (string, string, error) {
+	filenameExt, err := inputType(inputFile)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Create a folder "work" inside the tmp folder
+	workingTmpFolder := filepath.Join(tmpFolder, "work")
+	err = os.Mkdir(workingTmpFolder, 0777)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Get the Payload folder
+	payloadFolder := filepath.Join(workingTmpFolder, "Payload")
+
+	var appFolder string
+	switch filenameExt {
+	case ".ipa":
+		// Unzip the ipa file
+		fmt.Fprintln(out, "Extracting ipa file...")
+		err = utils.ExtractZip(inputFile, workingTmpFolder)
 		if err != nil {
-			return fmt.Errorf("failed to create entitlements file, error: %s", err)
+			return "", "", fmt.Errorf("failed to extract ipa file, error: %s", err)
 		}
 
-		// Encode the entitlements to xml
-		encoder := plist.NewEncoder(entitlementsFile)
-		encoder.Indent("\t")
-		err = encoder.Encode(entitlements)
+		// Get the app folder
+		appFolder, err = locateAppFolder(payloadFolder)
 		if err != nil {
-			return fmt.Errorf("failed to encode entitlements, error: %s", err)
+			return "", "", err
+		}
+
+	case ".app":
+		if !utils.IsFolder(inputFile) {
+			return "", "", fmt.Errorf("the input app %s is not a folder", inputFile)
 		}
 
-		entitlementsFile.Close()
-		////
+		if inPlace {
+			return inputFile, inputFile, nil
+		}
 
-		// Sign the app folder
-		fmt.Println("Signing the app folder...")
-		err = signPath(appFolder, params)
+		// Work on a copy inside a Payload folder, ready to be zipped
+		fmt.Fprintln(out, "Copying the app folder...")
+		appFolder = filepath.Join(payloadFolder, filepath.Base(inputFile))
+		err = utils.CopyFolder(inputFile, appFolder)
 		if err != nil {
-			return fmt.Errorf("failed to sign the app folder, error: %s", err)
+			return "", "", fmt.Errorf("failed to copy the app folder, error: %s", err)
+		}
+
+	case ".xcarchive":
+		if !utils.IsFolder(inputFile) {
+			return "", "", fmt.Errorf("the input archive %s is not a folder", inputFile)
 		}
 
-		// Zip the Payload folder and save it to the output file
-		err = utils.CreateZip(params.OutputFile, payloadFolder)
+		appFolder, err = exportArchive(out, inputFile, workingTmpFolder, includeSymbols)
 		if err != nil {
-			return fmt.Errorf("failed to create the output ipa file, error: %s", err)
+			return "", "", err
 		}
+	}
 
-		// Print in green
-		fmt.Println("\033[32m" + "Successfully signed the ipa file" + "\033[0m")
-		fmt.Println("The signed ipa file is available at:", params.OutputFile)
-		return nil
+	return workingTmpFolder, appFolder, nil
+}
 
-	default:
-		// Not supported file type
-		return fmt.Errorf("unsupported file type: %s", filenameExt)
+// Write the entitlements of the provisioning profile to a file of tmpFolder used to sign the app
+func setupEntitlements(params *SignerParams, tmpFolder string) error {
+	var entitlements map[string]interface{}
+
+	// Ad-hoc signatures use the given entitlements and embed no profile
+	if params.signsWithoutIdentity() {
+		params.ProvisioninngProfile = provisioningprofiles.ProvisioningProfile{}
+		if len(params.EntitlementEdits) == 0 {
+			return nil
+		}
+
+		entitlements = map[string]interface{}{}
+		if params.EntitlementsFile != "" {
+			var err error
+			entitlements, _, err = utils.ReadPlist(params.EntitlementsFile)
+			if err != nil {
+				return fmt.Errorf("failed to read the entitlements file: %s", err)
+			}
+		}
+	} else {
+		// The profile may be shared by several signing runs, its entitlements are copied before the edits
+		data, err := plist.Marshal(params.ProvisioninngProfile.GetEntitlements(), plist.BinaryFormat)
+		if err != nil {
+			return fmt.Errorf("failed to read the profile entitlements: %s", err)
+		}
+		if _, err := plist.Unmarshal(data, &entitlements); err != nil {
+			return fmt.Errorf("failed to read the profile entitlements: %s", err)
+		}
 	}
 
+	if err := applyPlistEdits(entitlements, params.EntitlementEdits); err != nil {
+		return fmt.Errorf("failed to edit the entitlements: %s", err)
+	}
+
+	params.EntitlementsFile = filepath.Join(tmpFolder, "entitlements.plist")
+	return writeEntitlements(params.EntitlementsFile, entitlements)
 }
 
-func codeSign(inputFile string, codesignCertificate string, entitlementsFile string, mobileProvisionFile string) error {
-	fmt.Println("Signing", inputFile, "...")
+func codeSign(out io.Writer, signer Signer, inputFile string, options SignOptions, mobileProvisionFile string) error {
+	fmt.Fprintln(out, "Signing", inputFile, "...")
 
-	fileExt := filepath.Ext(inputFile)
 	filePath := inputFile
-	useEntitlements := false
-
-	// Get the executable file from different file types
-	switch fileExt {
-	case ".framework":
-		fileName := filepath.Base(inputFile)
-		fileName = strings.TrimSuffix(fileName, filepath.Ext(fileName))
-		filePath = filepath.Join(inputFile, fileName)
-	case ".app", ".appex":
-		// Read executable file from Info.plist
-		infoPlist := filepath.Join(inputFile, "Info.plist")
-		plistBytes, err := os.ReadFile(infoPlist)
+
+	// Bundles are signed through their main executable
+	var signedBundle *bundle
+	if utils.IsFolder(inputFile) {
+		b, err := readBundle(inputFile)
 		if err != nil {
-			return fmt.Errorf("failed to read Info.plist file, error: %s", err)
+			return err
+		}
+		if b == nil || b.executable == "" {
+			return fmt.Errorf("%s is not a bundle with an executable", inputFile)
 		}
+		signedBundle = b
+		filePath = b.executable
+	}
 
-		// Read the plist file into a map
-		var plistData map[string]interface{}
-		_, err = plist.Unmarshal(plistBytes, &plistData)
+	// Check if the entitlements file exists
+	if options.EntitlementsFile != "" {
+		_, err := os.Stat(options.EntitlementsFile)
 		if err != nil {
 			return err
 		}
+	}
 
-		// Get the executable file
-		executableFile := plistData["CFBundleExecutable"].(string)
-		filePath = filepath.Join(inputFile, executableFile)
-
-		// Check if the entitlements file exists
-		if entitlementsFile != "" {
-			_, err := os.Stat(entitlementsFile)
-			if err != nil {
-				return err
-			}
-
-			useEntitlements = true
+	// The apps and their extensions embed the provisioning profile
+	switch filepath.Ext(inputFile) {
+	case ".app", ".appex":
+		// No profile is embedded in ad-hoc signed apps
+		if mobileProvisionFile == "" {
+			break
 		}
 
-		mobileProvisionAppPath := filepath.Join(inputFile, "embedded.mobileprovision")
+		// embedded.mobileprovision for iOS, Contents/embedded.provisionprofile for macOS
+		mobileProvisionAppPath := signedBundle.profilePath()
 
-		// delete an existing embedded.mobileprovision file
-		_ = os.Remove(filepath.Join(inputFile, "embedded.mobileprovision"))
+		// delete an existing embedded profile
+		_ = os.Remove(mobileProvisionAppPath)
 
 		// copy the provisioning profile to the app folder
-		err = utils.CopyFile(mobileProvisionFile, mobileProvisionAppPath)
+		err := utils.CopyFile(mobileProvisionFile, mobileProvisionAppPath)
 		if err != nil {
 			return fmt.Errorf("failed to copy the provisioning profile to the app folder: %s", err)
 		}
 	}
 
-	// Create the arguments
-	args := []string{"codesign", "-f", "-s", codesignCertificate, "--generate-entitlement-der"}
-	if useEntitlements {
-		args = append(args, "--entitlements", entitlementsFile)
-	}
-	args = append(args, filePath)
-
-	// Execute the codesign command
-	_, status, err := utils.ExecuteProcess(args...)
-	if err != nil || status != 0 {
-		if err == nil {
-			err = fmt.Errorf("codesign failed with status code %d", status)
-		}
-
+	// Sign with the backend
+	options.Output = out
+	if err := signer.Sign(filePath, options); err != nil {
 		return err
 	}
 
@@ -0,0 +1,319 @@
+package sign
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+	"github.com/e-n-0/sign-app-cli/utils"
+	"howett.net/plist"
+)
+
+// Return the signed files relative to the app, in signing order
+func signedPaths(t *testing.T, app string, signer *RecordingSigner) []string {
+	t.Helper()
+
+	var paths []string
+	for _, operation := range signer.Operations {
+		if operation.Operation != "sign" {
+			continue
+		}
+		relativePath, err := filepath.Rel(app, operation.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, filepath.ToSlash(relativePath))
+	}
+	return paths
+}
+
+// Check that every bundle is signed after the items nested in it, and the app last
+func checkInsideOut(t *testing.T, paths []string) {
+	t.Helper()
+
+	for i, path := range paths {
+		// The bundles are signed through their executable, next to the bundle content
+		folder := filepath.ToSlash(filepath.Dir(path))
+		if strings.HasSuffix(path, ".dylib") {
+			continue
+		}
+		for _, nested := range paths[i+1:] {
+			if folder == "." || strings.HasPrefix(nested, folder+"/") {
+				t.Errorf("%s is signed before %s, nested in it", path, nested)
+			}
+		}
+	}
+	if len(paths) == 0 || paths[len(paths)-1] != "Test" {
+		t.Errorf("the app is not signed last: %v", paths)
+	}
+}
+
+func TestSignPathInsideOut(t *testing.T) {
+	app := writeTestApp(t)
+	signer := &RecordingSigner{}
+	params := SignerParams{Signer: signer, Output: io.Discard, Adhoc: true}
+
+	skipped, err := signPath(app, params, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) > 0 {
+		t.Errorf("unexpected skipped items: %v", skipped)
+	}
+
+	paths := signedPaths(t, app, signer)
+	checkInsideOut(t, paths)
+
+	expected := []string{
+		"Frameworks/A.framework/A",
+		"Frameworks/B.framework/B",
+		"Frameworks/libC.dylib",
+		"PlugIns/Share.appex/Frameworks/D.framework/D",
+		"PlugIns/Share.appex/Share",
+		"Test",
+		"Watch/Watch.app/PlugIns/Complication.appex/Complication",
+		"Watch/Watch.app/Watch",
+	}
+	sorted := append([]string{}, paths...)
+	sort.Strings(sorted)
+	if !reflect.DeepEqual(sorted, expected) {
+		t.Errorf("signed %v, expected %v", sorted, expected)
+	}
+
+	for _, operation := range signer.Operations {
+		if operation.Options.Identity != AdhocIdentity {
+			t.Errorf("%s signed with the identity %q", operation.Path, operation.Options.Identity)
+		}
+	}
+}
+
+func TestPlanSigningIdentityRule(t *testing.T) {
+	app := writeTestApp(t)
+	tests := []struct {
+		name   string
+		signer Signer
+		rule   string
+		valid  bool
+	}{
+		{"codesign with another identity", CodesignSigner{}, "Frameworks/*.framework:identity=Apple Distribution: Other", true},
+		{"native with another identity", NativeSigner{}, "Frameworks/*.framework:identity=Apple Distribution: Other", false},
+		{"ldid with another identity", LdidSigner{}, "Frameworks/*.framework:identity=Apple Distribution: Other", false},
+		{"native with the same identity", NativeSigner{}, "Frameworks/*.framework:identity=Apple Development: Test", true},
+		{"native ad-hoc", NativeSigner{}, "Frameworks/*.framework:identity=-", true},
+		{"ldid ad-hoc", LdidSigner{}, "Frameworks/*.framework:identity=-", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rule, err := ParseOptionRule(test.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			params := SignerParams{Signer: test.signer, CodesignCertificate: "Apple Development: Test", OptionRules: []OptionRule{rule}}
+			_, _, err = planSigning(app, params, nil)
+			if test.valid && err != nil {
+				t.Error(err)
+			}
+			if !test.valid && (err == nil || !strings.Contains(err.Error(), "another identity")) {
+				t.Errorf("error %v", err)
+			}
+		})
+	}
+}
+
+func TestSignOutputs(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		output  string
+		inPlace bool
+		err     string
+	}{
+		{name: "app to ipa", input: ".app", output: "signed/Test.ipa"},
+		{name: "app to app", input: ".app", output: "signed/Test.app"},
+		{name: "ipa to app", input: ".ipa", output: "signed/Test.app"},
+		{name: "ipa to ipa", input: ".ipa", output: "signed/Test.ipa"},
+		{name: "app in place", input: ".app", inPlace: true},
+		{name: "ipa in place", input: ".ipa", inPlace: true},
+		{name: "output is the input", input: ".app", output: "input/Test.app", err: "use --in-place"},
+		{name: "unsupported output", input: ".app", output: "signed/Test.zip", err: "unsupported output file type"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			folder := t.TempDir()
+			input := writeSignableTestApp(t, filepath.Join(folder, "input"))
+			if test.input == ".ipa" {
+				payload := filepath.Join(folder, "zip", "Payload")
+				if err := utils.CopyFolder(input, filepath.Join(payload, "Test.app")); err != nil {
+					t.Fatal(err)
+				}
+				input = filepath.Join(folder, "input", "Test.ipa")
+				if err := utils.CreateZip(input, payload); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			signer, err := NewSigner("native", SignerConfig{Adhoc: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			params := SignerParams{
+				Signer:              signer,
+				CodesignCertificate: AdhocIdentity,
+				Adhoc:               true,
+				InputFile:           input,
+				InPlace:             test.inPlace,
+				Output:              io.Discard,
+				BundleIdentifier:    "com.example.signed",
+			}
+			output := input
+			if !test.inPlace {
+				output = filepath.Join(folder, filepath.FromSlash(test.output))
+				params.OutputFile = output
+				if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = Sign(params)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error %v, expected %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The ipa outputs hold the app in their Payload folder
+			app := output
+			if filepath.Ext(output) == ".ipa" {
+				extracted := filepath.Join(folder, "extracted")
+				if err := utils.ExtractZip(output, extracted); err != nil {
+					t.Fatal(err)
+				}
+				app = filepath.Join(extracted, "Payload", "Test.app")
+			}
+			infoPlist, _, err := utils.ReadPlist(filepath.Join(app, "Info.plist"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if infoPlist["CFBundleIdentifier"] != "com.example.signed" {
+				t.Errorf("identifier %v", infoPlist["CFBundleIdentifier"])
+			}
+			result, _, err := Verify(app, io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if failure := result.FirstFailure(); failure != nil {
+				t.Errorf("%s: %s", failure.Path, failure.Err)
+			}
+
+			// Only the input signed in place changes
+			if !test.inPlace && test.input == ".app" {
+				infoPlist, _, err := utils.ReadPlist(filepath.Join(input, "Info.plist"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if infoPlist["CFBundleIdentifier"] != "com.example.test" {
+					t.Errorf("input changed: %v", infoPlist["CFBundleIdentifier"])
+				}
+			}
+		})
+	}
+}
+
+func TestSignWithoutIdentity(t *testing.T) {
+	tests := []struct {
+		name   string
+		adhoc  bool
+		pseudo bool
+		// The resources and the Info.plist are sealed
+		sealed bool
+	}{
+		{"ad-hoc", true, false, true},
+		{"pseudo", false, true, false},
+		{"ad-hoc pseudo", true, true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			folder := t.TempDir()
+			input := writeSignableTestApp(t, filepath.Join(folder, "input"))
+			output := filepath.Join(folder, "signed", "Test.app")
+
+			signer, err := NewSigner("native", SignerConfig{Adhoc: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = Sign(SignerParams{
+				Signer:              signer,
+				CodesignCertificate: AdhocIdentity,
+				Adhoc:               test.adhoc,
+				PseudoSign:          test.pseudo,
+				InputFile:           input,
+				OutputFile:          output,
+				Output:              io.Discard,
+				EntitlementEdits:    []PlistEdit{{KeyPath: "get-task-allow", Value: "true", Type: "bool"}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, bundle := range []struct {
+				path       string
+				identifier string
+			}{{".", "com.example.test"}, {"PlugIns/Share.appex", "com.example.test.share"}} {
+				folder := filepath.Join(output, filepath.FromSlash(bundle.path))
+				b, err := readBundle(folder)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, err := os.ReadFile(b.executable)
+				if err != nil {
+					t.Fatal(err)
+				}
+				signatures, err := macho.ReadSignatures(data)
+				if err != nil || len(signatures) != 1 {
+					t.Fatalf("%s: %d signatures, %v", bundle.path, len(signatures), err)
+				}
+				signature := signatures[0]
+				cd := signature.BestCodeDirectory()
+
+				// Neither a certificate nor a profile
+				if signature.CMS != nil || cd.Flags&macho.FlagAdhoc == 0 {
+					t.Errorf("%s: not signed ad-hoc, flags %#x", bundle.path, cd.Flags)
+				}
+				if cd.Identifier != bundle.identifier {
+					t.Errorf("%s: identifier %s", bundle.path, cd.Identifier)
+				}
+				if utils.FileExists(filepath.Join(folder, "embedded.mobileprovision")) {
+					t.Errorf("%s: profile embedded", bundle.path)
+				}
+				var entitlements map[string]interface{}
+				_, err = plist.Unmarshal(signature.EntitlementsPlist(), &entitlements)
+				if err != nil || entitlements["get-task-allow"] != true {
+					t.Errorf("%s: entitlements %v, %v", bundle.path, entitlements, err)
+				}
+
+				sealed := utils.FileExists(filepath.Join(folder, "_CodeSignature", "CodeResources"))
+				if sealed != test.sealed || (cd.SpecialSlot(1) != nil) != test.sealed {
+					t.Errorf("%s: sealed %v, Info.plist hash %x", bundle.path, sealed, cd.SpecialSlot(1))
+				}
+			}
+		})
+	}
+
+	// codesign has no pseudo-signatures
+	err := Sign(SignerParams{Signer: CodesignSigner{}, PseudoSign: true, InputFile: writeSignableTestApp(t, t.TempDir()), OutputFile: filepath.Join(t.TempDir(), "Test.app"), Output: io.Discard})
+	if err == nil || !strings.Contains(err.Error(), "codesign cannot pseudo-sign") {
+		t.Errorf("pseudo-signed with codesign: %v", err)
+	}
+}
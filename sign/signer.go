@@ -0,0 +1,273 @@
+package sign
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// Options of a signing operation
+type SignOptions struct {
+	Identity         string
+	EntitlementsFile string
+
+	// Code signing flags, as passed to codesign --options (see SignatureFlags)
+	Flags []string
+
+	// Secure timestamp: empty for the signer default, TimestampNone, TimestampDefault
+	// or the URL of a timestamp server
+	Timestamp string
+
+	// Parts of the existing signature kept when signing again (see PreservableMetadata)
+	PreserveMetadata []string
+
+	// Requirements in the requirement language ("designated => ..."),
+	// the default designated requirement is used when empty
+	Requirements string
+
+	// Pseudo-sign like ldid -S: only the entitlements and the code hashes,
+	// the Info.plist and the resources of the bundles are not sealed
+	Pseudo bool
+
+	// Writer of the messages of the backend, stdout when nil
+	Output io.Writer
+
+	// Context of the signing, the running signing processes are stopped when it is done
+	Context context.Context
+}
+
+func (options SignOptions) output() io.Writer {
+	if options.Output == nil {
+		return os.Stdout
+	}
+	return options.Output
+}
+
+func (options SignOptions) context() context.Context {
+	if options.Context == nil {
+		return context.Background()
+	}
+	return options.Context
+}
+
+// Identity of the ad-hoc signatures, signed without a certificate
+const AdhocIdentity = "-"
+
+// Values of SignOptions.Timestamp
+const (
+	TimestampNone    = "none"
+	TimestampDefault = "default"
+)
+
+// Code signing flags accepted in SignOptions.Flags
+var signatureFlags = map[string]uint32{
+	"hard":    0x100,
+	"kill":    0x200,
+	"library": 0x2000,
+	"runtime": macho.FlagRuntime,
+}
+
+// Parts of the signature accepted in SignOptions.PreserveMetadata
+var preservableMetadata = []string{"identifier", "entitlements", "requirements", "flags"}
+
+// List the code signing flags accepted in SignOptions.Flags
+func SignatureFlags() []string {
+	var names []string
+	for name := range signatureFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// List the parts of the signature accepted in SignOptions.PreserveMetadata
+func PreservableMetadata() []string {
+	return preservableMetadata
+}
+
+// Check the values of the signing options
+func (options SignOptions) Validate() error {
+	for _, flag := range options.Flags {
+		if _, ok := signatureFlags[flag]; !ok {
+			return fmt.Errorf("unknown code signing option %q, expected one of: %s", flag, strings.Join(SignatureFlags(), ", "))
+		}
+	}
+
+	for _, metadata := range options.PreserveMetadata {
+		if !utils.StringInSlice(metadata, preservableMetadata) {
+			return fmt.Errorf("unknown metadata %q, expected one of: %s", metadata, strings.Join(preservableMetadata, ", "))
+		}
+	}
+
+	if options.Requirements != "" {
+		if _, err := macho.CompileRequirements(options.Requirements); err != nil {
+			return fmt.Errorf("invalid requirements: %s", err)
+		}
+	}
+
+	switch options.Timestamp {
+	case "", TimestampNone, TimestampDefault:
+	default:
+		if !strings.HasPrefix(options.Timestamp, "http://") && !strings.HasPrefix(options.Timestamp, "https://") {
+			return fmt.Errorf("invalid timestamp server %q, expected an http(s) URL", options.Timestamp)
+		}
+	}
+
+	return nil
+}
+
+// Check if a part of the existing signature is kept
+func (options SignOptions) preserves(metadata string) bool {
+	return utils.StringInSlice(metadata, options.PreserveMetadata)
+}
+
+// Signer is the backend performing the code signing operations of the pipeline
+type Signer interface {
+	// Sign a Mach-O file or a bundle
+	Sign(path string, options SignOptions) error
+
+	// Verify the signature of a Mach-O file or a bundle
+	Verify(path string) error
+}
+
+// Configuration of the signer backends
+type SignerConfig struct {
+	// Certificate and private key used by the native backend
+	Identity *macho.Identity
+
+	// Only ad-hoc signatures are made, no identity is required
+	Adhoc bool
+
+	// PKCS#12 file of the identity used by the ldid backend
+	P12File     string
+	P12Password string
+}
+
+// Constructors of the signer backends selectable with --backend
+var signerBackends = map[string]func(config SignerConfig) (Signer, error){
+	"codesign": func(SignerConfig) (Signer, error) {
+		return CodesignSigner{}, nil
+	},
+	"native": func(config SignerConfig) (Signer, error) {
+		if config.Identity == nil && !config.Adhoc {
+			return nil, fmt.Errorf("the native backend requires a certificate and its private key")
+		}
+		return NativeSigner{Identity: config.Identity}, nil
+	},
+	"ldid": func(config SignerConfig) (Signer, error) {
+		if config.P12File == "" && !config.Adhoc {
+			return nil, fmt.Errorf("the ldid backend requires a PKCS#12 file (--p12)")
+		}
+		return LdidSigner{P12File: config.P12File, P12Password: config.P12Password}, nil
+	},
+}
+
+// List the names of the available signer backends
+func SignerBackends() []string {
+	var names []string
+	for name := range signerBackends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Create the signer backend with the given name
+func NewSigner(name string, config SignerConfig) (Signer, error) {
+	constructor, ok := signerBackends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown signer backend: %s", name)
+	}
+	return constructor(config)
+}
+
+// CodesignSigner signs with Apple's codesign tool
+type CodesignSigner struct{}
+
+func (CodesignSigner) Sign(path string, options SignOptions) error {
+	if options.Pseudo {
+		return fmt.Errorf("codesign cannot pseudo-sign %s, use the native backend", path)
+	}
+
+	args := []string{"codesign", "-f", "-s", options.Identity, "--generate-entitlement-der"}
+	if len(options.Flags) > 0 {
+		args = append(args, "--options", strings.Join(options.Flags, ","))
+	}
+	switch options.Timestamp {
+	case "":
+	case TimestampDefault:
+		args = append(args, "--timestamp")
+	default:
+		args = append(args, "--timestamp="+options.Timestamp)
+	}
+	if len(options.PreserveMetadata) > 0 {
+		args = append(args, "--preserve-metadata="+strings.Join(options.PreserveMetadata, ","))
+	}
+	if options.Requirements != "" {
+		// The leading "=" marks requirements given as text instead of a file
+		args = append(args, "--requirements", "="+options.Requirements)
+	}
+	if options.EntitlementsFile != "" {
+		args = append(args, "--entitlements", options.EntitlementsFile)
+	}
+	args = append(args, path)
+
+	return runCodesign(options.context(), args...)
+}
+
+func (CodesignSigner) Verify(path string) error {
+	return runCodesign(context.Background(), "codesign", "-v", path)
+}
+
+func runCodesign(ctx context.Context, args ...string) error {
+	_, status, err := utils.ExecuteProcessContext(ctx, args...)
+	if err != nil || status != 0 {
+		if err == nil {
+			err = fmt.Errorf("codesign failed with status code %d", status)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// An operation recorded by the RecordingSigner
+type SignerOperation struct {
+	Operation string
+	Path      string
+	Options   SignOptions
+}
+
+// RecordingSigner records the operations it receives without signing anything
+// It is used to check the signing order without the signing tools
+type RecordingSigner struct {
+	mutex      sync.Mutex
+	Operations []SignerOperation
+
+	// Error returned by the operations on the given paths
+	Errors map[string]error
+}
+
+func (signer *RecordingSigner) record(operation string, path string, options SignOptions) error {
+	signer.mutex.Lock()
+	defer signer.mutex.Unlock()
+
+	signer.Operations = append(signer.Operations, SignerOperation{Operation: operation, Path: path, Options: options})
+	return signer.Errors[path]
+}
+
+func (signer *RecordingSigner) Sign(path string, options SignOptions) error {
+	return signer.record("sign", path, options)
+}
+
+func (signer *RecordingSigner) Verify(path string) error {
+	return signer.record("verify", path, SignOptions{})
+}
@@ -0,0 +1,337 @@
+package sign
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/e-n-0/sign-app-cli/utils"
+
+	"howett.net/plist"
+)
+
+// Encoding of a text .strings file
+type stringsEncoding int
+
+const (
+	stringsUTF8 stringsEncoding = iota
+	stringsUTF8BOM
+	stringsUTF16LE
+	stringsUTF16BE
+)
+
+// Set a value of a .strings file, keeping its format, its comments and the order of its entries
+// Text files are edited in place, binary and XML plists are written back in their format
+// A missing file is created as UTF-8 text
+func setStringsValue(path string, key string, value string) error {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return os.WriteFile(path, []byte(stringsEntry(key, value)+"\n"), 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Keep the permissions of the existing file
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	if bytes.HasPrefix(content, []byte("bplist")) {
+		data, format, err := utils.ReadPlist(path)
+		if err != nil {
+			return err
+		}
+		data[key] = value
+		return utils.WritePlist(path, data, format)
+	}
+
+	text, encoding := decodeStringsText(content)
+
+	// The file must be valid before it is edited
+	data := map[string]interface{}{}
+	if len(bytes.TrimSpace(text)) > 0 {
+		if _, err := plist.Unmarshal(text, &data); err != nil {
+			return fmt.Errorf("failed to parse %s: %s", path, err)
+		}
+	}
+
+	var edited []byte
+	if bytes.HasPrefix(bytes.TrimSpace(text), []byte("<")) {
+		// XML plist
+		data[key] = value
+		edited, err = plist.MarshalIndent(data, plist.XMLFormat, "\t")
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %s", path, err)
+		}
+	} else {
+		editedText, err := setStringsEntry(string(text), key, value)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %s", path, err)
+		}
+		edited = []byte(editedText)
+	}
+
+	return os.WriteFile(path, encodeStringsText(edited, encoding), mode)
+}
+
+// Return the text of a .strings file as UTF-8, with its encoding
+func decodeStringsText(content []byte) ([]byte, stringsEncoding) {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xFF, 0xFE}):
+		return decodeUTF16(content[2:], binary.LittleEndian), stringsUTF16LE
+	case bytes.HasPrefix(content, []byte{0xFE, 0xFF}):
+		return decodeUTF16(content[2:], binary.BigEndian), stringsUTF16BE
+	case bytes.HasPrefix(content, []byte{0xEF, 0xBB, 0xBF}):
+		return content[3:], stringsUTF8BOM
+	}
+	return content, stringsUTF8
+}
+
+func encodeStringsText(text []byte, encoding stringsEncoding) []byte {
+	switch encoding {
+	case stringsUTF16LE:
+		return encodeUTF16(string(text), binary.LittleEndian, []byte{0xFF, 0xFE})
+	case stringsUTF16BE:
+		return encodeUTF16(string(text), binary.BigEndian, []byte{0xFE, 0xFF})
+	case stringsUTF8BOM:
+		return append([]byte{0xEF, 0xBB, 0xBF}, text...)
+	}
+	return text
+}
+
+// Replace the value of a key in the text of a .strings file, or add the entry at the end
+// The rest of the text, comments included, is kept as is
+func setStringsEntry(text string, key string, value string) (string, error) {
+	scanner := stringsScanner{text: text}
+	insert := len(text)
+	for {
+		if err := scanner.skipSpace(); err != nil {
+			return "", err
+		}
+		if scanner.pos >= len(text) {
+			break
+		}
+
+		// The entries may be enclosed in a dictionary
+		if text[scanner.pos] == '{' {
+			scanner.pos++
+			continue
+		}
+		if text[scanner.pos] == '}' {
+			insert = scanner.pos
+			break
+		}
+
+		keyStart := scanner.pos
+		entryKey, err := scanner.token()
+		if err != nil {
+			return "", err
+		}
+		if err := scanner.skipSpace(); err != nil {
+			return "", err
+		}
+
+		// "key"; is a shorthand for "key" = "key";
+		valueStart, valueEnd := keyStart, scanner.pos
+		if !scanner.accept(';') {
+			if !scanner.accept('=') {
+				return "", scanner.unexpected()
+			}
+			if err := scanner.skipSpace(); err != nil {
+				return "", err
+			}
+			valueStart = scanner.pos
+			if _, err := scanner.token(); err != nil {
+				return "", err
+			}
+			valueEnd = scanner.pos
+			if err := scanner.skipSpace(); err != nil {
+				return "", err
+			}
+			if !scanner.accept(';') {
+				return "", scanner.unexpected()
+			}
+		}
+
+		if entryKey == key {
+			replacement := quoteStringsValue(value)
+			if valueStart == keyStart {
+				replacement = stringsEntry(key, value)
+				valueEnd = scanner.pos
+			}
+			return text[:valueStart] + replacement + text[valueEnd:], nil
+		}
+	}
+
+	// The new entry goes on its own line
+	prefix := text[:insert]
+	if strings.TrimSpace(prefix) != "" && !strings.HasSuffix(prefix, "\n") {
+		prefix += "\n"
+	}
+	return prefix + stringsEntry(key, value) + "\n" + text[insert:], nil
+}
+
+func stringsEntry(key string, value string) string {
+	return quoteStringsValue(key) + " = " + quoteStringsValue(value) + ";"
+}
+
+func quoteStringsValue(value string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\t", "\\t", "\r", "\\r")
+	return "\"" + replacer.Replace(value) + "\""
+}
+
+// Reader of the entries of a text .strings file
+type stringsScanner struct {
+	text string
+	pos  int
+}
+
+// Skip the spaces and the comments
+func (scanner *stringsScanner) skipSpace() error {
+	for scanner.pos < len(scanner.text) {
+		rest := scanner.text[scanner.pos:]
+		switch {
+		case strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			scanner.pos += end
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return fmt.Errorf("unterminated comment at offset %d", scanner.pos)
+			}
+			scanner.pos += end + 4
+		case strings.ContainsRune(" \t\r\n", rune(rest[0])):
+			scanner.pos++
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+func (scanner *stringsScanner) accept(c byte) bool {
+	if scanner.pos < len(scanner.text) && scanner.text[scanner.pos] == c {
+		scanner.pos++
+		return true
+	}
+	return false
+}
+
+func (scanner *stringsScanner) unexpected() error {
+	if scanner.pos >= len(scanner.text) {
+		return fmt.Errorf("unexpected end of file")
+	}
+	return fmt.Errorf("unexpected character %q at offset %d", scanner.text[scanner.pos], scanner.pos)
+}
+
+// Read a quoted string or an unquoted word and return its value
+func (scanner *stringsScanner) token() (string, error) {
+	start := scanner.pos
+	if scanner.accept('"') {
+		for scanner.pos < len(scanner.text) {
+			switch scanner.text[scanner.pos] {
+			case '\\':
+				scanner.pos += 2
+			case '"':
+				scanner.pos++
+				var value string
+				if _, err := plist.Unmarshal([]byte(scanner.text[start:scanner.pos]), &value); err != nil {
+					return "", fmt.Errorf("invalid string at offset %d: %s", start, err)
+				}
+				return value, nil
+			default:
+				scanner.pos++
+			}
+		}
+		return "", fmt.Errorf("unterminated string at offset %d", start)
+	}
+
+	for scanner.pos < len(scanner.text) && isStringsWordChar(scanner.text[scanner.pos]) {
+		scanner.pos++
+	}
+	if scanner.pos == start {
+		return "", scanner.unexpected()
+	}
+	return scanner.text[start:scanner.pos], nil
+}
+
+func isStringsWordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("_$+/:.-", c) >= 0
+}
+
+func decodeUTF16(content []byte, order binary.ByteOrder) []byte {
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		units[i] = order.Uint16(content[i*2:])
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+func encodeUTF16(text string, order binary.ByteOrder, bom []byte) []byte {
+	units := utf16.Encode([]rune(text))
+	content := make([]byte, len(bom)+len(units)*2)
+	copy(content, bom)
+	for i, unit := range units {
+		order.PutUint16(content[len(bom)+i*2:], unit)
+	}
+	return content
+}
+
+// Update CFBundleDisplayName in the localized InfoPlist.strings files of a bundle resources folder
+// Names are given by locale, the "*" locale applies to every localization not listed
+// When requireLocales is set, every listed locale must exist in the bundle
+func updateLocalizedDisplayNames(out io.Writer, resourcesFolder string, names map[string]string, requireLocales bool) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(resourcesFolder)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	found := map[string]bool{}
+	for _, entry := range entries {
+		if !entry.IsDir() || filepath.Ext(entry.Name()) != ".lproj" {
+			continue
+		}
+
+		locale := strings.TrimSuffix(entry.Name(), ".lproj")
+		name, explicit := names[locale]
+		if !explicit {
+			if name = names["*"]; name == "" {
+				continue
+			}
+		}
+		found[locale] = true
+
+		stringsPath := filepath.Join(resourcesFolder, entry.Name(), "InfoPlist.strings")
+		if _, err := os.Stat(stringsPath); err != nil && !explicit {
+			// The name from Info.plist is already used for this locale
+			continue
+		}
+
+		if err := setStringsValue(stringsPath, "CFBundleDisplayName", name); err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "Updated display name for locale", locale)
+	}
+
+	for locale := range names {
+		if requireLocales && locale != "*" && !found[locale] {
+			return fmt.Errorf("the app has no %s.lproj localization in %s", locale, resourcesFolder)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package sign
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"howett.net/plist"
+)
+
+func TestSetStringsEntry(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{
+			name:     "replaced value keeps the comments and the order",
+			text:     "/* Bundle name */\n\"CFBundleName\" = \"App\";\n// Shown on the home screen\n\"CFBundleDisplayName\" = \"Old\";\n\"NSCameraUsageDescription\" = \"Camera\";\n",
+			expected: "/* Bundle name */\n\"CFBundleName\" = \"App\";\n// Shown on the home screen\n\"CFBundleDisplayName\" = \"New \\\"name\\\"\";\n\"NSCameraUsageDescription\" = \"Camera\";\n",
+		},
+		{
+			name:     "missing key added at the end",
+			text:     "\"CFBundleName\" = \"App\";",
+			expected: "\"CFBundleName\" = \"App\";\n\"CFBundleDisplayName\" = \"New \\\"name\\\"\";\n",
+		},
+		{
+			name:     "empty file",
+			text:     "",
+			expected: "\"CFBundleDisplayName\" = \"New \\\"name\\\"\";\n",
+		},
+		{
+			name:     "unquoted key and value",
+			text:     "CFBundleDisplayName = Old; /* kept */\n",
+			expected: "CFBundleDisplayName = \"New \\\"name\\\"\"; /* kept */\n",
+		},
+		{
+			name:     "shorthand entry",
+			text:     "\"CFBundleDisplayName\";\n",
+			expected: "\"CFBundleDisplayName\" = \"New \\\"name\\\"\";\n",
+		},
+		{
+			name:     "escaped value",
+			text:     "\"CFBundleDisplayName\" = \"a \\\"quoted\\\" ; value\";\n",
+			expected: "\"CFBundleDisplayName\" = \"New \\\"name\\\"\";\n",
+		},
+		{
+			name:     "dictionary",
+			text:     "{\n\t\"CFBundleName\" = \"App\";\n}\n",
+			expected: "{\n\t\"CFBundleName\" = \"App\";\n\"CFBundleDisplayName\" = \"New \\\"name\\\"\";\n}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			edited, err := setStringsEntry(test.text, "CFBundleDisplayName", "New \"name\"")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if edited != test.expected {
+				t.Errorf("got:\n%s\nexpected:\n%s", edited, test.expected)
+			}
+		})
+	}
+}
+
+func TestSetStringsEntryInvalid(t *testing.T) {
+	for _, text := range []string{"\"CFBundleName\" = \"App\"", "\"CFBundleName\" = \"App", "/* comment", "\"CFBundleName\" \"App\";"} {
+		if _, err := setStringsEntry(text, "CFBundleDisplayName", "New"); err == nil {
+			t.Errorf("no error for %q", text)
+		}
+	}
+}
+
+func TestSetStringsValueKeepsFormat(t *testing.T) {
+	folder := t.TempDir()
+
+	// UTF-16 text keeps its byte order mark and its comments
+	utf16Path := filepath.Join(folder, "utf16.strings")
+	text := "/* comment */\n\"CFBundleDisplayName\" = \"Old\";\n"
+	if err := os.WriteFile(utf16Path, encodeUTF16(text, binary.LittleEndian, []byte{0xFF, 0xFE}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := setStringsValue(utf16Path, "CFBundleDisplayName", "New"); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(utf16Path)
+	expected := encodeUTF16("/* comment */\n\"CFBundleDisplayName\" = \"New\";\n", binary.LittleEndian, []byte{0xFF, 0xFE})
+	if !bytes.Equal(content, expected) {
+		t.Errorf("UTF-16 file not edited in place: %q", content)
+	}
+
+	// Binary and XML plists stay in their format
+	for _, format := range []int{plist.BinaryFormat, plist.XMLFormat} {
+		path := filepath.Join(folder, plist.FormatNames[format]+".strings")
+		data, err := plist.Marshal(map[string]interface{}{"CFBundleDisplayName": "Old", "CFBundleName": "App"}, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := setStringsValue(path, "CFBundleDisplayName", "New"); err != nil {
+			t.Fatal(err)
+		}
+		content, _ := os.ReadFile(path)
+		var values map[string]interface{}
+		written, err := plist.Unmarshal(content, &values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if written != format {
+			t.Errorf("%s file written as %s", plist.FormatNames[format], plist.FormatNames[written])
+		}
+		if values["CFBundleDisplayName"] != "New" || values["CFBundleName"] != "App" {
+			t.Errorf("%s file has the values %v", plist.FormatNames[format], values)
+		}
+	}
+
+	// A missing file is created as text
+	newPath := filepath.Join(folder, "new.strings")
+	if err := setStringsValue(newPath, "CFBundleDisplayName", "New"); err != nil {
+		t.Fatal(err)
+	}
+	content, _ = os.ReadFile(newPath)
+	if string(content) != "\"CFBundleDisplayName\" = \"New\";\n" {
+		t.Errorf("new file has the content %q", content)
+	}
+}
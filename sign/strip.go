@@ -0,0 +1,99 @@
+package sign
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// Glob pattern of a strippable component
+// The pattern is relative to the app, or to the extracted ipa when fromWorkFolder is set
+type stripPattern struct {
+	pattern        string
+	fromWorkFolder bool
+}
+
+// Named components accepted by --strip
+var strippableComponents = map[string][]stripPattern{
+	"watch":           {{pattern: "Watch"}, {pattern: "com.apple.WatchPlaceholder"}},
+	"plugins":         {{pattern: "PlugIns"}},
+	"sc-info":         {{pattern: "**/SC_Info"}},
+	"itunes-metadata": {{"iTunesMetadata.plist", true}, {"iTunesArtwork", true}},
+	"macosx":          {{"**/__MACOSX", true}},
+	"ds-store":        {{"**/.DS_Store", true}},
+}
+
+// Components removed from the Info.plist instead of the file system
+var strippablePlistKeys = map[string]string{
+	"supported-devices": "UISupportedDevices",
+}
+
+// List the component names accepted by --strip
+func StrippableComponents() []string {
+	var names []string
+	for name := range strippableComponents {
+		names = append(names, name)
+	}
+	for name := range strippablePlistKeys {
+		names = append(names, name)
+	}
+	names = append(names, "plugins:<name>")
+	sort.Strings(names)
+	return names
+}
+
+// Remove the unwanted components from the work folder and return the removed items
+// A component is either a name from StrippableComponents or a glob pattern relative to the app
+func stripComponents(workFolder string, appFolder string, components []string) ([]string, error) {
+	var removed []string
+	changes := &bundleChanges{}
+
+	for _, component := range components {
+		if key, ok := strippablePlistKeys[component]; ok {
+			data, format, err := utils.ReadPlist(filepath.Join(appFolder, "Info.plist"))
+			if err != nil {
+				return nil, err
+			}
+
+			if _, ok := data[key]; ok {
+				delete(data, key)
+				if err := utils.WritePlist(filepath.Join(appFolder, "Info.plist"), data, format); err != nil {
+					return nil, err
+				}
+				removed = append(removed, "Info.plist: "+key)
+			}
+			continue
+		}
+
+		patterns, ok := strippableComponents[component]
+		if !ok {
+			if name := strings.TrimPrefix(component, "plugins:"); name != component {
+				patterns = []stripPattern{{pattern: "PlugIns/" + strings.TrimSuffix(name, ".appex") + ".appex"}}
+			} else {
+				patterns = []stripPattern{{pattern: component}}
+			}
+		}
+
+		for _, pattern := range patterns {
+			root := appFolder
+			if pattern.fromWorkFolder {
+				root = workFolder
+			}
+
+			if err := removeFromBundle(root, pattern.pattern, changes); err != nil {
+				return nil, fmt.Errorf("failed to strip %s: %s", component, err)
+			}
+
+			for _, path := range changes.removed {
+				relativePath, _ := filepath.Rel(workFolder, filepath.Join(root, path))
+				removed = append(removed, relativePath)
+			}
+			changes.removed = nil
+		}
+	}
+
+	return removed, nil
+}
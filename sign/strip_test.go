@@ -0,0 +1,97 @@
+package sign
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/e-n-0/sign-app-cli/utils"
+	"howett.net/plist"
+)
+
+func TestStripComponents(t *testing.T) {
+	work := map[string]string{
+		"iTunesMetadata.plist":                                      "metadata",
+		"iTunesArtwork":                                             "artwork",
+		"__MACOSX/Payload/._Test.app":                               "resource fork",
+		"Payload/.DS_Store":                                         "finder",
+		"Payload/Test.app/.DS_Store":                                "finder",
+		"Payload/Test.app/SC_Info/Test.sinf":                        "sinf",
+		"Payload/Test.app/Watch/Watch.app/Watch":                    "watch",
+		"Payload/Test.app/PlugIns/Share.appex/Share":                "share",
+		"Payload/Test.app/PlugIns/Widget.appex/Widget":              "widget",
+		"Payload/Test.app/PlugIns/Widget.appex/SC_Info/Widget.sinf": "sinf",
+		"Payload/Test.app/Assets/debug.json":                        "debug",
+	}
+
+	tests := []struct {
+		name       string
+		components []string
+		removed    []string
+	}{
+		{"watch", []string{"watch"}, []string{"Payload/Test.app/Watch"}},
+		{"plugins", []string{"plugins"}, []string{"Payload/Test.app/PlugIns"}},
+		{"one plugin", []string{"plugins:Widget"}, []string{"Payload/Test.app/PlugIns/Widget.appex"}},
+		{"one plugin with extension", []string{"plugins:Share.appex"}, []string{"Payload/Test.app/PlugIns/Share.appex"}},
+		{"store files", []string{"sc-info", "itunes-metadata"}, []string{
+			"Payload/Test.app/PlugIns/Widget.appex/SC_Info",
+			"Payload/Test.app/SC_Info",
+			"iTunesArtwork",
+			"iTunesMetadata.plist",
+		}},
+		{"archive files", []string{"macosx", "ds-store"}, []string{"Payload/.DS_Store", "Payload/Test.app/.DS_Store", "__MACOSX"}},
+		{"glob", []string{"Assets/*.json"}, []string{"Payload/Test.app/Assets/debug.json"}},
+		{"supported devices", []string{"supported-devices"}, []string{"Info.plist: UISupportedDevices"}},
+		{"missing component", []string{"plugins:Missing"}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			workFolder := t.TempDir()
+			writeTestFiles(t, workFolder, work)
+			appFolder := filepath.Join(workFolder, "Payload", "Test.app")
+			if err := utils.WritePlist(filepath.Join(appFolder, "Info.plist"), map[string]interface{}{
+				"CFBundleIdentifier": "com.example.test",
+				"UISupportedDevices": []interface{}{"iPhone10,3"},
+			}, plist.XMLFormat); err != nil {
+				t.Fatal(err)
+			}
+
+			removed, err := stripComponents(workFolder, appFolder, test.components)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range removed {
+				removed[i] = filepath.ToSlash(removed[i])
+			}
+			sort.Strings(removed)
+			if !reflect.DeepEqual(removed, test.removed) {
+				t.Errorf("removed %q, expected %q", removed, test.removed)
+			}
+
+			// The removed items are gone, the other files are kept
+			files := readTestFiles(t, workFolder)
+			for name := range work {
+				stripped := false
+				for _, path := range test.removed {
+					if name == path || strings.HasPrefix(name, path+"/") {
+						stripped = true
+					}
+				}
+				if _, ok := files[name]; ok == stripped {
+					t.Errorf("%s stripped %v", name, !ok)
+				}
+			}
+
+			infoPlist, _, err := utils.ReadPlist(filepath.Join(appFolder, "Info.plist"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := infoPlist["UISupportedDevices"]; ok == (test.name == "supported devices") {
+				t.Errorf("UISupportedDevices %v", infoPlist["UISupportedDevices"])
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package sign
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// An item of the app that gets signed: a Mach-O file or a bundle folder
+type signTarget struct {
+	path string
+
+	// Main executable of the bundle, empty for Mach-O files
+	executable string
+}
+
+func (target signTarget) isBundle() bool {
+	return target.executable != ""
+}
+
+// An item that looks like code but is not signed
+type skippedItem struct {
+	path   string
+	reason string
+}
+
+// Extensions of files expected to be Mach-O, reported when they are not
+var codeExtensions = []string{".dylib", ".so"}
+
+// Check if a non Mach-O file looks like code that should have been signed
+func looksLikeCode(path string, info os.FileInfo) bool {
+	return info.Mode().Perm()&0111 != 0 || utils.StringInSlice(filepath.Ext(path), codeExtensions)
+}
+
+// List the items of the folder to sign, in the order they must be signed
+// The nested code of a bundle is listed before the bundle itself (inside-out),
+// the skipped items are the files and bundles that look like code but cannot be signed
+func collectSignTargets(folder string) ([]signTarget, []skippedItem, error) {
+	var targets []signTarget
+	var skipped []skippedItem
+
+	// Main executables of the bundles, signed with their bundle
+	// (they are in a subfolder of macOS bundles)
+	executables := map[string]bool{}
+
+	var visit func(folder string) error
+	visit = func(folder string) error {
+		var executable string
+		b, err := readBundle(folder)
+		if err != nil {
+			skipped = append(skipped, skippedItem{path: folder, reason: err.Error()})
+		} else if b != nil && b.executable != "" {
+			executable = b.executable
+			executables[executable] = true
+		}
+
+		entries, err := os.ReadDir(folder)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(folder, entry.Name())
+
+			// Symbolic links point to items signed through their real path
+			if entry.Type()&os.ModeSymlink != 0 {
+				continue
+			}
+
+			if entry.IsDir() {
+				if err := visit(path); err != nil {
+					return err
+				}
+				continue
+			}
+
+			// The main executable is signed with its bundle
+			if executables[path] {
+				continue
+			}
+
+			isMachO, err := macho.IsMachOFile(path)
+			if err != nil {
+				return err
+			}
+			if isMachO {
+				// Object files and debug symbols are Mach-O files that are never signed
+				signable, err := macho.IsSignableFile(path)
+				if err != nil {
+					return err
+				}
+				if signable {
+					targets = append(targets, signTarget{path: path})
+				} else {
+					skipped = append(skipped, skippedItem{path: path, reason: "not an executable, a library or a bundle"})
+				}
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			if looksLikeCode(path, info) {
+				skipped = append(skipped, skippedItem{path: path, reason: "not a Mach-O file"})
+			}
+		}
+
+		if executable != "" {
+			targets = append(targets, signTarget{path: folder, executable: executable})
+		}
+		return nil
+	}
+
+	if err := visit(folder); err != nil {
+		return nil, nil, err
+	}
+	return targets, skipped, nil
+}
@@ -0,0 +1,43 @@
+package sign
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCollectSignTargetsFileTypes(t *testing.T) {
+	app := writeTestApp(t)
+	writeTestMachO(t, filepath.Join(app, "Frameworks", "libC.o"), testMachOObject)
+	writeTestMachO(t, filepath.Join(app, "Test.dSYM", "Contents", "Resources", "DWARF", "Test"), testMachODSYM)
+
+	targets, skipped, err := collectSignTargets(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range targets {
+		if strings.HasSuffix(target.path, ".o") || strings.Contains(target.path, ".dSYM") {
+			t.Errorf("%s is signed", target.path)
+		}
+	}
+	if !reflect.DeepEqual(skippedPaths(t, app, skipped), []string{"Frameworks/libC.o", "Test.dSYM/Contents/Resources/DWARF/Test"}) {
+		t.Errorf("skipped %v", skipped)
+	}
+}
+
+// Return the skipped items relative to the app
+func skippedPaths(t *testing.T, app string, skipped []skippedItem) []string {
+	t.Helper()
+
+	var paths []string
+	for _, item := range skipped {
+		relativePath, err := filepath.Rel(app, item.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, filepath.ToSlash(relativePath))
+	}
+	return paths
+}
@@ -2,6 +2,7 @@ package sign
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
@@ -9,7 +10,7 @@ import (
 	"github.com/e-n-0/sign-app-cli/utils"
 )
 
-func tryCodeSign(codesignCertificate string, tmpFolder string) error {
+func tryCodeSign(out io.Writer, signer Signer, codesignCertificate string, tmpFolder string) error {
 	// Copy own binary to tmp folder
 	ownBinary := os.Args[0]
 	testBinaryPath := filepath.Join(tmpFolder, "test-sign-file")
@@ -19,41 +20,52 @@ func tryCodeSign(codesignCertificate string, tmpFolder string) error {
 	}
 
 	// Try to sign the binary
-	codeSign(testBinaryPath, codesignCertificate, "", "")
+	codeSign(out, signer, testBinaryPath, SignOptions{Identity: codesignCertificate}, "")
 
 	// Check if the binary is signed
-	_, status, err := utils.ExecuteProcess("codesign", "-v", testBinaryPath)
+	err = signer.Verify(testBinaryPath)
 	os.Remove(testBinaryPath)
-	if err != nil || status != 0 {
-		if err == nil {
-			err = fmt.Errorf("codesign failed with status code %d", status)
-		}
-
-		return err
-	}
-
-	return nil
+	return err
 }
 
 // Try to sign an arbitrary file to test if the certificate is valid
-func trySignCodeFail(tmpFolder string, codesignCertificate string) error {
+func trySignCodeFail(out io.Writer, tmpFolder string, signer Signer, codesignCertificate string) error {
 	testTmpFolder := filepath.Join(tmpFolder, "test-codesign")
 	err := os.Mkdir(testTmpFolder, 0755)
 	if err != nil {
 		return err
 	}
 
-	if err := tryCodeSign(codesignCertificate, testTmpFolder); err != nil {
+	if err := tryCodeSign(out, signer, codesignCertificate, testTmpFolder); err != nil {
 		codesigning.FixSigningError()
 
 		// Try again
-		if err := tryCodeSign(codesignCertificate, testTmpFolder); err != nil {
+		if err := tryCodeSign(out, signer, codesignCertificate, testTmpFolder); err != nil {
 			return fmt.Errorf("failed to resolve the codesigning issue: %s", err)
 		}
 
-		fmt.Println("Codesigning issue resolved")
+		fmt.Fprintln(out, "Codesigning issue resolved")
 	}
 	os.RemoveAll(testTmpFolder)
 
 	return nil
 }
+
+// Test the keychain identity of the parameters before signing, fixing it may ask for a confirmation
+// Sign does the same unless IdentityChecked is set, so that the jobs signing at the same time never ask
+func CheckIdentity(params SignerParams) error {
+	if params.Signer == nil {
+		params.Signer = CodesignSigner{}
+	}
+	if !params.needsIdentityCheck() {
+		return nil
+	}
+
+	tmpFolder, err := os.MkdirTemp("", "sign-app-cli-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary folder: %s", err)
+	}
+	defer os.RemoveAll(tmpFolder)
+
+	return trySignCodeFail(params.output(), tmpFolder, params.Signer, params.CodesignCertificate)
+}
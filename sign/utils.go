@@ -22,10 +22,11 @@ func locateAppFolder(inputFolder string) (string, error) {
 		return "", fmt.Errorf("the input folder is not a folder")
 	}
 
+	// The Payload folder may contain other folders, like __MACOSX
 	appFolder := ""
 	if files, err := ioutil.ReadDir(inputFolder); err == nil {
 		for _, file := range files {
-			if file.IsDir() {
+			if file.IsDir() && filepath.Ext(file.Name()) == ".app" {
 				appFolder = filepath.Join(inputFolder, file.Name())
 				break
 			}
@@ -0,0 +1,185 @@
+package sign
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// A signed copy of the input produced by SignVariants
+type Variant struct {
+	Name string
+	// Signing parameters of the variant, its input file is the one given to SignVariants
+	Params SignerParams
+}
+
+// Result of a variant signed by SignVariants
+type VariantResult struct {
+	Name       string
+	OutputFile string
+	Duration   time.Duration
+	Err        error
+}
+
+// Sign several variants of the input file of params in parallel, at most params.Jobs at the same time
+// The input is extracted once and each variant is signed on its own copy of the extracted files
+// The progress messages of the variants go to the output of params, prefixed by the variant name
+// Return an error when the input cannot be opened, the errors of the variants otherwise
+func SignVariants(params SignerParams, variants []Variant) ([]VariantResult, error) {
+	out := params.output()
+	fmt.Fprintf(out, "Starting the signing of %d variant%s of file: %s\n", len(variants), utils.Plural(len(variants)), params.InputFile)
+	start := time.Now()
+
+	tmpFolder, err := os.MkdirTemp("", "sign-app-cli-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary folder: %s", err)
+	}
+	defer os.RemoveAll(tmpFolder)
+
+	// The variants are checked before the input is extracted
+	names := map[string]bool{}
+	outputs := map[string]string{}
+	for i := range variants {
+		variant := &variants[i]
+		if variant.Name == "" || names[variant.Name] {
+			return nil, fmt.Errorf("the variants must have different names, got %q twice", variant.Name)
+		}
+		names[variant.Name] = true
+
+		if variant.Params.InPlace {
+			return nil, fmt.Errorf("the variant %s cannot be signed in place", variant.Name)
+		}
+		variant.Params.InputFile = params.InputFile
+		variant.Params.IncludeSymbols = params.IncludeSymbols
+		if variant.Params.Signer == nil {
+			variant.Params.Signer = CodesignSigner{}
+		}
+
+		_, outputFile, err := signingFiles(variant.Params)
+		if err != nil {
+			return nil, fmt.Errorf("invalid variant %s: %s", variant.Name, err)
+		}
+		if other, ok := outputs[filepath.Clean(outputFile)]; ok {
+			return nil, fmt.Errorf("the variants %s and %s have the same output file %s", other, variant.Name, outputFile)
+		}
+		outputs[filepath.Clean(outputFile)] = variant.Name
+
+		// The keychain identities are tested one at a time, fixing them may ask for a confirmation
+		if variant.Params.needsIdentityCheck() {
+			err = trySignCodeFail(out, tmpFolder, variant.Params.Signer, variant.Params.CodesignCertificate)
+			if err != nil {
+				return nil, fmt.Errorf("invalid variant %s: %s", variant.Name, err)
+			}
+		}
+	}
+
+	inputFile := filepath.Clean(params.InputFile)
+	workFolder, appFolder, err := openInput(out, inputFile, tmpFolder, false, params.IncludeSymbols)
+	if err != nil {
+		return nil, err
+	}
+
+	// At most params.Jobs variants are signed at the same time
+	var lock sync.Mutex
+	var wait sync.WaitGroup
+	slots := make(chan struct{}, params.jobs())
+	results := make([]VariantResult, len(variants))
+	for i, variant := range variants {
+		results[i] = VariantResult{Name: variant.Name, OutputFile: variant.Params.OutputFile}
+
+		wait.Add(1)
+		go func(i int, variant Variant) {
+			defer wait.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			variantStart := time.Now()
+
+			output := &prefixWriter{out: out, prefix: "[" + variant.Name + "] ", lock: &lock}
+			variant.Params.Output = output
+			defer output.flush()
+
+			// A failing variant must not stop the others
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					results[i].Err = fmt.Errorf("%v", recovered)
+				}
+				results[i].Duration = time.Since(variantStart)
+			}()
+
+			// Each variant works in its own folder, next to the extracted input
+			variantFolder := filepath.Join(tmpFolder, "variant-"+strconv.Itoa(i))
+			results[i].Err = signVariant(variant.Params, inputFile, variantFolder, workFolder, appFolder, start)
+		}(i, variant)
+	}
+	wait.Wait()
+
+	return results, nil
+}
+
+// Sign a variant on a copy of the work folder made in variantFolder
+func signVariant(params SignerParams, inputFile string, variantFolder string, workFolder string, appFolder string, start time.Time) error {
+	err := os.Mkdir(variantFolder, 0755)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(params.output(), "Copying the extracted input...")
+	variantWorkFolder := filepath.Join(variantFolder, "work")
+	err = utils.CloneFolder(workFolder, variantWorkFolder)
+	if err != nil {
+		return fmt.Errorf("failed to copy the extracted input: %s", err)
+	}
+
+	relativeApp, err := filepath.Rel(workFolder, appFolder)
+	if err != nil {
+		return err
+	}
+	return signWorkFolder(params, inputFile, params.OutputFile, variantFolder, variantWorkFolder, filepath.Join(variantWorkFolder, relativeApp), start)
+}
+
+// Writer prefixing every line, the writers sharing the lock write whole lines one at a time
+type prefixWriter struct {
+	out    io.Writer
+	prefix string
+	lock   *sync.Mutex
+
+	// Last line, written once complete
+	line []byte
+}
+
+func (writer *prefixWriter) Write(data []byte) (int, error) {
+	writer.line = append(writer.line, data...)
+	for {
+		index := bytes.IndexByte(writer.line, '\n')
+		if index < 0 {
+			break
+		}
+		if err := writer.writeLine(writer.line[:index+1]); err != nil {
+			return 0, err
+		}
+		writer.line = writer.line[index+1:]
+	}
+	return len(data), nil
+}
+
+// Write the last line when it does not end with a newline
+func (writer *prefixWriter) flush() {
+	if len(writer.line) > 0 {
+		writer.writeLine(append(writer.line, '\n'))
+		writer.line = nil
+	}
+}
+
+func (writer *prefixWriter) writeLine(line []byte) error {
+	writer.lock.Lock()
+	defer writer.lock.Unlock()
+	_, err := fmt.Fprintf(writer.out, "%s%s", writer.prefix, line)
+	return err
+}
@@ -0,0 +1,73 @@
+package sign
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/e-n-0/sign-app-cli/utils"
+)
+
+// Write an app with an extension that can be signed ad-hoc by the native backend
+// Return the app folder
+func writeSignableTestApp(t *testing.T, folder string) string {
+	t.Helper()
+
+	app := filepath.Join(folder, "Test.app")
+	writeSignableTestMachO(t, writeTestBundle(t, app, "com.example.test"))
+	writeSignableTestMachO(t, writeTestBundle(t, filepath.Join(app, "PlugIns", "Share.appex"), "com.example.test.share"))
+	return app
+}
+
+func TestSignVariants(t *testing.T) {
+	folder := t.TempDir()
+	app := writeSignableTestApp(t, filepath.Join(folder, "input"))
+
+	signer, err := NewSigner("native", SignerConfig{Adhoc: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	variant := func(name string, identifier string) Variant {
+		return Variant{Name: name, Params: SignerParams{
+			Signer:              signer,
+			CodesignCertificate: AdhocIdentity,
+			Adhoc:               true,
+			OutputFile:          filepath.Join(folder, name, "Test.app"),
+			BundleIdentifier:    identifier,
+		}}
+	}
+
+	tests := []struct {
+		name        string
+		identifiers []string
+	}{
+		{"development", []string{"com.example.test", "com.example.test.share"}},
+		{"beta", []string{"com.example.beta", "com.example.beta.share"}},
+		{"enterprise", []string{"com.other.app", "com.other.app.share"}},
+	}
+	variants := []Variant{variant("development", ""), variant("beta", "com.example.beta"), variant("enterprise", "com.other.app")}
+
+	// The variants are signed one at a time
+	results, err := SignVariants(SignerParams{InputFile: app, Output: io.Discard, Jobs: 1}, variants)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		if results[i].Name != test.name || results[i].Err != nil {
+			t.Fatalf("variant %s: %v", results[i].Name, results[i].Err)
+		}
+		output := filepath.Join(folder, test.name, "Test.app")
+		for j, bundle := range []string{output, filepath.Join(output, "PlugIns", "Share.appex")} {
+			infoPlist, _, err := utils.ReadPlist(filepath.Join(bundle, "Info.plist"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if infoPlist["CFBundleIdentifier"] != test.identifiers[j] {
+				t.Errorf("%s: %s identifier %v, expected %s", test.name, bundle, infoPlist["CFBundleIdentifier"], test.identifiers[j])
+			}
+		}
+		if result, _, err := Verify(output, io.Discard); err != nil || result.FirstFailure() != nil {
+			t.Errorf("%s: signature of the output: %v %v", test.name, err, result.FirstFailure())
+		}
+	}
+}
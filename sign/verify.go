@@ -0,0 +1,362 @@
+package sign
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+	"github.com/e-n-0/sign-app-cli/provisioningprofiles"
+	"github.com/e-n-0/sign-app-cli/utils"
+
+	"howett.net/plist"
+)
+
+// Result of the verification of a signed item and of the items nested in it
+type VerifyResult struct {
+	// Path relative to the app, "." for the app itself
+	Path string
+	// First mismatch found, nil when the signature is valid
+	Err error
+	// Signed with a certificate, with an ad-hoc signature otherwise
+	Certificate string
+
+	Children []*VerifyResult
+}
+
+// Return the first invalid item, nested items first like the signing order
+func (result *VerifyResult) FirstFailure() *VerifyResult {
+	for _, child := range result.Children {
+		if failure := child.FirstFailure(); failure != nil {
+			return failure
+		}
+	}
+	if result.Err != nil {
+		return result
+	}
+	return nil
+}
+
+// Print the results as a tree, in green when valid and in red otherwise
+func (result *VerifyResult) Print(out io.Writer, appName string) {
+	var print func(result *VerifyResult, indent string)
+	print = func(result *VerifyResult, indent string) {
+		path := result.Path
+		if path == "." {
+			path = appName
+		}
+
+		if result.Err != nil {
+			fmt.Fprintf(out, "%s\033[31mFAIL\033[0m %s: %s\n", indent, path, result.Err)
+		} else {
+			signer := "ad-hoc"
+			if result.Certificate != "" {
+				signer = result.Certificate
+			}
+			fmt.Fprintf(out, "%s\033[32mPASS\033[0m %s (%s)\n", indent, path, signer)
+		}
+
+		for _, child := range result.Children {
+			print(child, indent+"  ")
+		}
+	}
+	print(result, "")
+}
+
+// Verify the signatures of an ipa or an app without codesign, the progress is written to out
+// Return the results of the app and the name of the app
+// The items that look like code but are not signed are failures
+func Verify(inputFile string, out io.Writer) (*VerifyResult, string, error) {
+	appFolder := filepath.Clean(inputFile)
+	switch filepath.Ext(appFolder) {
+	case ".ipa":
+		tmpFolder, err := os.MkdirTemp("", "sign-app-cli-*")
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create temporary folder: %s", err)
+		}
+		defer os.RemoveAll(tmpFolder)
+
+		fmt.Fprintln(out, "Extracting ipa file...")
+		err = utils.ExtractZip(inputFile, tmpFolder)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to extract ipa file, error: %s", err)
+		}
+		appFolder, err = locateAppFolder(filepath.Join(tmpFolder, "Payload"))
+		if err != nil {
+			return nil, "", err
+		}
+	case ".app":
+		if !utils.IsFolder(appFolder) {
+			return nil, "", fmt.Errorf("the input app %s is not a folder", appFolder)
+		}
+	default:
+		return nil, "", fmt.Errorf("unsupported file type: %s (expected .ipa or .app)", filepath.Ext(appFolder))
+	}
+
+	targets, skipped, err := collectSignTargets(appFolder)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The targets come nested first, each one is attached to the innermost bundle containing it
+	results := make([]*VerifyResult, len(targets))
+	for i, target := range targets {
+		relativePath, _ := filepath.Rel(appFolder, target.path)
+		results[i] = &VerifyResult{Path: filepath.ToSlash(relativePath)}
+		results[i].Certificate, results[i].Err = verifyTarget(target)
+	}
+	innermostBundle := func(path string, from int) int {
+		for j := from; j < len(targets); j++ {
+			if targets[j].isBundle() && strings.HasPrefix(path, targets[j].path+string(filepath.Separator)) {
+				return j
+			}
+		}
+		return -1
+	}
+
+	var root *VerifyResult
+	for i, result := range results {
+		if targets[i].path == appFolder {
+			root = result
+			continue
+		}
+
+		if parent := innermostBundle(targets[i].path, i+1); parent >= 0 {
+			results[parent].Children = append(results[parent].Children, result)
+		}
+	}
+	if root == nil {
+		return nil, "", fmt.Errorf("the app %s has no executable", filepath.Base(appFolder))
+	}
+
+	for _, item := range skipped {
+		relativePath, _ := filepath.Rel(appFolder, item.path)
+		result := &VerifyResult{Path: filepath.ToSlash(relativePath), Err: fmt.Errorf("not signed: %s", item.reason)}
+		if parent := innermostBundle(item.path, 0); parent >= 0 {
+			results[parent].Children = append(results[parent].Children, result)
+		} else {
+			root.Children = append(root.Children, result)
+		}
+	}
+
+	return root, filepath.Base(appFolder), nil
+}
+
+// Verify the signature of a Mach-O file or a bundle, and the profile of the apps and extensions
+// Return the common name of the signing certificate, empty for ad-hoc signatures
+func verifyTarget(target signTarget) (string, error) {
+	signature, err := checkSignature(target)
+	if err != nil {
+		return "", err
+	}
+
+	var certificate string
+	if signature.CMS != nil {
+		if signer := signature.CMS.SignerCertificate(); signer != nil {
+			certificate = signer.Subject.CommonName
+		}
+	}
+
+	switch filepath.Ext(target.path) {
+	case ".app", ".appex":
+		// Ad-hoc signed apps have no provisioning profile
+		if signature.CMS == nil || !target.isBundle() {
+			return certificate, nil
+		}
+		b, err := readBundle(target.path)
+		if err != nil {
+			return certificate, err
+		}
+		return certificate, verifyEmbeddedProfile(b, signature)
+	}
+	return certificate, nil
+}
+
+// Check the code hashes of a Mach-O file, and the sealed resources of a bundle
+// Return the signature of the file or of the bundle executable
+func checkSignature(target signTarget) (*macho.Signature, error) {
+	path := target.path
+	var b *bundle
+	var infoPlist, codeResources []byte
+	if target.isBundle() {
+		var err error
+		b, err = readBundle(target.path)
+		if err != nil {
+			return nil, err
+		}
+		path = b.executable
+
+		if b.infoPlist != "" {
+			infoPlist, err = os.ReadFile(b.infoPlist)
+			if err != nil {
+				return nil, err
+			}
+		}
+		codeResources, err = os.ReadFile(b.codeResourcesPath())
+		if err != nil {
+			return nil, fmt.Errorf("the resources are not sealed (no _CodeSignature/CodeResources)")
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Page hashes, special slots and CMS signature
+	signatures, err := macho.Verify(data, infoPlist, codeResources)
+	if err != nil {
+		return nil, err
+	}
+
+	if b != nil {
+		if err := verifyCodeResources(b, codeResources); err != nil {
+			return nil, err
+		}
+	}
+	return signatures[0], nil
+}
+
+// Check the signature of the embedded profile, and the profile against the signing certificate,
+// the bundle identifier and the entitlements
+// The profile must be signed by the certificate it embeds, its chain up to Apple is not checked
+func verifyEmbeddedProfile(b *bundle, signature *macho.Signature) error {
+	profilePath := b.profilePath()
+	if !utils.FileExists(profilePath) {
+		return fmt.Errorf("no embedded provisioning profile")
+	}
+	data, err := os.ReadFile(profilePath)
+	if err != nil {
+		return err
+	}
+	envelope, err := macho.ParseCMS(data)
+	if err != nil {
+		return fmt.Errorf("invalid embedded provisioning profile: %s", err)
+	}
+	if envelope.Content == nil {
+		return fmt.Errorf("invalid embedded provisioning profile: the profile is not in its signature")
+	}
+	if err := envelope.Verify(envelope.Content); err != nil {
+		return fmt.Errorf("the signature of the embedded provisioning profile is invalid: %s", err)
+	}
+	profile, err := provisioningprofiles.ParseProvisioningProfile(profilePath, envelope.Content)
+	if err != nil {
+		return fmt.Errorf("invalid embedded provisioning profile: %s", err)
+	}
+
+	signer := signature.CMS.SignerCertificate()
+	if signer == nil {
+		return fmt.Errorf("the signing certificate is not embedded in the signature")
+	}
+	allowed := false
+	for _, certificate := range profile.DeveloperCertificates {
+		if bytes.Equal(certificate, signer.Raw) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("the signing certificate %s is not in the provisioning profile %s", signer.Subject.CommonName, profile.Name)
+	}
+
+	infoPlist, _, err := utils.ReadPlist(b.infoPlist)
+	if err != nil {
+		return fmt.Errorf("invalid Info.plist: %s", err)
+	}
+	identifier, _ := infoPlist["CFBundleIdentifier"].(string)
+	if !matchesEntitlementValue(profile.AppID, identifier) {
+		return fmt.Errorf("the bundle identifier %s does not match the provisioning profile %s (%s)", identifier, profile.Name, profile.AppID)
+	}
+
+	var entitlements map[string]interface{}
+	if data := signature.EntitlementsPlist(); data != nil {
+		if _, err := plist.Unmarshal(data, &entitlements); err != nil {
+			return fmt.Errorf("invalid entitlements: %s", err)
+		}
+	}
+	expected := profile.TeamID + "." + identifier
+	if applicationIdentifier, ok := entitlements["application-identifier"]; !ok {
+		return fmt.Errorf("the application-identifier entitlement is missing, expected %s", expected)
+	} else if applicationIdentifier != expected {
+		return fmt.Errorf("the application-identifier entitlement is %v, expected %s", applicationIdentifier, expected)
+	}
+	return checkEntitlements(entitlements, profile)
+}
+
+// Check that every entitlement is allowed by the provisioning profile
+func checkEntitlements(entitlements map[string]interface{}, profile provisioningprofiles.ProvisioningProfile) error {
+	keys := make([]string, 0, len(entitlements))
+	for key := range entitlements {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		allowed, ok := profile.Entitlements[key]
+		if !ok {
+			return fmt.Errorf("the entitlement %s is not in the provisioning profile %s", key, profile.Name)
+		}
+		if !entitlementAllowed(allowed, entitlements[key]) {
+			return fmt.Errorf("the entitlement %s = %v is not allowed by the provisioning profile %s (%v)", key, entitlements[key], profile.Name, allowed)
+		}
+	}
+	return nil
+}
+
+// Check an entitlement value against the value of the profile
+// Strings of the profile may end with a wildcard, the values of a list must all be in the list of the profile
+func entitlementAllowed(allowed interface{}, value interface{}) bool {
+	switch allowed := allowed.(type) {
+	case bool:
+		// A capability enabled in the profile may be disabled
+		enabled, ok := value.(bool)
+		return ok && (allowed || !enabled)
+	case string:
+		if value, ok := value.(string); ok {
+			return matchesEntitlementValue(allowed, value)
+		}
+		// A wildcard string allows a list of values
+		if values, ok := value.([]interface{}); ok {
+			for _, value := range values {
+				if !entitlementAllowed(allowed, value) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	case []interface{}:
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+		for _, value := range values {
+			found := false
+			for _, allowedValue := range allowed {
+				if entitlementAllowed(allowedValue, value) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(allowed, value)
+	}
+}
+
+// Match a value of the profile ending with a wildcard, like "TEAMID.*" or "*"
+func matchesEntitlementValue(allowed string, value string) bool {
+	if prefix := strings.TrimSuffix(allowed, "*"); prefix != allowed {
+		return strings.HasPrefix(value, prefix)
+	}
+	return allowed == value
+}
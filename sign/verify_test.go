@@ -0,0 +1,222 @@
+package sign
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/e-n-0/sign-app-cli/macho"
+
+	"howett.net/plist"
+)
+
+// Encode a BER element with an indefinite length, like the CMS envelopes of Apple's profiles
+func testIndefinite(tag byte, children ...[]byte) []byte {
+	data := []byte{tag, 0x80}
+	for _, child := range children {
+		data = append(data, child...)
+	}
+	return append(data, 0, 0)
+}
+
+func testDER(t *testing.T, value interface{}, params string) []byte {
+	t.Helper()
+
+	data, err := asn1.MarshalWithParams(value, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Write a provisioning profile of the bundle identifier allowing the identity and the entitlements,
+// signed by the identity in a BER encoded CMS envelope
+func writeTestSignedProfile(t *testing.T, path string, identifier string, entitlements map[string]interface{}, identity *macho.Identity) {
+	t.Helper()
+
+	profileEntitlements := map[string]interface{}{"application-identifier": "TEAM123456." + identifier}
+	for key, value := range entitlements {
+		profileEntitlements[key] = value
+	}
+	content, err := plist.Marshal(map[string]interface{}{
+		"Name":                  "Test Profile",
+		"UUID":                  "00000000-0000-0000-0000-000000000000",
+		"CreationDate":          time.Now().Add(-time.Hour),
+		"ExpirationDate":        time.Now().Add(time.Hour),
+		"Entitlements":          profileEntitlements,
+		"DeveloperCertificates": [][]byte{identity.Certificate.Raw},
+	}, plist.XMLFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oid := func(value ...int) []byte { return testDER(t, asn1.ObjectIdentifier(value), "") }
+	oidData := oid(1, 2, 840, 113549, 1, 7, 1)
+	sha256Algorithm := testDER(t, []asn1.RawValue{{FullBytes: oid(2, 16, 840, 1, 101, 3, 4, 2, 1)}}, "")
+
+	// Signed attributes: content type and message digest
+	digest := sha256.Sum256(content)
+	attributes := append(
+		testDER(t, []asn1.RawValue{{FullBytes: oid(1, 2, 840, 113549, 1, 9, 3)}, {FullBytes: testDER(t, []asn1.RawValue{{FullBytes: oidData}}, "set")}}, ""),
+		testDER(t, []asn1.RawValue{{FullBytes: oid(1, 2, 840, 113549, 1, 9, 4)}, {FullBytes: testDER(t, []asn1.RawValue{{FullBytes: testDER(t, digest[:], "")}}, "set")}}, "")...)
+	attributesDigest := sha256.Sum256(testDER(t, asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attributes}, ""))
+	signature, err := identity.Key.Sign(rand.Reader, attributesDigest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signerInfo := testDER(t, []asn1.RawValue{
+		{FullBytes: testDER(t, 1, "")},
+		{FullBytes: testDER(t, []asn1.RawValue{{FullBytes: identity.Certificate.RawIssuer}, {FullBytes: testDER(t, identity.Certificate.SerialNumber, "")}}, "")},
+		{FullBytes: sha256Algorithm},
+		{FullBytes: testDER(t, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attributes}, "")},
+		{FullBytes: testDER(t, []asn1.RawValue{{FullBytes: oid(1, 2, 840, 10045, 4, 3, 2)}}, "")},
+		{FullBytes: testDER(t, signature, "")},
+	}, "")
+
+	// The content is split in a constructed octet string
+	half := len(content) / 2
+	encapsulated := testIndefinite(0x30, oidData, testIndefinite(0xa0, testIndefinite(0x24, testDER(t, content[:half], ""), testDER(t, content[half:], ""))))
+	signedData := testIndefinite(0x30,
+		testDER(t, 1, ""),
+		testDER(t, []asn1.RawValue{{FullBytes: sha256Algorithm}}, "set"),
+		encapsulated,
+		testDER(t, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: identity.Certificate.Raw}, ""),
+		testDER(t, []asn1.RawValue{{FullBytes: signerInfo}}, "set"),
+	)
+	envelope := testIndefinite(0x30, oid(1, 2, 840, 113549, 1, 7, 2), testIndefinite(0xa0, signedData))
+
+	if err := os.WriteFile(path, envelope, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestEntitlements(t *testing.T, entitlements map[string]interface{}) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "entitlements.plist")
+	if err := writeEntitlements(path, entitlements); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerify(t *testing.T) {
+	identity := testIdentity(t, "Apple Development: Jane Doe (ABCDE12345)")
+	other := testIdentity(t, "Apple Development: John Doe (FGHIJ67890)")
+	allowed := map[string]interface{}{"application-identifier": "TEAM123456.com.example.test", "get-task-allow": true}
+
+	tests := []struct {
+		name string
+		// Change the app before signing, and after signing
+		prepare func(t *testing.T, app string)
+		modify  func(t *testing.T, app string)
+		// Entitlements of the signature, the allowed ones when nil
+		entitlements map[string]interface{}
+		failure      string
+		failurePath  string
+	}{
+		{name: "valid"},
+		{name: "tampered resource", modify: func(t *testing.T, app string) {
+			if err := os.WriteFile(filepath.Join(app, "resource.txt"), []byte("modified"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, failure: "resource.txt", failurePath: "."},
+		{name: "missing seal", modify: func(t *testing.T, app string) {
+			if err := os.Remove(filepath.Join(app, "_CodeSignature", "CodeResources")); err != nil {
+				t.Fatal(err)
+			}
+		}, failure: "not sealed", failurePath: "."},
+		{name: "entitlement not in the profile", entitlements: map[string]interface{}{
+			"application-identifier": "TEAM123456.com.example.test",
+			"aps-environment":        "production",
+		}, failure: "aps-environment is not in the provisioning profile", failurePath: "."},
+		{name: "profile signed by another key", prepare: func(t *testing.T, app string) {
+			writeTestSignedProfile(t, filepath.Join(app, "embedded.mobileprovision"), "com.example.test", allowed, &macho.Identity{Certificate: identity.Certificate, Key: other.Key})
+		}, failure: "signature of the embedded provisioning profile is invalid", failurePath: "."},
+		{name: "unsigned profile", prepare: func(t *testing.T, app string) {
+			if err := os.WriteFile(filepath.Join(app, "embedded.mobileprovision"), []byte("<?xml version=\"1.0\"?><plist><dict/></plist>"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}, failure: "invalid embedded provisioning profile", failurePath: "."},
+		{name: "unsigned Mach-O file", prepare: func(t *testing.T, app string) {
+			writeTestMachO(t, filepath.Join(app, "Frameworks", "libD.o"), testMachOObject)
+		}, failure: "not signed", failurePath: "Frameworks/libD.o"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := filepath.Join(t.TempDir(), "Test.app")
+			executable := writeTestBundle(t, app, "com.example.test")
+			writeSignableTestMachO(t, executable)
+			if err := os.WriteFile(filepath.Join(app, "resource.txt"), []byte("resource"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			writeTestSignedProfile(t, filepath.Join(app, "embedded.mobileprovision"), "com.example.test", allowed, identity)
+			if test.prepare != nil {
+				test.prepare(t, app)
+			}
+
+			entitlements := test.entitlements
+			if entitlements == nil {
+				entitlements = allowed
+			}
+			options := SignOptions{Identity: "Apple Development", EntitlementsFile: writeTestEntitlements(t, entitlements), Output: io.Discard}
+			if err := (NativeSigner{Identity: identity}).Sign(executable, options); err != nil {
+				t.Fatal(err)
+			}
+			if test.modify != nil {
+				test.modify(t, app)
+			}
+
+			result, appName, err := Verify(app, io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if appName != "Test.app" {
+				t.Errorf("app name %q", appName)
+			}
+
+			failure := result.FirstFailure()
+			if test.failure == "" {
+				if failure != nil {
+					t.Errorf("%s: %s", failure.Path, failure.Err)
+				}
+				if result.Certificate != identity.Certificate.Subject.CommonName {
+					t.Errorf("certificate %q", result.Certificate)
+				}
+				return
+			}
+			if failure == nil {
+				t.Fatal("no failure")
+			}
+			if failure.Path != test.failurePath || !strings.Contains(failure.Err.Error(), test.failure) {
+				t.Errorf("failure of %s: %s, expected %s: %s", failure.Path, failure.Err, test.failurePath, test.failure)
+			}
+		})
+	}
+}
+
+func TestVerifyResultPrint(t *testing.T) {
+	result := &VerifyResult{Path: ".", Certificate: "Apple Development: Jane Doe", Children: []*VerifyResult{
+		{Path: "Frameworks/libC.dylib"},
+		{Path: "Frameworks/libD.o", Err: errors.New("not signed: not an executable, a library or a bundle")},
+	}}
+
+	var output strings.Builder
+	result.Print(&output, "Test.app")
+	expected := "\033[32mPASS\033[0m Test.app (Apple Development: Jane Doe)\n" +
+		"  \033[32mPASS\033[0m Frameworks/libC.dylib (ad-hoc)\n" +
+		"  \033[31mFAIL\033[0m Frameworks/libD.o: not signed: not an executable, a library or a bundle\n"
+	if output.String() != expected {
+		t.Errorf("output %q", output.String())
+	}
+}
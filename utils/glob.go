@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"path"
+	"strings"
+)
+
+// Check if a slash separated path matches a glob pattern
+// Patterns follow path.Match, with "**" matching any number of directories
+func MatchGlob(pattern string, name string) bool {
+	return matchGlobComponents(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobComponents(pattern []string, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Try to match the rest of the pattern at every depth
+			for i := 0; i <= len(name); i++ {
+				if matchGlobComponents(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if matched, err := path.Match(pattern[0], name[0]); err != nil || !matched {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
+}
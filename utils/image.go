@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"image"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+)
+
+// Read a PNG file
+func ReadPNG(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return png.Decode(file)
+}
+
+// Write an image to a PNG file
+func WritePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Resize an image to a square of the given size
+// Each destination pixel is the area-weighted average of the source pixels it covers,
+// which gives smooth results when scaling down (the usual case for icons)
+func ResizeSquare(src image.Image, size int) *image.RGBA {
+	// Work on premultiplied colors so transparent pixels do not bleed
+	bounds := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	horizontal := resampleAxis(rgba.Pix, bounds.Dx(), bounds.Dy(), size, true)
+	vertical := resampleAxis(horizontal, size, bounds.Dy(), size, false)
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	copy(dst.Pix, vertical)
+	return dst
+}
+
+// Resample an RGBA buffer along one axis
+func resampleAxis(pix []byte, width int, height int, size int, horizontal bool) []byte {
+	srcLength, otherLength := height, width
+	if horizontal {
+		srcLength, otherLength = width, height
+	}
+
+	dstWidth, dstHeight := width, size
+	if horizontal {
+		dstWidth, dstHeight = size, height
+	}
+	out := make([]byte, dstWidth*dstHeight*4)
+
+	scale := float64(srcLength) / float64(size)
+	for d := 0; d < size; d++ {
+		// Source interval covered by the destination pixel
+		start := float64(d) * scale
+		end := start + scale
+		if scale < 1 {
+			// Upscaling: sample the nearest source pixel
+			start = math.Min(math.Floor(start+scale/2), float64(srcLength-1))
+			end = start + 1
+		}
+
+		for o := 0; o < otherLength; o++ {
+			var sum [4]float64
+			var total float64
+			for s := int(start); s < int(math.Ceil(end)) && s < srcLength; s++ {
+				weight := math.Min(end, float64(s+1)) - math.Max(start, float64(s))
+				if weight <= 0 {
+					continue
+				}
+
+				index := (o*width + s) * 4
+				if !horizontal {
+					index = (s*width + o) * 4
+				}
+				for c := 0; c < 4; c++ {
+					sum[c] += float64(pix[index+c]) * weight
+				}
+				total += weight
+			}
+
+			index := (o*dstWidth + d) * 4
+			if !horizontal {
+				index = (d*dstWidth + o) * 4
+			}
+			for c := 0; c < 4; c++ {
+				out[index+c] = uint8(math.Round(sum[c] / total))
+			}
+		}
+	}
+
+	return out
+}
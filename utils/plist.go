@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+
+	"howett.net/plist"
+)
+
+// Read a plist file into a map and return the format it was stored in
+// (binary, XML or OpenStep) so it can be written back the same way
+func ReadPlist(path string) (map[string]interface{}, int, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, plist.InvalidFormat, err
+	}
+
+	var data map[string]interface{}
+	format, err := plist.Unmarshal(bytes, &data)
+	if err != nil {
+		return nil, plist.InvalidFormat, fmt.Errorf("failed to parse plist file %s: %s", path, err)
+	}
+
+	return data, format, nil
+}
+
+// Write a plist file using the given format
+func WritePlist(path string, data interface{}, format int) error {
+	var bytes []byte
+	var err error
+	if format == plist.BinaryFormat {
+		bytes, err = plist.Marshal(data, format)
+	} else {
+		bytes, err = plist.MarshalIndent(data, format, "\t")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode plist file %s: %s", path, err)
+	}
+
+	// Keep the permissions of the existing file
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	return os.WriteFile(path, bytes, mode)
+}
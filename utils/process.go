@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -8,12 +9,17 @@ import (
 
 // Function that executes a process with given arguments
 func ExecuteProcess(args ...string) ([]byte, int, error) {
+	return ExecuteProcessContext(context.Background(), args...)
+}
+
+// Execute a process with given arguments, the process is killed when the context is done
+func ExecuteProcessContext(ctx context.Context, args ...string) ([]byte, int, error) {
 	if len(args) == 0 {
 		return nil, -1, fmt.Errorf("executeProcess: no program given")
 	}
 
 	// Create a new process
-	process := exec.Command(args[0], args[1:]...)
+	process := exec.CommandContext(ctx, args[0], args[1:]...)
 
 	// Set the process attributes
 	//process.Stdout = stdout
@@ -43,6 +43,22 @@ func ExtractZip(src string, dest string) error {
 
 		if f.FileInfo().IsDir() {
 			os.MkdirAll(path, 0755)
+		} else if f.Mode()&os.ModeSymlink != 0 {
+			// Symbolic links are stored with their target as content
+			link, err := io.ReadAll(rc)
+			if err != nil {
+				return err
+			}
+
+			target := filepath.Join(filepath.Dir(path), string(link))
+			if filepath.IsAbs(string(link)) || !strings.HasPrefix(target, filepath.Clean(dest)+string(os.PathSeparator)) {
+				return fmt.Errorf("illegal symbolic link: %s", path)
+			}
+
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if err := os.Symlink(string(link), path); err != nil {
+				return err
+			}
 		} else {
 			os.MkdirAll(filepath.Dir(path), 0755)
 			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
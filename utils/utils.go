@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
 )
 
 func Contains(slice []string, item string) bool {
@@ -56,6 +59,58 @@ func CopyFile(src string, dst string) error {
 	return nil
 }
 
+// Copy a folder tree, keeping the file modes and the symbolic links
+func CopyFolder(src string, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relativePath)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			return ioutil.WriteFile(target, data, info.Mode().Perm())
+		}
+	})
+}
+
+// Copy a folder tree with copy-on-write clones when the file system supports them
+// (APFS, Btrfs, XFS), with a plain copy otherwise
+// The destination must not exist
+func CloneFolder(src string, dst string) error {
+	var clone *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		clone = exec.Command("cp", "-c", "-pR", src, dst)
+	case "linux":
+		clone = exec.Command("cp", "-a", "--reflink=auto", src, dst)
+	}
+	if clone != nil {
+		if err := clone.Run(); err == nil {
+			return nil
+		}
+		os.RemoveAll(dst)
+	}
+	return CopyFolder(src, dst)
+}
+
 func StringInSlice(a string, list []string) bool {
 	for _, b := range list {
 		if b == a {
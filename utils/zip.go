@@ -2,25 +2,26 @@ package utils
 
 import (
 	"archive/zip"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 )
 
-func CreateZip(dst string, src string) error {
+// Zip the folders, each one is stored under its name at the root of the archive
+func CreateZip(dst string, srcs ...string) error {
 	// Zip the Payload folder
-	fmt.Println("Zipping the Payload folder...")
 	zipFile, err := os.Create(dst)
 	if err != nil {
 		return err
 	}
 
 	zipWriter := zip.NewWriter(zipFile)
-	err = addFilesToZip(zipWriter, src, filepath.Base(src))
-	if err != nil {
-		return err
+	for _, src := range srcs {
+		err = addFilesToZip(zipWriter, src, filepath.Base(src))
+		if err != nil {
+			return err
+		}
 	}
 
 	zipWriter.Close()
@@ -57,19 +58,40 @@ func addFilesToZip(zipWriter *zip.Writer, folderPath string, baseInZip string) e
 }
 
 func addFileToZip(zipWriter *zip.Writer, filePath string, baseInZip string) error {
-	// Open the file
-	fileToZip, err := os.Open(filePath)
+	info, err := os.Lstat(filePath)
 	if err != nil {
 		return err
 	}
-	defer fileToZip.Close()
 
-	// filename := filepath.Base(filePath)
-	filename := filepath.Join(baseInZip, filepath.Base(filePath))
-	f, err := zipWriter.Create(filename)
+	// Keep the file mode so the executables stay executable once extracted
+	header, err := zip.FileInfoHeader(info)
 	if err != nil {
 		return err
 	}
+	header.Name = filepath.ToSlash(filepath.Join(baseInZip, filepath.Base(filePath)))
+	header.Method = zip.Deflate
+
+	f, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	// Symbolic links (macOS frameworks) are stored with their target as content
+	if info.Mode()&os.ModeSymlink != 0 {
+		link, err := os.Readlink(filePath)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write([]byte(link))
+		return err
+	}
+
+	// Open the file
+	fileToZip, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer fileToZip.Close()
 
 	// Copy file data to zip writer
 	_, err = io.Copy(f, fileToZip)